@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+
+	"github.com/namsral/flag"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+
+	"github.com/JonPulfer/gold_sales/pkg/gold_sales"
+	"github.com/JonPulfer/gold_sales/pkg/gold_sales/service/managers"
+)
+
+// alertsCommand flags customers whose spending is unusual for them, as a
+// first pass signal of fraud.
+func alertsCommand(args []string) error {
+	flags := flag.NewFlagSet("alerts", flag.ExitOnError)
+	options := gold_sales.DefaultAnomalyOptions()
+	var inputFilename string
+	flags.StringVar(&inputFilename, "inputFilename", "sample-transactions.csv", "CSV ledger, .jsonl store or .events log to read from")
+	var outputFormat string
+	flags.StringVar(&outputFormat, "outputFormat", "json", "Alerts report format, json or csv")
+	var outputFilename string
+	flags.StringVar(&outputFilename, "outputFilename", "-", "File to write the alerts report to, - for stdout")
+	var rankBy string
+	flags.StringVar(&rankBy, "rankBy", string(options.Metric), "Metric to measure spend by, grams or amount")
+	flags.IntVar(&options.TrailingMonths, "trailingMonths", options.TrailingMonths, "Trailing months to compare each month with")
+	flags.IntVar(&options.MinHistoryMonths, "minHistoryMonths", options.MinHistoryMonths, "Fewest trailing months a month is compared with")
+	flags.Float64Var(&options.MaxScore, "maxScore", options.MaxScore, "Largest robust z-score of a month that is not flagged")
+	flags.Float64Var(&options.LargeSpendFactor, "largeSpendFactor", options.LargeSpendFactor, "Flag spends more than this many times the median of the customer's other spends")
+	flags.IntVar(&options.MinSpends, "minSpends", options.MinSpends, "Fewest other spends a spend is compared with")
+	flags.IntVar(&options.BurstSpends, "burstSpends", options.BurstSpends, "Flag this many spends or more within the burst window")
+	flags.DurationVar(&options.BurstWindow, "burstWindow", options.BurstWindow, "Window a burst of spends is made within")
+	duplicates := duplicatesFlag(flags)
+	_ = flags.Parse(args)
+
+	if outputFormat != "json" && outputFormat != "csv" {
+		return failed(exitUsage, errors.Errorf("unknown alerts format %q", outputFormat),
+			"invalid output format")
+	}
+	metric, err := gold_sales.ParseRankingMetric(rankBy)
+	if err != nil {
+		return failed(exitUsage, err, "invalid spend metric")
+	}
+	options.Metric = metric
+	if options.TrailingMonths < 1 || options.MinHistoryMonths < 1 ||
+		options.MinHistoryMonths > options.TrailingMonths {
+		return failed(exitUsage,
+			errors.New("-minHistoryMonths must be between 1 and -trailingMonths"),
+			"invalid anomaly options")
+	}
+
+	deduplicated, err := openDeduplicated(inputFilename, *duplicates)
+	if err != nil {
+		return err
+	}
+	defer deduplicated.Close()
+	report, err := managers.NewAnalysisService(deduplicated).Anomalies(context.Background(), options)
+	logDuplicates(deduplicated)
+	if err != nil {
+		return ledgerFailed(err, "failed to find anomalies")
+	}
+
+	write := report.WriteJSON
+	if outputFormat == "csv" {
+		write = report.WriteCSV
+	}
+	if err := writeOutput(outputFilename, write); err != nil {
+		return failed(exitOutput, err, "failed to write alerts report")
+	}
+	log.Info().Int("alerts", len(report.Alerts)).Msg("alerts report written")
+	return nil
+}
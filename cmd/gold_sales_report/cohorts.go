@@ -0,0 +1,52 @@
+package main
+
+import (
+	"context"
+
+	"github.com/namsral/flag"
+	"github.com/pkg/errors"
+
+	"github.com/JonPulfer/gold_sales/pkg/gold_sales/service/managers"
+)
+
+// cohortsCommand writes the retention of customers by the month of their
+// first gold payment.
+func cohortsCommand(args []string) error {
+	flags := flag.NewFlagSet("cohorts", flag.ExitOnError)
+	var inputFilename string
+	flags.StringVar(&inputFilename, "inputFilename", "sample-transactions.csv", "CSV ledger, .jsonl store or .events log to read from")
+	var outputFormat string
+	flags.StringVar(&outputFormat, "outputFormat", "csv", "Cohort report format, csv, json or html")
+	var outputFilename string
+	flags.StringVar(&outputFilename, "outputFilename", "-", "File to write the cohort report to, - for stdout")
+	duplicates := duplicatesFlag(flags)
+	_ = flags.Parse(args)
+
+	if outputFormat != "csv" && outputFormat != "json" && outputFormat != "html" {
+		return failed(exitUsage, errors.Errorf("unknown cohort report format %q", outputFormat),
+			"invalid output format")
+	}
+
+	deduplicated, err := openDeduplicated(inputFilename, *duplicates)
+	if err != nil {
+		return err
+	}
+	defer deduplicated.Close()
+	report, err := managers.NewAnalysisService(deduplicated).Cohorts(context.Background())
+	logDuplicates(deduplicated)
+	if err != nil {
+		return ledgerFailed(err, "failed to build cohorts")
+	}
+
+	write := report.WriteCSV
+	switch outputFormat {
+	case "json":
+		write = report.WriteJSON
+	case "html":
+		write = report.WriteHTML
+	}
+	if err := writeOutput(outputFilename, write); err != nil {
+		return failed(exitOutput, err, "failed to write cohort report")
+	}
+	return nil
+}
@@ -0,0 +1,276 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"strings"
+
+	"github.com/namsral/flag"
+	"github.com/pkg/errors"
+
+	"github.com/JonPulfer/gold_sales/pkg/gold_sales"
+	"github.com/JonPulfer/gold_sales/pkg/gold_sales/infrastructure/repository"
+)
+
+// reportConfig for a report run. Defaults are overridden by the config file,
+// which is overridden by environment variables, which are overridden by flags.
+type reportConfig struct {
+	Inputs           []inputConfig             `json:"inputs"`
+	NumTopSpenders   int                       `json:"numTopSpenders"`
+	NumMonths        int                       `json:"numMonths"`
+	RankBy           string                    `json:"rankBy"`
+	NetRefunds       string                    `json:"netRefunds"`
+	Duplicates       string                    `json:"duplicates"`
+	Rules            []gold_sales.RuleConfig   `json:"rules,omitempty"`
+	Limits           []gold_sales.LimitConfig  `json:"limits,omitempty"`
+	Outputs          []gold_sales.OutputTarget `json:"outputs"`
+	ManifestFilename string                    `json:"manifestFilename,omitempty"`
+	CSV              csvConfig                 `json:"csv"`
+	TemplateFilename string                    `json:"templateFilename,omitempty"`
+	SnapshotFilename string                    `json:"snapshotFilename,omitempty"`
+	StateFilename    string                    `json:"stateFilename,omitempty"`
+	MetricsAddr      string                    `json:"metricsAddr,omitempty"`
+	MetricsFilename  string                    `json:"metricsFilename,omitempty"`
+	TraceFilename    string                    `json:"traceFilename,omitempty"`
+}
+
+// inputConfig is a ledger to read payments from. Columns maps the required
+// field names to the headers a CSV ledger uses for them. Rules replace the
+// rules of the report config for the payments of this ledger.
+type inputConfig struct {
+	Filename string                  `json:"filename"`
+	Columns  map[string]string       `json:"columns,omitempty"`
+	Rules    []gold_sales.RuleConfig `json:"rules,omitempty"`
+}
+
+type csvConfig struct {
+	Header    bool   `json:"header"`
+	Rank      bool   `json:"rank"`
+	Email     bool   `json:"email"`
+	Delimiter string `json:"delimiter"`
+	CRLF      bool   `json:"crlf"`
+	BOM       bool   `json:"bom"`
+}
+
+func defaultReportConfig() reportConfig {
+	return reportConfig{
+		Inputs:         []inputConfig{{Filename: "sample-transactions.csv"}},
+		NumTopSpenders: 3,
+		NumMonths:      6,
+		RankBy:         string(gold_sales.RankByGrams),
+		NetRefunds:     string(gold_sales.NetInRefundMonth),
+		Duplicates:     string(repository.WarnDuplicates),
+		Outputs:        []gold_sales.OutputTarget{{Format: "csv", Filename: "output.csv"}},
+		CSV:            csvConfig{Delimiter: ","},
+	}
+}
+
+// loadConfigFile over the defaults. Settings missing from the file keep their
+// default values.
+func loadConfigFile(filename string) (reportConfig, error) {
+	config := defaultReportConfig()
+	contents, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return config, err
+	}
+	if err := json.Unmarshal(contents, &config); err != nil {
+		return config, errors.Wrapf(err, "failed to parse config file %s", filename)
+	}
+	return config, nil
+}
+
+// inputRules for the payments of the input, its own rules if it has any and
+// the rules of the config if not.
+func (rc reportConfig) inputRules(input inputConfig) []gold_sales.RuleConfig {
+	if len(input.Rules) > 0 {
+		return input.Rules
+	}
+	return rc.Rules
+}
+
+// csvOptions for the CSV renderer from the output settings.
+func (rc reportConfig) csvOptions() (gold_sales.CSVOptions, error) {
+	delimiter, err := parseDelimiter(rc.CSV.Delimiter)
+	if err != nil {
+		return gold_sales.CSVOptions{}, err
+	}
+	return gold_sales.CSVOptions{
+		Header:    rc.CSV.Header,
+		Rank:      rc.CSV.Rank,
+		Email:     rc.CSV.Email,
+		Delimiter: delimiter,
+		CRLF:      rc.CSV.CRLF,
+		BOM:       rc.CSV.BOM,
+	}, nil
+}
+
+// reportCSVFlags for the dialect of the CSV reports a command reads, so
+// reports written with other than the default options can be loaded. Commands
+// with CSV output flags of their own give a prefix for these flags.
+func reportCSVFlags(flags *flag.FlagSet, prefix string) *csvConfig {
+	name := func(option string) string {
+		if prefix == "" {
+			return "csv" + option
+		}
+		return prefix + "CSV" + option
+	}
+	config := &csvConfig{Delimiter: ","}
+	flags.StringVar(&config.Delimiter, name("Delimiter"), config.Delimiter, "Field delimiter of CSV reports read, use tab for a tab")
+	flags.BoolVar(&config.Header, name("Header"), false, "CSV reports read have a header row")
+	flags.BoolVar(&config.Rank, name("Rank"), false, "CSV reports read without a header row have the rank column")
+	flags.BoolVar(&config.Email, name("Email"), false, "CSV reports read without a header row have the email column")
+	return config
+}
+
+// inputsFlag sets the inputs from a comma separated list of filenames,
+// replacing any inputs from the config file.
+type inputsFlag struct {
+	config *reportConfig
+}
+
+func (f inputsFlag) String() string {
+	if f.config == nil {
+		return ""
+	}
+	filenames := make([]string, len(f.config.Inputs))
+	for i, input := range f.config.Inputs {
+		filenames[i] = input.Filename
+	}
+	return strings.Join(filenames, ",")
+}
+
+func (f inputsFlag) Set(value string) error {
+	f.config.Inputs = make([]inputConfig, 0)
+	for _, filename := range strings.Split(value, ",") {
+		if filename = strings.TrimSpace(filename); filename != "" {
+			f.config.Inputs = append(f.config.Inputs, inputConfig{Filename: filename})
+		}
+	}
+	return nil
+}
+
+// outputsFlag sets the outputs from a comma separated list of format=filename
+// pairs, replacing any outputs from the config file.
+type outputsFlag struct {
+	config *reportConfig
+}
+
+func (f outputsFlag) String() string {
+	if f.config == nil {
+		return ""
+	}
+	outputs := make([]string, len(f.config.Outputs))
+	for i, output := range f.config.Outputs {
+		outputs[i] = output.Format + "=" + output.Filename
+	}
+	return strings.Join(outputs, ",")
+}
+
+func (f outputsFlag) Set(value string) error {
+	f.config.Outputs = make([]gold_sales.OutputTarget, 0)
+	for _, output := range strings.Split(value, ",") {
+		if output = strings.TrimSpace(output); output == "" {
+			continue
+		}
+		parts := strings.SplitN(output, "=", 2)
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return errors.Errorf("output %q is not format=filename", output)
+		}
+		f.config.Outputs = append(f.config.Outputs,
+			gold_sales.OutputTarget{Format: parts[0], Filename: parts[1]})
+	}
+	return nil
+}
+
+// firstOutputFlag sets a field of the first output, for the single output
+// flags that predate -outputs.
+type firstOutputFlag struct {
+	config *reportConfig
+	field  func(output *gold_sales.OutputTarget) *string
+}
+
+func (f firstOutputFlag) String() string {
+	if f.config == nil || len(f.config.Outputs) == 0 {
+		return ""
+	}
+	return *f.field(&f.config.Outputs[0])
+}
+
+func (f firstOutputFlag) Set(value string) error {
+	if len(f.config.Outputs) == 0 {
+		f.config.Outputs = append(f.config.Outputs,
+			gold_sales.OutputTarget{Format: "csv", Filename: "output.csv"})
+	}
+	*f.field(&f.config.Outputs[0]) = value
+	return nil
+}
+
+func outputFormat(output *gold_sales.OutputTarget) *string   { return &output.Format }
+func outputFilename(output *gold_sales.OutputTarget) *string { return &output.Filename }
+
+// parseReportConfig from the args, environment and the config file they name.
+// The flags are bound to the config, so once the file is loaded the flags
+// and environment variables that were given are applied again on top of it.
+func parseReportConfig(flags *flag.FlagSet, args []string) (reportConfig, bool, error) {
+	config := defaultReportConfig()
+	flags.Var(inputsFlag{&config}, "inputFilename",
+		"CSV ledgers or .jsonl stores to read from, separated by commas")
+	flags.IntVar(&config.NumTopSpenders, "numTopSpenders", config.NumTopSpenders, "Number of top spenders per month")
+	flags.IntVar(&config.NumMonths, "numMonths", config.NumMonths, "Number of months")
+	flags.StringVar(&config.RankBy, "rankBy", config.RankBy, "Metric to rank spenders by, grams or amount")
+	flags.StringVar(&config.NetRefunds, "netRefunds", config.NetRefunds, "Month to net refunds in, refund or original for the month of the spend refunded")
+	flags.StringVar(&config.Duplicates, "duplicates", config.Duplicates, "What to do with payments found more than once, warn to keep them, drop or fail")
+	flags.Var(firstOutputFlag{&config, outputFilename}, "outputFilename", "Output filename")
+	flags.Var(firstOutputFlag{&config, outputFormat}, "outputFormat", "Output format, one of the registered renderers")
+	flags.Var(outputsFlag{&config}, "outputs",
+		"Outputs to render the report to as format=filename pairs separated by commas, e.g. csv=output.csv,json=output.json")
+	flags.StringVar(&config.ManifestFilename, "manifestFilename", "", "File to write a JSON manifest of the outputs and their SHA-256 checksums to")
+	flags.BoolVar(&config.CSV.Header, "csvHeader", false, "Write a header row in CSV output")
+	flags.BoolVar(&config.CSV.Rank, "csvRank", false, "Include the rank column in CSV output")
+	flags.BoolVar(&config.CSV.Email, "csvEmail", false, "Include the email column in CSV output")
+	flags.BoolVar(&config.CSV.CRLF, "csvCRLF", false, "Use CRLF line endings in CSV output")
+	flags.BoolVar(&config.CSV.BOM, "csvBOM", false, "Start CSV output with a UTF-8 byte order mark")
+	flags.StringVar(&config.CSV.Delimiter, "csvDelimiter", config.CSV.Delimiter, "Field delimiter for CSV output, use tab for a tab")
+	flags.StringVar(&config.TemplateFilename, "templateFilename", "", "Go template to render the report with, selected by -outputFormat=template")
+	flags.StringVar(&config.SnapshotFilename, "snapshotFilename", "", "File to keep monthly aggregates in so unchanged months are not aggregated again")
+	flags.StringVar(&config.StateFilename, "stateFilename", "", "File to keep running totals and the watermark of a single append only CSV ledger in, so only new rows are read")
+	flags.StringVar(&config.MetricsAddr, "metricsAddr", "", "Address to serve Prometheus metrics on at /metrics, e.g. :9090")
+	flags.StringVar(&config.MetricsFilename, "metricsFilename", "", "File to write Prometheus metrics to after the run")
+	flags.StringVar(&config.TraceFilename, "traceFilename", "", "File to write trace spans to as JSON lines, - for stdout")
+	// Not named config, which the flag package reserves for its own
+	// key=value config files.
+	var configFilename string
+	flags.StringVar(&configFilename, "configFilename", "", "JSON config file with the settings for the run")
+	var printConfig bool
+	flags.BoolVar(&printConfig, "printConfig", false, "Print the effective config as JSON and exit")
+	if err := flags.Parse(args); err != nil {
+		return config, false, err
+	}
+
+	given := make(map[string]string)
+	flags.Visit(func(f *flag.Flag) {
+		given[f.Name] = f.Value.String()
+	})
+	_, outputs := given["outputs"]
+	_, format := given["outputFormat"]
+	_, filename := given["outputFilename"]
+	if outputs && (format || filename) {
+		return config, printConfig, errors.New(
+			"-outputs cannot be combined with -outputFormat or -outputFilename")
+	}
+	if configFilename == "" {
+		return config, printConfig, nil
+	}
+
+	fileConfig, err := loadConfigFile(configFilename)
+	if err != nil {
+		return config, printConfig, err
+	}
+	config = fileConfig
+	for name, value := range given {
+		if err := flags.Set(name, value); err != nil {
+			return config, printConfig, err
+		}
+	}
+	return config, printConfig, nil
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/namsral/flag"
+
+	"github.com/JonPulfer/gold_sales/pkg/gold_sales"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseReportConfigPrecedence(t *testing.T) {
+	dir, err := ioutil.TempDir("", "config")
+	require.Nil(t, err)
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	configFilename := filepath.Join(dir, "report.json")
+	require.Nil(t, ioutil.WriteFile(configFilename, []byte(`{
+		"inputs": [{"filename": "ledger.csv", "columns": {"amount": "value"}}],
+		"numTopSpenders": 5,
+		"numMonths": 12,
+		"outputs": [
+			{"format": "html", "filename": "report.html"},
+			{"format": "json", "filename": "report.json"}
+		]
+	}`), 0644))
+
+	require.Nil(t, os.Setenv("NUMMONTHS", "4"))
+	t.Cleanup(func() { os.Unsetenv("NUMMONTHS") })
+
+	flags := flag.NewFlagSet("report", flag.ContinueOnError)
+	config, printConfig, err := parseReportConfig(flags, []string{
+		"-configFilename", configFilename, "-numTopSpenders", "2",
+		"-outputFilename", "top.html"})
+	require.Nil(t, err, "unexpected error")
+
+	assert.False(t, printConfig)
+	assert.Equal(t, 2, config.NumTopSpenders, "flags override the file")
+	assert.Equal(t, 4, config.NumMonths, "environment overrides the file")
+	assert.Equal(t, []gold_sales.OutputTarget{
+		{Format: "html", Filename: "top.html"},
+		{Format: "json", Filename: "report.json"},
+	}, config.Outputs, "file overrides the defaults")
+	assert.Equal(t, ",", config.CSV.Delimiter, "defaults fill the gaps")
+	assert.Equal(t, []inputConfig{{Filename: "ledger.csv",
+		Columns: map[string]string{"amount": "value"}}}, config.Inputs)
+}
+
+func TestOutputsFlag(t *testing.T) {
+	flags := flag.NewFlagSet("report", flag.ContinueOnError)
+	config, _, err := parseReportConfig(flags, []string{
+		"-outputs", "csv=finance.csv,json=dashboard.json"})
+	require.Nil(t, err, "unexpected error")
+	assert.Equal(t, []gold_sales.OutputTarget{
+		{Format: "csv", Filename: "finance.csv"},
+		{Format: "json", Filename: "dashboard.json"},
+	}, config.Outputs)
+
+	flags = flag.NewFlagSet("report", flag.ContinueOnError)
+	_, _, err = parseReportConfig(flags, []string{
+		"-outputs", "csv=finance.csv", "-outputFormat", "xlsx"})
+	assert.NotNil(t, err, "expected error combining -outputs and -outputFormat")
+
+	flags = flag.NewFlagSet("report", flag.ContinueOnError)
+	_, _, err = parseReportConfig(flags, []string{"-outputs", "output.csv"})
+	assert.NotNil(t, err, "expected error for an output without a format")
+}
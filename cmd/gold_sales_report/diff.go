@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+
+	"github.com/namsral/flag"
+	"github.com/pkg/errors"
+
+	"github.com/JonPulfer/gold_sales/pkg/gold_sales"
+	"github.com/JonPulfer/gold_sales/pkg/gold_sales/service/managers"
+)
+
+// diffCommand compares two reports, either saved as JSON or computed from two
+// ledgers with the same parameters, and prints how the leaderboard changed.
+func diffCommand(args []string) error {
+	flags := flag.NewFlagSet("diff", flag.ExitOnError)
+	var beforeFilename, afterFilename string
+	flags.StringVar(&beforeFilename, "before", "", "Earlier report written by the json or csv output format")
+	flags.StringVar(&afterFilename, "after", "", "Later report written by the json or csv output format")
+	var beforeLedger, afterLedger string
+	flags.StringVar(&beforeLedger, "beforeLedger", "", "Earlier CSV ledger or .jsonl store to compute a report from")
+	flags.StringVar(&afterLedger, "afterLedger", "", "Later CSV ledger or .jsonl store to compute a report from")
+	numOfTopSpenders := 0
+	flags.IntVar(&numOfTopSpenders, "numTopSpenders", 3, "Number of top spenders per month, for ledgers")
+	numOfMonths := 0
+	flags.IntVar(&numOfMonths, "numMonths", 6, "Number of months, for ledgers")
+	var rankBy string
+	flags.StringVar(&rankBy, "rankBy", string(gold_sales.RankByGrams), "Metric to rank spenders by, for ledgers")
+	var netRefunds string
+	flags.StringVar(&netRefunds, "netRefunds", string(gold_sales.NetInRefundMonth),
+		"Month to net refunds in, refund or original, for ledgers")
+	duplicates := duplicatesFlag(flags)
+	tolerance := 0.0
+	flags.Float64Var(&tolerance, "tolerance", 0.005, "Ignore spend changes in grams no larger than this")
+	var outputFormat string
+	flags.StringVar(&outputFormat, "outputFormat", "text", "Diff format, text or json")
+	reportCSV := reportCSVFlags(flags, "")
+	_ = flags.Parse(args)
+
+	if outputFormat != "text" && outputFormat != "json" {
+		return failed(exitUsage, errors.Errorf("unknown diff format %q", outputFormat),
+			"invalid output format")
+	}
+	ranking, err := gold_sales.ParseRankingMetric(rankBy)
+	if err != nil {
+		return failed(exitUsage, err, "invalid ranking metric")
+	}
+	netting, err := gold_sales.ParseRefundNetting(netRefunds)
+	if err != nil {
+		return failed(exitUsage, err, "invalid refund netting")
+	}
+	csvOptions, err := reportConfig{CSV: *reportCSV}.csvOptions()
+	if err != nil {
+		return failed(exitUsage, err, "invalid CSV options")
+	}
+
+	load := func(reportFilename, ledgerFilename string) (*gold_sales.MonthlyTopSpendersAnalysisReport, error) {
+		switch {
+		case reportFilename != "" && ledgerFilename != "":
+			return nil, failed(exitUsage, errors.New("give a report or a ledger, not both"),
+				"invalid diff inputs")
+		case reportFilename != "":
+			return loadReport(reportFilename, csvOptions)
+		case ledgerFilename != "":
+			deduplicated, err := openDeduplicated(ledgerFilename, *duplicates)
+			if err != nil {
+				return nil, err
+			}
+			defer deduplicated.Close()
+			analysisService := managers.NewAnalysisService(deduplicated)
+			analysisService.RankBy(ranking)
+			analysisService.NetRefundsIn(netting)
+			report, err := analysisService.TopSpenders(context.Background(),
+				numOfTopSpenders, numOfMonths)
+			logDuplicates(deduplicated)
+			if err != nil {
+				return nil, ledgerFailed(err, "failed to perform TopSpenders analysis")
+			}
+			return report, nil
+		}
+		return nil, failed(exitUsage, errors.New("a report or ledger is required for each side"),
+			"invalid diff inputs")
+	}
+
+	before, err := load(beforeFilename, beforeLedger)
+	if err != nil {
+		return err
+	}
+	after, err := load(afterFilename, afterLedger)
+	if err != nil {
+		return err
+	}
+
+	diff := gold_sales.DiffReports(before, after, gold_sales.TotalSpend(tolerance))
+	if outputFormat == "json" {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(diff)
+	}
+	return diff.WriteText(os.Stdout)
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"os"
+
+	"github.com/pkg/errors"
+
+	"github.com/JonPulfer/gold_sales/pkg/gold_sales/infrastructure/repository"
+)
+
+// Exit codes so a scheduler can tell which stage of a run failed.
+const (
+	exitOK         = 0
+	exitUsage      = 2
+	exitInput      = 3
+	exitValidation = 4
+	exitAnalysis   = 5
+	exitOutput     = 6
+)
+
+// commandError from a command, carrying the exit code for the stage that
+// failed.
+type commandError struct {
+	code    int
+	message string
+	err     error
+}
+
+func (ce commandError) Error() string {
+	if ce.err == nil {
+		return ce.message
+	}
+	return ce.message + ": " + ce.err.Error()
+}
+
+func failed(code int, err error, message string) error {
+	return commandError{code: code, message: message, err: err}
+}
+
+// ledgerFailed separates ledgers that could not be read from ledgers whose
+// contents are invalid. Anything else went wrong in the analysis.
+func ledgerFailed(err error, message string) error {
+	switch errors.Cause(err).(type) {
+	case repository.LedgerRepositoryError, *csv.ParseError,
+		*json.SyntaxError, *json.UnmarshalTypeError:
+		return failed(exitValidation, err, message)
+	case *os.PathError, *os.SyscallError:
+		return failed(exitInput, err, message)
+	}
+	return failed(exitAnalysis, err, message)
+}
+
+// exitCode for the error returned by a command.
+func exitCode(err error) int {
+	if err == nil {
+		return exitOK
+	}
+	if ce, ok := err.(commandError); ok {
+		return ce.code
+	}
+	return exitAnalysis
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/JonPulfer/gold_sales/pkg/gold_sales/infrastructure/repository"
+)
+
+func TestExitCode(t *testing.T) {
+	_, pathErr := os.Open(filepath.Join(os.TempDir(), "no-such-ledger.csv"))
+	require.Error(t, pathErr)
+	var syntaxErr error = &json.SyntaxError{}
+
+	testCases := []struct {
+		Name         string
+		Err          error
+		ExpectedCode int
+	}{
+		{"Success", nil, exitOK},
+		{"Usage", failed(exitUsage, errors.New("unknown format"), "invalid output format"), exitUsage},
+		{"Missing ledger", ledgerFailed(errors.Wrap(pathErr, "failed to open"), "failed"), exitInput},
+		{"Invalid row", ledgerFailed(errors.Wrap(repository.LedgerRepositoryError{
+			Reason: repository.RejectedAmount}, "failed to fetch"), "failed"), exitValidation},
+		{"Duplicate payments", ledgerFailed(repository.LedgerRepositoryError{
+			Reason: repository.RejectedDuplicate}, "failed"), exitValidation},
+		{"Malformed CSV", ledgerFailed(errors.Wrap(&csv.ParseError{Line: 3}, "failed to read"), "failed"), exitValidation},
+		{"Malformed JSON", ledgerFailed(errors.WithMessage(syntaxErr, "failed to read"), "failed"), exitValidation},
+		{"Analysis", ledgerFailed(errors.New("no months"), "failed"), exitAnalysis},
+		{"Output", failed(exitOutput, errors.New("disk full"), "failed to write report"), exitOutput},
+		{"Not a command error", errors.New("unexpected"), exitAnalysis},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			assert.Equal(t, tc.ExpectedCode, exitCode(tc.Err))
+		})
+	}
+}
+
+func TestCommandExitCodes(t *testing.T) {
+	dir, err := ioutil.TempDir("", "exit")
+	require.Nil(t, err)
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	headerOnly := filepath.Join(dir, "header-only.csv")
+	require.Nil(t, ioutil.WriteFile(headerOnly, []byte("first_name,last_name\n"), 0644))
+	ledger := filepath.Join(dir, "ledger.csv")
+	require.Nil(t, ioutil.WriteFile(ledger, []byte(
+		"first_name,last_name,email,description,merchant_code,amount,from_currency,to_currency,rate,date\n"+
+			"Alayna,Sparks,alayna.sparks@mailinator.com,CARD SPEND,5311,2629.16,GBP,GGM,47.0892,22/03/2020 13:28\n"), 0644))
+
+	testCases := []struct {
+		Name         string
+		Args         []string
+		ExpectedCode int
+	}{
+		{"Unknown format", []string{"-inputFilename", ledger, "-outputFormat", "pdf"}, exitUsage},
+		{"Missing ledger", []string{"-inputFilename", filepath.Join(dir, "missing.csv")}, exitInput},
+		{"Missing headers", []string{"-inputFilename", headerOnly}, exitValidation},
+		{"Unwritable output", []string{"-inputFilename", ledger,
+			"-outputFilename", filepath.Join(dir, "missing", "quality.json")}, exitOutput},
+		{"Written", []string{"-inputFilename", ledger,
+			"-outputFilename", filepath.Join(dir, "quality.json")}, exitOK},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			assert.Equal(t, tc.ExpectedCode, exitCode(qualityCommand(tc.Args)))
+		})
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+
+	"github.com/namsral/flag"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+
+	"github.com/JonPulfer/gold_sales/pkg/gold_sales/infrastructure/repository"
+	"github.com/JonPulfer/gold_sales/pkg/gold_sales/infrastructure/tracing"
+)
+
+// importCommand loads the gold spends in a CSV ledger into a store that
+// report and statements can then read with -inputFilename. Stores ending
+// .events are event logs, which every transaction is appended to as an event.
+func importCommand(args []string) error {
+	flags := flag.NewFlagSet("import", flag.ExitOnError)
+	var inputFilename string
+	flags.StringVar(&inputFilename, "inputFilename", "sample-transactions.csv", "CSV File to import")
+	var storeFilename string
+	flags.StringVar(&storeFilename, "storeFilename", "ledger.jsonl", "Store to load the payments into, an event log when it ends .events")
+	var replace bool
+	flags.BoolVar(&replace, "replace", false, "Replace the contents of the store rather than appending")
+	var traceFilename string
+	flags.StringVar(&traceFilename, "traceFilename", "", "File to write trace spans to as JSON lines, - for stdout")
+	_ = flags.Parse(args)
+
+	ctx, closeTrace := tracingContext(traceFilename)
+	defer closeTrace()
+	runSpan, ctx := tracing.StartSpanFromContext(ctx, "gold_sales_report.import")
+	defer runSpan.Finish()
+
+	source, err := repository.NewCSVLedgerRepository(inputFilename)
+	if err != nil {
+		return failed(exitInput, err, "failed to create ledger repository")
+	}
+	defer source.Close()
+	if isEventLog(storeFilename) {
+		if replace {
+			return failed(exitUsage, errors.New("an event log is append only and cannot be replaced"),
+				"invalid import")
+		}
+		return importEvents(ctx, source, storeFilename)
+	}
+	payments, err := source.FetchAll(ctx)
+	if err != nil {
+		return ledgerFailed(err, "failed to read ledger")
+	}
+
+	var store repository.LedgerStore = repository.NewJSONLedgerRepository(storeFilename)
+	if replace {
+		if err := store.Truncate(ctx); err != nil {
+			return failed(exitOutput, err, "failed to clear store")
+		}
+	}
+	if err := store.Store(ctx, payments); err != nil {
+		return failed(exitOutput, err, "failed to store payments")
+	}
+	log.Info().Int("payments", len(payments)).Str("store", storeFilename).
+		Msg("ledger imported")
+
+	return nil
+}
+
+// importEvents appends every transaction in the ledger to the event log.
+func importEvents(
+	ctx context.Context,
+	source *repository.CSVLedgerRepository,
+	eventLogFilename string,
+) error {
+	transactions, err := source.FetchTransactions(ctx)
+	if err != nil {
+		return ledgerFailed(err, "failed to read ledger")
+	}
+	events, err := repository.NewEventLog(eventLogFilename).AppendTransactions(ctx, transactions)
+	if err != nil {
+		return failed(exitOutput, err, "failed to append to event log")
+	}
+	log.Info().Int("events", len(events)).Str("eventLog", eventLogFilename).
+		Msg("ledger imported")
+	return nil
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"text/tabwriter"
+
+	"github.com/namsral/flag"
+)
+
+// inspectCommand prints the row counts of a ledger by description, currency
+// pair and month.
+func inspectCommand(args []string) error {
+	flags := flag.NewFlagSet("inspect", flag.ExitOnError)
+	var inputFilename string
+	flags.StringVar(&inputFilename, "inputFilename", "sample-transactions.csv", "CSV File to inspect")
+	_ = flags.Parse(args)
+
+	summary, err := summariseLedger(inputFilename)
+	if err != nil {
+		return err
+	}
+
+	out := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(out, "Rows:\t%d\t\n", summary.Rows)
+	fmt.Fprintf(out, "Rows with errors:\t%d\t\n", len(summary.RowErrors))
+
+	fmt.Fprintln(out, "\nDescription\tRows\t")
+	writeCounts(out, summary.ByDescription)
+
+	fmt.Fprintln(out, "\nFrom/To currency\tRows\t")
+	writeCounts(out, summary.ByCurrencyPair)
+
+	fmt.Fprintln(out, "\nMonth\tRows\t")
+	for _, month := range summary.Months() {
+		fmt.Fprintf(out, "%s\t%d\t\n", month, summary.ByMonth[month])
+	}
+	return out.Flush()
+}
+
+func writeCounts(out io.Writer, counts map[string]int) {
+	keys := make([]string, 0, len(counts))
+	for key := range counts {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		fmt.Fprintf(out, "%s\t%d\t\n", key, counts[key])
+	}
+}
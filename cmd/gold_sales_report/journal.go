@@ -0,0 +1,164 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/namsral/flag"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+
+	"github.com/JonPulfer/gold_sales/pkg/gold_sales"
+	"github.com/JonPulfer/gold_sales/pkg/gold_sales/infrastructure/repository"
+)
+
+// journalDateLayout matches the dates in the CSV ledgers.
+const journalDateLayout = "02/01/2006 15:04"
+
+// journalCommand lists the events in an event log or the gold balances
+// projected from it, or appends a correction or reversal of an earlier
+// transaction to it.
+func journalCommand(args []string) error {
+	flags := flag.NewFlagSet("journal", flag.ExitOnError)
+	var eventLogFilename string
+	flags.StringVar(&eventLogFilename, "eventLogFilename", "ledger.events", "Event log to read or append to")
+	var reverse, correct uint64
+	flags.Uint64Var(&reverse, "reverse", 0, "Sequence of the transaction to reverse")
+	flags.Uint64Var(&correct, "correct", 0, "Sequence of the transaction to correct with -amount, -rate or -date")
+	var amount, rate float64
+	flags.Float64Var(&amount, "amount", 0, "Corrected amount")
+	flags.Float64Var(&rate, "rate", 0, "Corrected rate")
+	var date string
+	flags.StringVar(&date, "date", "", "Corrected date, as dd/mm/yyyy hh:mm")
+	var reason string
+	flags.StringVar(&reason, "reason", "", "Why the transaction is being corrected or reversed")
+	var balances bool
+	flags.BoolVar(&balances, "balances", false, "List the grams of gold each customer holds")
+	_ = flags.Parse(args)
+
+	ctx := context.Background()
+	eventLog := repository.NewEventLog(eventLogFilename)
+	if balances && (reverse != 0 || correct != 0) {
+		return failed(exitUsage, errors.New("-balances cannot be combined with -reverse or -correct"),
+			"invalid journal entry")
+	}
+	if balances {
+		return listBalances(ctx, eventLog)
+	}
+	if reverse == 0 && correct == 0 {
+		return listEvents(ctx, eventLog)
+	}
+	if reverse != 0 && correct != 0 {
+		return failed(exitUsage, errors.New("-reverse cannot be combined with -correct"),
+			"invalid journal entry")
+	}
+	if reason == "" {
+		return failed(exitUsage, errors.New("-reason is required"), "invalid journal entry")
+	}
+
+	event := gold_sales.NewReversalEvent(reverse, reason)
+	if correct != 0 {
+		events, err := eventLog.Events(ctx)
+		if err != nil {
+			return ledgerFailed(err, "failed to read event log")
+		}
+		transaction, ok := standingTransaction(events, correct)
+		if !ok {
+			return failed(exitUsage, errors.Errorf("event %d is not a transaction", correct),
+				"invalid journal entry")
+		}
+		var dateErr error
+		flags.Visit(func(f *flag.Flag) {
+			switch f.Name {
+			case "amount":
+				transaction.Amount = amount
+			case "rate":
+				transaction.Rate = rate
+			case "date":
+				transaction.Date, dateErr = time.Parse(journalDateLayout, date)
+			}
+		})
+		if dateErr != nil {
+			return failed(exitUsage, dateErr, "invalid corrected date")
+		}
+		if transaction.Rate != 0 {
+			transaction.GramWeight = transaction.Amount / transaction.Rate
+		}
+		event = gold_sales.NewCorrectionEvent(correct, transaction, reason)
+	}
+
+	appended, err := eventLog.Append(ctx, event)
+	if err != nil {
+		return failed(exitOutput, err, "failed to append to event log")
+	}
+	log.Info().Uint64("sequence", appended[0].Sequence).Str("type", string(event.Type)).
+		Uint64("target", event.Target).Msg("event appended")
+	return nil
+}
+
+// standingTransaction recorded by the target event, as last corrected.
+func standingTransaction(
+	events []gold_sales.LedgerEvent,
+	target uint64,
+) (gold_sales.GoldPayment, bool) {
+	var transaction *gold_sales.GoldPayment
+	for _, event := range events {
+		switch {
+		case event.Sequence == target && event.Type != gold_sales.EventCorrection &&
+			event.Type != gold_sales.EventReversal:
+			transaction = event.Transaction
+		case event.Target == target && transaction != nil:
+			transaction = event.Transaction
+		}
+	}
+	if transaction == nil {
+		return gold_sales.GoldPayment{}, false
+	}
+	return *transaction, true
+}
+
+// listEvents in the log once it has been verified.
+func listEvents(ctx context.Context, eventLog *repository.EventLog) error {
+	events, err := eventLog.Events(ctx)
+	if err != nil {
+		return ledgerFailed(err, "failed to read event log")
+	}
+
+	out := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(out, "Sequence\tType\tTarget\tEmail\tDescription\tAmount\tDate\tReason\t")
+	for _, event := range events {
+		target := ""
+		if event.Target != 0 {
+			target = fmt.Sprint(event.Target)
+		}
+		email, description, amount, date := "", "", "", ""
+		if event.Transaction != nil {
+			email = event.Transaction.Spender.Email
+			description = event.Transaction.Description
+			amount = fmt.Sprintf("%.2f", event.Transaction.Amount)
+			date = event.Transaction.Date.Format(journalDateLayout)
+		}
+		fmt.Fprintf(out, "%d\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t\n", event.Sequence, event.Type,
+			target, email, description, amount, date, event.Reason)
+	}
+	return out.Flush()
+}
+
+// listBalances of gold projected from the transactions standing in the log.
+func listBalances(ctx context.Context, eventLog *repository.EventLog) error {
+	balances, err := eventLog.Balances(ctx)
+	if err != nil {
+		return ledgerFailed(err, "failed to read event log")
+	}
+
+	out := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(out, "Email\tFirst name\tLast name\tGrams\tTransactions\t")
+	for _, balance := range balances {
+		fmt.Fprintf(out, "%s\t%s\t%s\t%.4f\t%d\t\n", balance.Spender.Email,
+			balance.Spender.FirstName, balance.Spender.LastName, balance.Grams, balance.Transactions)
+	}
+	return out.Flush()
+}
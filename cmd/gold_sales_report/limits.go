@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+
+	"github.com/namsral/flag"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+
+	"github.com/JonPulfer/gold_sales/pkg/gold_sales"
+	"github.com/JonPulfer/gold_sales/pkg/gold_sales/service/managers"
+)
+
+// limitsCommand checks the spending of every customer against the limits set
+// by compliance in the config file.
+func limitsCommand(args []string) error {
+	flags := flag.NewFlagSet("limits", flag.ExitOnError)
+	var configFilename string
+	flags.StringVar(&configFilename, "configFilename", "", "JSON config file with the limits to check")
+	var inputFilename string
+	flags.StringVar(&inputFilename, "inputFilename", "sample-transactions.csv", "CSV ledger, .jsonl store or .events log to read from")
+	var outputFormat string
+	flags.StringVar(&outputFormat, "outputFormat", "json", "Limits report format, json or csv")
+	var outputFilename string
+	flags.StringVar(&outputFilename, "outputFilename", "-", "File to write the limits report to, - for stdout")
+	duplicates := duplicatesFlag(flags)
+	var strict bool
+	flags.BoolVar(&strict, "strict", false, "Exit non-zero when any limit is breached")
+	_ = flags.Parse(args)
+
+	if outputFormat != "json" && outputFormat != "csv" {
+		return failed(exitUsage, errors.Errorf("unknown limits format %q", outputFormat),
+			"invalid output format")
+	}
+	if configFilename == "" {
+		return failed(exitUsage, errors.New("-configFilename is required"),
+			"no limits configured")
+	}
+	config, err := loadConfigFile(configFilename)
+	if err != nil {
+		return failed(exitUsage, err, "failed to load config file")
+	}
+	if len(config.Limits) == 0 {
+		return failed(exitUsage, errors.Errorf("%s has no limits", configFilename),
+			"no limits configured")
+	}
+	if _, err := gold_sales.NewLimitChecker(config.Limits); err != nil {
+		return failed(exitUsage, err, "invalid limits")
+	}
+
+	deduplicated, err := openDeduplicated(inputFilename, *duplicates)
+	if err != nil {
+		return err
+	}
+	defer deduplicated.Close()
+	report, err := managers.NewAnalysisService(deduplicated).LimitBreaches(context.Background(), config.Limits)
+	logDuplicates(deduplicated)
+	if err != nil {
+		return ledgerFailed(err, "failed to check limits")
+	}
+
+	write := report.WriteJSON
+	if outputFormat == "csv" {
+		write = report.WriteCSV
+	}
+	if err := writeOutput(outputFilename, write); err != nil {
+		return failed(exitOutput, err, "failed to write limits report")
+	}
+	log.Info().Int("breaches", len(report.Breaches)).Msg("limits report written")
+
+	if strict && len(report.Breaches) > 0 {
+		return failed(exitValidation, nil, "customers have breached their limits")
+	}
+	return nil
+}
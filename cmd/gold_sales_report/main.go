@@ -1,42 +1,224 @@
 package main
 
 import (
+	"context"
+	"fmt"
 	"io"
+	"net/http"
 	"os"
+	"path/filepath"
+	"strings"
 
 	"github.com/namsral/flag"
 	"github.com/rs/zerolog/log"
 
+	"github.com/JonPulfer/gold_sales/pkg/gold_sales"
+	"github.com/JonPulfer/gold_sales/pkg/gold_sales/infrastructure/filesystem"
+	"github.com/JonPulfer/gold_sales/pkg/gold_sales/infrastructure/metrics"
 	"github.com/JonPulfer/gold_sales/pkg/gold_sales/infrastructure/repository"
-	"github.com/JonPulfer/gold_sales/pkg/gold_sales/service/managers"
+	"github.com/JonPulfer/gold_sales/pkg/gold_sales/infrastructure/tracing"
 )
 
+// command that can be selected by the first argument.
+type command struct {
+	run         func(args []string) error
+	description string
+}
+
+// commands available in gold_sales_report. Running with only flags runs
+// report, as the binary did before it had commands.
+var commands = map[string]command{
+	"report":     {reportCommand, "Produce the monthly top spenders report"},
+	"statements": {statementsCommand, "Produce a gold spend statement per customer"},
+	"validate":   {validateCommand, "Check a ledger and print a data quality summary"},
+	"inspect":    {inspectCommand, "Show row counts by description, currency pair and month"},
+	"quality":    {qualityCommand, "Write a data quality report of a ledger as JSON or HTML"},
+	"import":     {importCommand, "Load the gold spends in a ledger into a store"},
+	"diff":       {diffCommand, "Show how the top spenders changed between two reports"},
+	"render":     {renderCommand, "Render a saved report to other output formats"},
+	"watch":      {watchCommand, "Run the report each time ledgers land in a directory"},
+	"journal":    {journalCommand, "List, correct or reverse the events in an event log"},
+	"alerts":     {alertsCommand, "Flag customers whose spending is unusual for them"},
+	"limits":     {limitsCommand, "Check customers' spending against compliance limits"},
+	"cohorts":    {cohortsCommand, "Show the retention of customers by the month of their first gold payment"},
+}
+
 func main() {
+	args := os.Args[1:]
+	name := "report"
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		name, args = args[0], args[1:]
+	}
+
+	cmd, ok := commands[name]
+	if !ok {
+		usage()
+		if name != "help" {
+			os.Exit(exitUsage)
+		}
+		return
+	}
+	if err := cmd.run(args); err != nil {
+		code := exitCode(err)
+		log.Error().Err(err).Str("command", name).Int("exitCode", code).
+			Msg("gold_sales_report failed")
+		os.Exit(code)
+	}
+}
 
-	numOfTopSpenders := 0
-	flag.IntVar(&numOfTopSpenders, "numTopSpenders", 3, "Number of top spenders per month")
-	numOfMonths := 6
-	flag.IntVar(&numOfMonths, "numMonths", 6, "Number of months")
-	var inputFilename string
-	flag.StringVar(&inputFilename, "inputFilename", "sample-transactions.csv", "CSV File to read from")
-	var outputFilename string
-	flag.StringVar(&outputFilename, "outputFilename", "output.csv", "Output filename")
-	flag.Parse()
+func usage() {
+	fmt.Fprintf(os.Stderr, "Usage: %s <command> [flags]\n\nCommands:\n",
+		filepath.Base(os.Args[0]))
+	names := []string{"report", "statements", "validate", "inspect", "quality", "import", "diff", "render", "watch", "journal", "alerts", "limits", "cohorts"}
+	for _, name := range names {
+		fmt.Fprintf(os.Stderr, "  %-11s %s\n", name, commands[name].description)
+	}
+	fmt.Fprintf(os.Stderr, "\nRun '%s <command> -h' for the flags of a command.\n",
+		filepath.Base(os.Args[0]))
+}
 
+// openLedgerRepository for the input file. Files ending .jsonl are stores
+// written by import, files ending .events are event logs and anything else is
+// read as a CSV ledger. CSV ledgers record their ingestion in the metrics when
+// they are given.
+func openLedgerRepository(
+	inputFilename string,
+	ledgerMetrics *repository.LedgerMetrics,
+) (repository.LedgerRepository, error) {
+	if isLedgerStore(inputFilename) {
+		return repository.NewJSONLedgerRepository(inputFilename), nil
+	}
+	if isEventLog(inputFilename) {
+		return repository.NewEventLog(inputFilename), nil
+	}
 	repos, err := repository.NewCSVLedgerRepository(inputFilename)
 	if err != nil {
-		log.Error().Err(err).Msg("failed to create ledger repository")
+		return nil, err
+	}
+	if ledgerMetrics != nil {
+		repos.InstrumentWith(ledgerMetrics)
 	}
+	return repos, nil
+}
 
-	analysisService := managers.NewAnalysisService(repos)
+// duplicatesFlag for the policy applied to payments found more than once.
+func duplicatesFlag(flags *flag.FlagSet) *string {
+	return flags.String("duplicates", string(repository.WarnDuplicates),
+		"What to do with payments found more than once, warn to keep them, drop or fail")
+}
 
-	report, err := analysisService.TopSpenders(numOfTopSpenders, numOfMonths)
+// openDeduplicated ledger repository of the input, applying the named
+// duplicate policy. An unknown policy is a usage error and a ledger that
+// cannot be opened an input error.
+func openDeduplicated(
+	inputFilename string,
+	duplicates string,
+) (*repository.DeduplicatedLedgerRepository, error) {
+	policy, err := repository.ParseDuplicatePolicy(duplicates)
+	if err != nil {
+		return nil, failed(exitUsage, err, "invalid duplicate policy")
+	}
+	repos, err := openLedgerRepository(inputFilename, nil)
 	if err != nil {
-		log.Error().Err(err).Msg("failed to perform TopSpenders analysis")
+		return nil, failed(exitInput, err, "failed to create ledger repository")
 	}
+	return repository.NewDeduplicatedLedgerRepository(repos, policy), nil
+}
 
-	outputFile, err := os.Create(outputFilename)
-	if _, err := io.Copy(outputFile, report.FormattedAsCSV()); err != nil {
-		log.Error().Err(err).Msg("failed to write output")
+// logDuplicates found by the last fetch from the repository, listing the
+// first few.
+func logDuplicates(repos *repository.DeduplicatedLedgerRepository) {
+	duplicates := repos.Duplicates()
+	for i, duplicate := range duplicates {
+		if i == maxDuplicatesLogged {
+			log.Warn().Int("more", len(duplicates)-maxDuplicatesLogged).
+				Msg("more duplicate payments found")
+			return
+		}
+		log.Warn().Str("id", duplicate.ID).Int("count", duplicate.Count).
+			Str("email", duplicate.Payment.Spender.Email).
+			Time("date", duplicate.Payment.Date).
+			Float64("amount", duplicate.Payment.Amount).
+			Str("policy", string(repos.Policy())).
+			Msg("duplicate payment found")
 	}
 }
+
+const maxDuplicatesLogged = 20
+
+// loadReport previously written by the json or csv output format, chosen by
+// the file extension. CSV reports are read in the dialect of the options, by
+// their header row if they have one or as the columns the options select.
+func loadReport(
+	filename string,
+	csvOptions gold_sales.CSVOptions,
+) (*gold_sales.MonthlyTopSpendersAnalysisReport, error) {
+	format := strings.ToLower(strings.TrimPrefix(filepath.Ext(filename), "."))
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, failed(exitInput, err, "failed to open report")
+	}
+	defer file.Close()
+
+	report, err := gold_sales.ReadReport(file, format, csvOptions)
+	if err != nil {
+		return nil, failed(exitValidation, err, "failed to load report "+filename)
+	}
+	return report, nil
+}
+
+func isLedgerStore(filename string) bool {
+	return strings.EqualFold(filepath.Ext(filename), ".jsonl")
+}
+
+func isEventLog(filename string) bool {
+	return strings.EqualFold(filepath.Ext(filename), ".events")
+}
+
+// tracingContext that exports spans to the trace file, if one is requested.
+// The returned func closes the trace file once the run is complete.
+func tracingContext(traceFilename string) (context.Context, func()) {
+	ctx := context.Background()
+	switch traceFilename {
+	case "":
+		return ctx, func() {}
+	case "-":
+		return tracing.ContextWithTracer(ctx, tracing.NewWriterTracer(os.Stdout)), func() {}
+	}
+
+	traceFile, err := os.Create(traceFilename)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to create trace file, tracing disabled")
+		return ctx, func() {}
+	}
+	return tracing.ContextWithTracer(ctx, tracing.NewWriterTracer(traceFile)),
+		func() { traceFile.Close() }
+}
+
+// writeOutput to the file, replacing it atomically, or to stdout when the
+// filename is -.
+func writeOutput(filename string, write func(io.Writer) error) error {
+	if filename == "-" {
+		return write(os.Stdout)
+	}
+	return filesystem.WriteAtomically(filename, write)
+}
+
+// writeMetrics to the file once a run has finished. Failing to write metrics
+// does not fail the run.
+func writeMetrics(filename string, registry *metrics.Registry) {
+	if err := registry.WriteFile(filename); err != nil {
+		log.Error().Err(err).Msg("failed to write metrics")
+	}
+}
+
+// serveMetrics from the Registry on the address for the life of the process.
+func serveMetrics(addr string, registry *metrics.Registry) {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", registry.Handler())
+	go func() {
+		if err := http.ListenAndServe(addr, mux); err != nil {
+			log.Error().Err(err).Str("addr", addr).Msg("metrics endpoint stopped")
+		}
+	}()
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+
+	"github.com/namsral/flag"
+	"github.com/pkg/errors"
+
+	"github.com/JonPulfer/gold_sales/pkg/gold_sales/infrastructure/repository"
+)
+
+// qualityCommand profiles a ledger and writes a data quality report as JSON
+// or HTML, so the ledger can be checked before a report made from it is
+// trusted.
+func qualityCommand(args []string) error {
+	flags := flag.NewFlagSet("quality", flag.ExitOnError)
+	var inputFilename string
+	flags.StringVar(&inputFilename, "inputFilename", "sample-transactions.csv", "CSV File to profile")
+	var outputFormat string
+	flags.StringVar(&outputFormat, "outputFormat", "json", "Data quality report format, json or html")
+	var outputFilename string
+	flags.StringVar(&outputFilename, "outputFilename", "-", "File to write the data quality report to, - for stdout")
+	options := repository.DefaultDataQualityOptions()
+	maxRateChange := 0.0
+	flags.Float64Var(&maxRateChange, "maxRateChange", options.MaxRateChange*100,
+		"Largest day to day change in percent in the average rate of a currency pair")
+	var strict bool
+	flags.BoolVar(&strict, "strict", false, "Exit non-zero when any issue is found")
+	_ = flags.Parse(args)
+
+	if outputFormat != "json" && outputFormat != "html" {
+		return failed(exitUsage, errors.Errorf("unknown data quality format %q", outputFormat),
+			"invalid output format")
+	}
+	if maxRateChange < 0 {
+		return failed(exitUsage, errors.New("-maxRateChange cannot be negative"),
+			"invalid rate change")
+	}
+	options.MaxRateChange = maxRateChange / 100
+
+	repos, err := repository.NewCSVLedgerRepository(inputFilename)
+	if err != nil {
+		return failed(exitInput, err, "failed to create ledger repository")
+	}
+	defer repos.Close()
+	report, err := repos.Profile(context.Background(), options)
+	if err != nil {
+		return ledgerFailed(err, "failed to profile ledger")
+	}
+
+	write := report.WriteJSON
+	if outputFormat == "html" {
+		write = report.WriteHTML
+	}
+	if err := writeOutput(outputFilename, write); err != nil {
+		return failed(exitOutput, err, "failed to write data quality report")
+	}
+
+	if strict && report.Issues() > 0 {
+		return failed(exitValidation, nil,
+			"the ledger has data quality issues")
+	}
+	return nil
+}
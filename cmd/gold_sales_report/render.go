@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+
+	"github.com/namsral/flag"
+	"github.com/pkg/errors"
+
+	"github.com/JonPulfer/gold_sales/pkg/gold_sales/infrastructure/filesystem"
+	"github.com/JonPulfer/gold_sales/pkg/gold_sales/service/managers"
+)
+
+// renderCommand loads a report saved by an earlier run and renders it to
+// other formats without going back to the ledger.
+func renderCommand(args []string) error {
+	flags := flag.NewFlagSet("render", flag.ExitOnError)
+	var inputFilename string
+	flags.StringVar(&inputFilename, "inputFilename", "", "Report written by the json or csv output format")
+	config := reportConfig{CSV: csvConfig{Delimiter: ","}}
+	flags.Var(outputsFlag{&config}, "outputs",
+		"Outputs to render the report to as format=filename pairs separated by commas, e.g. html=report.html")
+	flags.StringVar(&config.ManifestFilename, "manifestFilename", "", "File to write a JSON manifest of the outputs and their SHA-256 checksums to")
+	flags.BoolVar(&config.CSV.Header, "csvHeader", false, "Write a header row in CSV output")
+	flags.BoolVar(&config.CSV.Rank, "csvRank", false, "Include the rank column in CSV output")
+	flags.BoolVar(&config.CSV.Email, "csvEmail", false, "Include the email column in CSV output")
+	flags.StringVar(&config.TemplateFilename, "templateFilename", "", "Go template to render the report with, selected by format template")
+	inputCSV := reportCSVFlags(flags, "input")
+	_ = flags.Parse(args)
+
+	if inputFilename == "" {
+		return failed(exitUsage, errors.New("-inputFilename is required"), "no report to render")
+	}
+	if len(config.Outputs) == 0 {
+		return failed(exitUsage, errors.New("-outputs is required"), "no outputs to render to")
+	}
+	csvOptions, err := config.csvOptions()
+	if err != nil {
+		return failed(exitUsage, err, "invalid CSV options")
+	}
+	inputCSVOptions, err := reportConfig{CSV: *inputCSV}.csvOptions()
+	if err != nil {
+		return failed(exitUsage, err, "invalid input CSV options")
+	}
+	renderers, err := reportRenderers(csvOptions, config.TemplateFilename)
+	if err != nil {
+		return failed(exitUsage, err, "failed to set up report renderers")
+	}
+	for _, output := range config.Outputs {
+		if _, err := renderers.Lookup(output.Format); err != nil {
+			return failed(exitUsage, err, "unknown output format")
+		}
+	}
+
+	report, err := loadReport(inputFilename, inputCSVOptions)
+	if err != nil {
+		return err
+	}
+
+	manifest, err := managers.RenderTo(context.Background(), report, renderers, config.Outputs)
+	if err != nil {
+		return failed(exitOutput, err, "failed to write output")
+	}
+	if config.ManifestFilename == "" {
+		return nil
+	}
+	err = filesystem.WriteAtomically(config.ManifestFilename, func(w io.Writer) error {
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(manifest)
+	})
+	if err != nil {
+		return failed(exitOutput, err, "failed to write manifest")
+	}
+	return nil
+}
@@ -0,0 +1,343 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+
+	"github.com/namsral/flag"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+
+	"github.com/JonPulfer/gold_sales/pkg/gold_sales"
+	"github.com/JonPulfer/gold_sales/pkg/gold_sales/infrastructure/filesystem"
+	"github.com/JonPulfer/gold_sales/pkg/gold_sales/infrastructure/metrics"
+	"github.com/JonPulfer/gold_sales/pkg/gold_sales/infrastructure/repository"
+	"github.com/JonPulfer/gold_sales/pkg/gold_sales/infrastructure/snapshot"
+	"github.com/JonPulfer/gold_sales/pkg/gold_sales/infrastructure/tracing"
+	"github.com/JonPulfer/gold_sales/pkg/gold_sales/service/managers"
+)
+
+// reportCommand produces the monthly top spenders report.
+func reportCommand(args []string) error {
+	flags := flag.NewFlagSet("report", flag.ExitOnError)
+	config, printConfig, err := parseReportConfig(flags, args)
+	if err != nil {
+		return failed(exitUsage, err, "failed to load config")
+	}
+	if printConfig {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(config)
+	}
+	if len(config.Inputs) == 0 {
+		return failed(exitUsage, errors.New("no inputs configured"), "invalid inputs")
+	}
+
+	runner, err := newReportRunner(config)
+	if err != nil {
+		return err
+	}
+	if config.MetricsAddr != "" {
+		serveMetrics(config.MetricsAddr, runner.registry)
+	}
+	if config.MetricsFilename != "" {
+		defer writeMetrics(config.MetricsFilename, runner.registry)
+	}
+
+	ctx, closeTrace := tracingContext(config.TraceFilename)
+	defer closeTrace()
+	return runner.run(ctx, config.Inputs)
+}
+
+// reportRunner runs the report for a config. It holds what lasts between runs,
+// so watch can run the report again each time the ledgers change.
+type reportRunner struct {
+	config          reportConfig
+	ranking         gold_sales.RankingMetric
+	netting         gold_sales.RefundNetting
+	duplicates      repository.DuplicatePolicy
+	rules           *gold_sales.RuleRegistry
+	renderers       *gold_sales.RendererRegistry
+	registry        *metrics.Registry
+	ledgerMetrics   *repository.LedgerMetrics
+	analysisMetrics *managers.AnalysisMetrics
+	reportSize      *metrics.Histogram
+}
+
+// newReportRunner for the config, failing with a usage error if the config
+// cannot be run.
+func newReportRunner(config reportConfig) (*reportRunner, error) {
+	ranking, err := gold_sales.ParseRankingMetric(config.RankBy)
+	if err != nil {
+		return nil, failed(exitUsage, err, "invalid ranking metric")
+	}
+	netting, err := gold_sales.ParseRefundNetting(config.NetRefunds)
+	if err != nil {
+		return nil, failed(exitUsage, err, "invalid refund netting")
+	}
+	if netting == gold_sales.NetInOriginalMonth && config.StateFilename != "" {
+		return nil, failed(exitUsage,
+			errors.New("-netRefunds original cannot be combined with -stateFilename"),
+			"invalid refund netting")
+	}
+	duplicates, err := repository.ParseDuplicatePolicy(config.Duplicates)
+	if err != nil {
+		return nil, failed(exitUsage, err, "invalid duplicate policy")
+	}
+	if duplicates != repository.WarnDuplicates && config.StateFilename != "" {
+		return nil, failed(exitUsage,
+			errors.Errorf("-duplicates %s cannot be combined with -stateFilename", duplicates),
+			"invalid duplicate policy")
+	}
+	rules := gold_sales.NewRuleRegistry()
+	if _, err := rules.Build(config.Rules); err != nil {
+		return nil, failed(exitUsage, err, "invalid rules")
+	}
+	for _, input := range config.Inputs {
+		if _, err := rules.Build(input.Rules); err != nil {
+			return nil, failed(exitUsage, err, "invalid rules for "+input.Filename)
+		}
+		if len(config.inputRules(input)) > 0 && config.StateFilename != "" {
+			return nil, failed(exitUsage,
+				errors.New("rules cannot be combined with -stateFilename"), "invalid rules")
+		}
+	}
+	csvOptions, err := config.csvOptions()
+	if err != nil {
+		return nil, failed(exitUsage, err, "invalid CSV delimiter")
+	}
+	renderers, err := reportRenderers(csvOptions, config.TemplateFilename)
+	if err != nil {
+		return nil, failed(exitUsage, err, "failed to set up report renderers")
+	}
+	if len(config.Outputs) == 0 {
+		return nil, failed(exitUsage, errors.New("no outputs configured"), "invalid outputs")
+	}
+	for _, output := range config.Outputs {
+		if _, err := renderers.Lookup(output.Format); err != nil {
+			return nil, failed(exitUsage, err, "unknown output format")
+		}
+	}
+
+	registry := metrics.NewRegistry()
+	return &reportRunner{
+		config:          config,
+		ranking:         ranking,
+		netting:         netting,
+		duplicates:      duplicates,
+		rules:           rules,
+		renderers:       renderers,
+		registry:        registry,
+		ledgerMetrics:   repository.NewLedgerMetrics(registry),
+		analysisMetrics: managers.NewAnalysisMetrics(registry),
+		reportSize: registry.Histogram(
+			"gold_sales_report_size_bytes",
+			"Size of the rendered report.",
+			metrics.DefaultSizeBuckets),
+	}, nil
+}
+
+// run the report over the inputs and write the outputs.
+func (rr *reportRunner) run(ctx context.Context, inputs []inputConfig) error {
+	config := rr.config
+	runSpan, ctx := tracing.StartSpanFromContext(ctx, "gold_sales_report.report")
+	defer runSpan.Finish()
+
+	repos, err := rr.openInputs(inputs)
+	if err != nil {
+		return failed(exitInput, err, "failed to create ledger repository")
+	}
+	// Closed on every run so watch does not leak a file per ledger per run.
+	defer repository.CloseLedger(repos)
+
+	deduplicated := repository.NewDeduplicatedLedgerRepository(repos, rr.duplicates)
+	deduplicated.InstrumentWith(rr.ledgerMetrics)
+	analysisService := managers.NewAnalysisService(deduplicated)
+	analysisService.InstrumentWith(rr.analysisMetrics)
+	analysisService.RankBy(rr.ranking)
+	analysisService.NetRefundsIn(rr.netting)
+	var runningTotals *managers.RunningTotals
+	if config.StateFilename != "" {
+		ledger, ok := repos.(*repository.CSVLedgerRepository)
+		if !ok {
+			return failed(exitUsage, errors.New("-stateFilename needs a single CSV ledger input"),
+				"invalid inputs")
+		}
+		runningTotals, err = loadRunningTotals(config.StateFilename)
+		if err != nil {
+			return failed(exitInput, err, "failed to load running totals")
+		}
+		analysisService.UseRunningTotals(ledger, runningTotals)
+	}
+	if config.SnapshotFilename != "" {
+		snapshots, err := snapshot.OpenFileStore(config.SnapshotFilename)
+		if err != nil {
+			return failed(exitInput, err, "failed to open snapshot store")
+		}
+		analysisService.UseSnapshots(snapshots)
+		defer flushSnapshots(snapshots)
+	}
+
+	_, manifest, err := analysisService.TopSpendersTo(ctx,
+		config.NumTopSpenders, config.NumMonths, rr.renderers, config.Outputs)
+	logDuplicates(deduplicated)
+	logViolations(deduplicated.Violations())
+	if outputErr, ok := err.(managers.OutputError); ok {
+		return failed(exitOutput, outputErr, "failed to write output")
+	}
+	if err != nil {
+		return ledgerFailed(err, "failed to perform TopSpenders analysis")
+	}
+	for _, file := range manifest.Files {
+		rr.reportSize.Observe(float64(file.Bytes))
+	}
+
+	if runningTotals != nil {
+		if runningTotals.Restarted {
+			log.Warn().Str("stateFilename", config.StateFilename).
+				Msg("ledger no longer matched the watermark, ingested it from the start")
+		}
+		if err := saveRunningTotals(config.StateFilename, runningTotals); err != nil {
+			return failed(exitOutput, err, "failed to save running totals")
+		}
+	}
+
+	if config.ManifestFilename != "" {
+		err := filesystem.WriteAtomically(config.ManifestFilename, func(w io.Writer) error {
+			encoder := json.NewEncoder(w)
+			encoder.SetIndent("", "  ")
+			return encoder.Encode(manifest)
+		})
+		if err != nil {
+			return failed(exitOutput, err, "failed to write manifest")
+		}
+	}
+
+	return nil
+}
+
+// loadRunningTotals saved by an earlier run, or empty totals if there was no
+// earlier run.
+func loadRunningTotals(filename string) (*managers.RunningTotals, error) {
+	totals := managers.NewRunningTotals()
+	contents, err := ioutil.ReadFile(filename)
+	if os.IsNotExist(err) {
+		return totals, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(contents, totals); err != nil {
+		return nil, errors.Wrapf(err, "failed to parse running totals %s", filename)
+	}
+	return totals, nil
+}
+
+// saveRunningTotals once the outputs have been written, so a failed run is
+// ingested again next time.
+func saveRunningTotals(filename string, totals *managers.RunningTotals) error {
+	return filesystem.WriteAtomically(filename, func(w io.Writer) error {
+		return json.NewEncoder(w).Encode(totals)
+	})
+}
+
+// flushSnapshots once the run has finished. Failing to save the snapshots does
+// not fail the run, the months are aggregated again next time.
+func flushSnapshots(snapshots *snapshot.FileStore) {
+	if err := snapshots.Flush(); err != nil {
+		log.Error().Err(err).Msg("failed to write snapshot store")
+	}
+}
+
+// openInputs as a single repository, applying the column mappings to the CSV
+// ledgers and checking the payments of each ledger against its rules. The
+// ledgers already opened are closed if one of them cannot be.
+func (rr *reportRunner) openInputs(inputs []inputConfig) (repository.LedgerRepository, error) {
+	repositories := make([]repository.LedgerRepository, 0, len(inputs))
+	for _, input := range inputs {
+		repos, err := openLedgerRepository(input.Filename, rr.ledgerMetrics)
+		if err != nil {
+			_ = repository.NewCombinedLedgerRepository(repositories...).Close()
+			return nil, err
+		}
+		if csvRepos, ok := repos.(*repository.CSVLedgerRepository); ok &&
+			len(input.Columns) > 0 {
+			csvRepos.MapColumns(input.Columns)
+		}
+		if ruleConfigs := rr.config.inputRules(input); len(ruleConfigs) > 0 {
+			rules, err := rr.rules.Build(ruleConfigs)
+			if err != nil {
+				_ = repository.NewCombinedLedgerRepository(append(repositories, repos)...).Close()
+				return nil, err
+			}
+			validated := repository.NewValidatedLedgerRepository(repos, input.Filename, rules)
+			validated.InstrumentWith(rr.ledgerMetrics)
+			repos = validated
+		}
+		repositories = append(repositories, repos)
+	}
+	if len(repositories) == 1 {
+		return repositories[0], nil
+	}
+	return repository.NewCombinedLedgerRepository(repositories...), nil
+}
+
+// logViolations of the business rules, counted by rule and severity. Every
+// violation is listed in the manifest.
+func logViolations(violations []gold_sales.RuleViolation) {
+	type ruleSeverity struct {
+		rule     string
+		severity gold_sales.RuleSeverity
+	}
+	counts := make(map[ruleSeverity]int)
+	order := make([]ruleSeverity, 0)
+	for _, violation := range violations {
+		key := ruleSeverity{violation.Rule, violation.Severity}
+		if _, ok := counts[key]; !ok {
+			order = append(order, key)
+		}
+		counts[key]++
+	}
+	for _, key := range order {
+		log.Warn().Str("rule", key.rule).Str("severity", string(key.severity)).
+			Int("payments", counts[key]).Msg("payments broke a business rule")
+	}
+}
+
+// reportRenderers available to the run, including the user supplied template
+// when one is given.
+func reportRenderers(
+	csvOptions gold_sales.CSVOptions,
+	templateFilename string,
+) (*gold_sales.RendererRegistry, error) {
+	renderers := gold_sales.NewRendererRegistry()
+	csvRenderer, err := gold_sales.NewCSVRenderer(csvOptions)
+	if err != nil {
+		return renderers, err
+	}
+	renderers.Replace("csv", csvRenderer)
+
+	if templateFilename == "" {
+		return renderers, nil
+	}
+	templateRenderer, err := gold_sales.NewTemplateRendererFromFile(templateFilename)
+	if err != nil {
+		return renderers, err
+	}
+	return renderers, renderers.Register("template", templateRenderer)
+}
+
+// parseDelimiter from the flag, which is a single character or "tab".
+func parseDelimiter(delimiter string) (rune, error) {
+	if delimiter == "tab" || delimiter == `\t` {
+		return '\t', nil
+	}
+	runes := []rune(delimiter)
+	if len(runes) != 1 {
+		return 0, errors.Errorf("delimiter must be a single character, got %q", delimiter)
+	}
+	return runes[0], nil
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewReportRunnerWithState(t *testing.T) {
+	testCases := []struct {
+		Name       string
+		Duplicates string
+		Valid      bool
+	}{
+		{"Duplicates kept", "warn", true},
+		{"Duplicates dropped", "drop", false},
+		{"Duplicates failed", "fail", false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			config := defaultReportConfig()
+			config.Duplicates = tc.Duplicates
+			config.StateFilename = "state.json"
+
+			_, err := newReportRunner(config)
+			if tc.Valid {
+				assert.Nil(t, err, "unexpected error")
+				return
+			}
+			assert.Equal(t, exitUsage, exitCode(err))
+		})
+	}
+}
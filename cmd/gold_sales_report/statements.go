@@ -0,0 +1,143 @@
+package main
+
+import (
+	"archive/zip"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/namsral/flag"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+
+	"github.com/JonPulfer/gold_sales/pkg/gold_sales"
+	"github.com/JonPulfer/gold_sales/pkg/gold_sales/infrastructure/filesystem"
+	"github.com/JonPulfer/gold_sales/pkg/gold_sales/infrastructure/tracing"
+	"github.com/JonPulfer/gold_sales/pkg/gold_sales/service/managers"
+)
+
+// statementsCommand produces a statement for each Spender over the requested
+// period, either as a file per Spender or all together in a zip archive.
+func statementsCommand(args []string) error {
+	flags := flag.NewFlagSet("statements", flag.ExitOnError)
+	var inputFilename string
+	flags.StringVar(&inputFilename, "inputFilename", "sample-transactions.csv", "CSV ledger or .jsonl store to read from")
+	var from string
+	flags.StringVar(&from, "from", "", "First day of the statement period (YYYY-MM-DD)")
+	var to string
+	flags.StringVar(&to, "to", "", "Last day of the statement period (YYYY-MM-DD)")
+	var outputDir string
+	flags.StringVar(&outputDir, "outputDir", "statements", "Directory to write a statement file per customer into")
+	var archiveFilename string
+	flags.StringVar(&archiveFilename, "archiveFilename", "", "Zip archive to write all statements into instead of outputDir")
+	duplicates := duplicatesFlag(flags)
+	var traceFilename string
+	flags.StringVar(&traceFilename, "traceFilename", "", "File to write trace spans to as JSON lines, - for stdout")
+	_ = flags.Parse(args)
+
+	period, err := parseStatementPeriod(from, to)
+	if err != nil {
+		return failed(exitUsage, err, "invalid statement period")
+	}
+
+	ctx, closeTrace := tracingContext(traceFilename)
+	defer closeTrace()
+	runSpan, ctx := tracing.StartSpanFromContext(ctx, "gold_sales_report.statements")
+	defer runSpan.Finish()
+
+	deduplicated, err := openDeduplicated(inputFilename, *duplicates)
+	if err != nil {
+		return err
+	}
+	defer deduplicated.Close()
+	analysisService := managers.NewAnalysisService(deduplicated)
+
+	statements, err := analysisService.Statements(ctx, period)
+	logDuplicates(deduplicated)
+	if err != nil {
+		return ledgerFailed(err, "failed to produce statements")
+	}
+
+	renderSpan, _ := tracing.StartSpanFromContext(ctx, "statements.render")
+	if archiveFilename != "" {
+		err = writeStatementsArchive(archiveFilename, statements)
+	} else {
+		err = writeStatementFiles(outputDir, statements)
+	}
+	renderSpan.SetTag("statements", len(statements)).Finish()
+	if err != nil {
+		return failed(exitOutput, err, "failed to write statements")
+	}
+	log.Info().Int("statements", len(statements)).Msg("statements written")
+
+	return nil
+}
+
+// parseStatementPeriod from the inclusive dates given on the command line.
+// Without dates the period covers the current month.
+func parseStatementPeriod(from, to string) (gold_sales.Period, error) {
+	now := time.Now().UTC()
+	period := gold_sales.Period{
+		From: time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC),
+	}
+	period.To = period.From.AddDate(0, 1, 0)
+
+	if from != "" {
+		fromDate, err := time.Parse("2006-01-02", from)
+		if err != nil {
+			return period, err
+		}
+		period.From = fromDate
+	}
+	if to != "" {
+		toDate, err := time.Parse("2006-01-02", to)
+		if err != nil {
+			return period, err
+		}
+		period.To = toDate.AddDate(0, 0, 1)
+	}
+	if !period.From.Before(period.To) {
+		return period, errors.Errorf("period ends %s, before it starts %s",
+			period.LastDay().Format("2006-01-02"), period.From.Format("2006-01-02"))
+	}
+
+	return period, nil
+}
+
+func writeStatementFiles(outputDir string, statements []*gold_sales.SpenderStatement) error {
+	if err := os.MkdirAll(outputDir, 0755); err != nil {
+		return err
+	}
+	for _, statement := range statements {
+		filename := filepath.Join(outputDir, statement.Filename("csv"))
+		err := filesystem.WriteAtomically(filename, func(w io.Writer) error {
+			_, err := io.Copy(w, statement.FormattedAsCSV())
+			return err
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func writeStatementsArchive(archiveFilename string, statements []*gold_sales.SpenderStatement) error {
+	return filesystem.WriteAtomically(archiveFilename, func(w io.Writer) error {
+		archive := zip.NewWriter(w)
+		for _, statement := range statements {
+			entry, err := archive.CreateHeader(&zip.FileHeader{
+				Name:     statement.Filename("csv"),
+				Method:   zip.Deflate,
+				Modified: time.Now(),
+			})
+			if err != nil {
+				return err
+			}
+			if _, err := io.Copy(entry, statement.FormattedAsCSV()); err != nil {
+				return err
+			}
+		}
+		return archive.Close()
+	})
+}
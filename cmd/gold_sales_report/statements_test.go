@@ -0,0 +1,35 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseStatementPeriod(t *testing.T) {
+	testCases := []struct {
+		Name        string
+		From        string
+		To          string
+		ExpectedTo  time.Time
+		ExpectError bool
+	}{
+		{"Inclusive to day", "2020-03-01", "2020-04-30", time.Date(2020, 5, 1, 0, 0, 0, 0, time.UTC), false},
+		{"Single day", "2020-03-01", "2020-03-01", time.Date(2020, 3, 2, 0, 0, 0, 0, time.UTC), false},
+		{"To before from", "2020-04-30", "2020-03-01", time.Time{}, true},
+		{"Invalid from", "01/03/2020", "2020-04-30", time.Time{}, true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			period, err := parseStatementPeriod(tc.From, tc.To)
+			if tc.ExpectError {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.ExpectedTo, period.To)
+		})
+	}
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"text/tabwriter"
+
+	"github.com/namsral/flag"
+
+	"github.com/JonPulfer/gold_sales/pkg/gold_sales/infrastructure/repository"
+)
+
+// validateCommand checks every row of a ledger and prints a data quality
+// summary without producing a report. It exits non-zero when any row cannot
+// be parsed.
+func validateCommand(args []string) error {
+	flags := flag.NewFlagSet("validate", flag.ExitOnError)
+	var inputFilename string
+	flags.StringVar(&inputFilename, "inputFilename", "sample-transactions.csv", "CSV File to validate")
+	var maxErrors int
+	flags.IntVar(&maxErrors, "maxErrors", 20, "Maximum number of row errors and duplicates to list")
+	_ = flags.Parse(args)
+
+	summary, err := summariseLedger(inputFilename)
+	if err != nil {
+		return err
+	}
+
+	out := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(out, "File:\t%s\n", inputFilename)
+	fmt.Fprintf(out, "Rows:\t%d\n", summary.Rows)
+	fmt.Fprintf(out, "Gold spends:\t%d\n", summary.GoldPayments)
+	fmt.Fprintf(out, "Gold refunds:\t%d\n", summary.GoldRefunds)
+	fmt.Fprintf(out, "Other transactions:\t%d\n",
+		summary.Rows-summary.GoldPayments-summary.GoldRefunds-len(summary.RowErrors))
+	fmt.Fprintf(out, "Rows with errors:\t%d\n", len(summary.RowErrors))
+
+	byReason := make(map[string]int)
+	for _, rowError := range summary.RowErrors {
+		byReason[rowError.Reason]++
+	}
+	reasons := make([]string, 0, len(byReason))
+	for reason := range byReason {
+		reasons = append(reasons, reason)
+	}
+	sort.Strings(reasons)
+	for _, reason := range reasons {
+		fmt.Fprintf(out, "  %s:\t%d\n", reason, byReason[reason])
+	}
+	for i, rowError := range summary.RowErrors {
+		if i == maxErrors {
+			fmt.Fprintf(out, "  ...\t%d more\n", len(summary.RowErrors)-maxErrors)
+			break
+		}
+		fmt.Fprintf(out, "  line %d:\t%s\n", rowError.Line, rowError.Message)
+	}
+	fmt.Fprintf(out, "Duplicate transactions:\t%d\n", len(summary.Duplicates))
+	for i, duplicate := range summary.Duplicates {
+		if i == maxErrors {
+			fmt.Fprintf(out, "  ...\t%d more\n", len(summary.Duplicates)-maxErrors)
+			break
+		}
+		fmt.Fprintf(out, "  %s:\t%d times, %s %s %.2f %s\n", duplicate.ID, duplicate.Count,
+			duplicate.Payment.Spender.Email, duplicate.Payment.Description,
+			duplicate.Payment.Amount, duplicate.Payment.Date.Format("02/01/2006 15:04"))
+	}
+	out.Flush()
+
+	if !summary.Valid() {
+		return failed(exitValidation, nil,
+			fmt.Sprintf("%d rows of the ledger are invalid", len(summary.RowErrors)))
+	}
+	return nil
+}
+
+// summariseLedger in the CSV file.
+func summariseLedger(inputFilename string) (*repository.LedgerSummary, error) {
+	repos, err := repository.NewCSVLedgerRepository(inputFilename)
+	if err != nil {
+		return nil, failed(exitInput, err, "failed to create ledger repository")
+	}
+	defer repos.Close()
+	summary, err := repos.Summarise(context.Background())
+	if err != nil {
+		return nil, ledgerFailed(err, "failed to read ledger")
+	}
+	return summary, nil
+}
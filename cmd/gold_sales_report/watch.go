@@ -0,0 +1,185 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/namsral/flag"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+
+	"github.com/JonPulfer/gold_sales/pkg/gold_sales/infrastructure/filesystem"
+)
+
+// watchCommand runs the report each time ledgers in a directory are created,
+// changed or removed, until it is interrupted.
+func watchCommand(args []string) error {
+	flags := flag.NewFlagSet("watch", flag.ExitOnError)
+	options := filesystem.DefaultWatchOptions()
+	watchDir := flags.String("watchDir", "", "Directory to watch, every .csv ledger, .jsonl store and .events log in it is read")
+	flags.DurationVar(&options.PollInterval, "pollInterval", options.PollInterval,
+		"How often to scan the directory, which is also scanned on file notifications")
+	flags.DurationVar(&options.Settle, "settle", options.Settle,
+		"How long a ledger must be left unchanged before the report is run")
+	flags.BoolVar(&options.Poll, "poll", false, "Poll the directory without file notifications")
+	retryInterval := flags.Duration("retryInterval", 30*time.Second, "How long to wait before running a failed report again")
+	config, printConfig, err := parseReportConfig(flags, args)
+	if err != nil {
+		return failed(exitUsage, err, "failed to load config")
+	}
+	if printConfig {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(config)
+	}
+	if *watchDir == "" {
+		return failed(exitUsage, errors.New("-watchDir is required"), "invalid watch directory")
+	}
+	if config.StateFilename != "" {
+		return failed(exitUsage, errors.New("-stateFilename needs a single CSV ledger input"),
+			"invalid inputs")
+	}
+
+	runner, err := newReportRunner(config)
+	if err != nil {
+		return err
+	}
+	if config.MetricsAddr != "" {
+		serveMetrics(config.MetricsAddr, runner.registry)
+	}
+
+	ctx, closeTrace := tracingContext(config.TraceFilename)
+	defer closeTrace()
+	ctx, stop := signalContext(ctx)
+	defer stop()
+
+	options.Match = ledgerMatcher(config)
+	watcher, err := filesystem.NewWatcher(*watchDir, options)
+	if err != nil {
+		return failed(exitInput, err, "failed to watch directory")
+	}
+	defer watcher.Close()
+	log.Info().Str("watchDir", *watchDir).Bool("polling", watcher.Polling()).
+		Msg("watching for ledgers")
+
+	changes := make(chan []string)
+	go watcher.Watch(ctx, func(filenames []string) {
+		select {
+		case changes <- filenames:
+		case <-ctx.Done():
+		}
+	}, func(err error) {
+		log.Error().Err(err).Str("watchDir", *watchDir).Msg("failed to scan directory")
+	})
+
+	var retry <-chan time.Time
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case filenames := <-changes:
+			log.Info().Strs("ledgers", filenames).Msg("ledgers changed")
+		case <-retry:
+			log.Info().Msg("retrying report")
+		}
+
+		retry = nil
+		err := runWatchedReport(ctx, runner, watcher)
+		if config.MetricsFilename != "" {
+			writeMetrics(config.MetricsFilename, runner.registry)
+		}
+		if err != nil {
+			log.Error().Err(err).Dur("retryInterval", *retryInterval).
+				Msg("report failed, it will be retried")
+			retry = time.After(*retryInterval)
+		}
+	}
+}
+
+// runWatchedReport over every ledger in the directory, applying the column
+// mappings and rules of the configured inputs with the same file name.
+func runWatchedReport(
+	ctx context.Context,
+	runner *reportRunner,
+	watcher *filesystem.Watcher,
+) error {
+	filenames, err := watcher.Files()
+	if err != nil {
+		return err
+	}
+	if len(filenames) == 0 {
+		log.Warn().Msg("no ledgers to report on")
+		return nil
+	}
+
+	configured := make(map[string]inputConfig)
+	for _, input := range runner.config.Inputs {
+		configured[filepath.Base(input.Filename)] = input
+	}
+	inputs := make([]inputConfig, len(filenames))
+	for i, filename := range filenames {
+		input := configured[filepath.Base(filename)]
+		inputs[i] = inputConfig{Filename: filename, Columns: input.Columns, Rules: input.Rules}
+	}
+
+	if err := runner.run(ctx, inputs); err != nil {
+		return err
+	}
+	log.Info().Strs("ledgers", filenames).Msg("report written")
+	return nil
+}
+
+// ledgerMatcher matches the CSV ledgers, JSON lines stores and event logs in
+// the watched directory. Hidden files, such as the temporary files outputs are
+// written through, and the files the report writes are not ledgers.
+func ledgerMatcher(config reportConfig) func(filename string) bool {
+	written := []string{config.ManifestFilename, config.SnapshotFilename,
+		config.MetricsFilename, config.TraceFilename}
+	for _, output := range config.Outputs {
+		written = append(written, output.Filename)
+	}
+	excluded := make(map[string]bool)
+	for _, filename := range written {
+		if filename == "" || filename == "-" {
+			continue
+		}
+		if abs, err := filepath.Abs(filename); err == nil {
+			excluded[abs] = true
+		}
+	}
+
+	return func(filename string) bool {
+		base := filepath.Base(filename)
+		ext := strings.ToLower(filepath.Ext(base))
+		if strings.HasPrefix(base, ".") ||
+			(ext != ".csv" && ext != ".jsonl" && ext != ".events") {
+			return false
+		}
+		abs, err := filepath.Abs(filename)
+		return err == nil && !excluded[abs]
+	}
+}
+
+// signalContext that is done once the process is interrupted or terminated.
+func signalContext(parent context.Context) (context.Context, func()) {
+	ctx, cancel := context.WithCancel(parent)
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		select {
+		case <-signals:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	return ctx, func() {
+		signal.Stop(signals)
+		cancel()
+	}
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/JonPulfer/gold_sales/pkg/gold_sales"
+)
+
+func TestLedgerMatcher(t *testing.T) {
+	config := defaultReportConfig()
+	config.Outputs = []gold_sales.OutputTarget{
+		{Format: "csv", Filename: filepath.Join("drop", "output.csv")},
+		{Format: "json", Filename: filepath.Join("drop", "output.json")},
+	}
+	match := ledgerMatcher(config)
+
+	testCases := []struct {
+		Name     string
+		Filename string
+		Matched  bool
+	}{
+		{"CSV ledger", filepath.Join("drop", "march.csv"), true},
+		{"Upper case extension", filepath.Join("drop", "APRIL.CSV"), true},
+		{"Ledger store", filepath.Join("drop", "ledger.jsonl"), true},
+		{"Other file", filepath.Join("drop", "notes.txt"), false},
+		{"Hidden temporary file", filepath.Join("drop", ".march.csv.tmp-123"), false},
+		{"Hidden CSV", filepath.Join("drop", ".partial.csv"), false},
+		{"Report output", filepath.Join("drop", "output.csv"), false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			assert.Equal(t, tc.Matched, match(tc.Filename))
+		})
+	}
+}
@@ -4,6 +4,7 @@ go 1.14
 
 require (
 	github.com/namsral/flag v1.7.4-pre
+	github.com/opentracing/opentracing-go v1.2.0
 	github.com/pkg/errors v0.8.1
 	github.com/rs/zerolog v1.19.0
 	github.com/stretchr/testify v1.6.1
@@ -0,0 +1,151 @@
+package gold_sales
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// AlertKind of an unusual pattern of spending.
+type AlertKind string
+
+const (
+	// AlertMonthlySpend is a month of spend far from the customer's own
+	// trailing months.
+	AlertMonthlySpend AlertKind = "monthly_spend"
+	// AlertLargeSpend is a spend far larger than the customer's typical
+	// spend.
+	AlertLargeSpend AlertKind = "large_spend"
+	// AlertBurst is a run of spends within a short window.
+	AlertBurst AlertKind = "burst"
+)
+
+// AnomalyOptions for finding unusual spending. Spends are measured by the
+// Metric, grams of gold or the amount paid.
+type AnomalyOptions struct {
+	Metric RankingMetric `json:"metric"`
+	// TrailingMonths of a customer's history a month is compared with, and
+	// MinHistoryMonths the fewest there must be. Months within the history
+	// without any spend count as no spend.
+	TrailingMonths   int `json:"trailingMonths"`
+	MinHistoryMonths int `json:"minHistoryMonths"`
+	// MaxScore is the largest robust z-score, the distance from the median
+	// of the history in scaled median absolute deviations, that is not
+	// flagged.
+	MaxScore float64 `json:"maxScore"`
+	// LargeSpendFactor times the median of a customer's other spends is
+	// the largest spend that is not flagged, once the customer has at least
+	// MinSpends other spends.
+	LargeSpendFactor float64 `json:"largeSpendFactor"`
+	MinSpends        int     `json:"minSpends"`
+	// BurstSpends or more spends by a customer within BurstWindow are
+	// flagged.
+	BurstSpends int           `json:"burstSpends"`
+	BurstWindow time.Duration `json:"burstWindow"`
+}
+
+// DefaultAnomalyOptions compare each month with up to six trailing months,
+// flag spends five times the typical size and three spends within an hour.
+func DefaultAnomalyOptions() AnomalyOptions {
+	return AnomalyOptions{
+		Metric:           RankByGrams,
+		TrailingMonths:   6,
+		MinHistoryMonths: 3,
+		MaxScore:         3.5,
+		LargeSpendFactor: 5,
+		MinSpends:        3,
+		BurstSpends:      3,
+		BurstWindow:      time.Hour,
+	}
+}
+
+// MarshalJSON with the BurstWindow written as a duration, such as "1h0m0s".
+func (ao AnomalyOptions) MarshalJSON() ([]byte, error) {
+	type options AnomalyOptions
+	return json.Marshal(struct {
+		options
+		BurstWindow string `json:"burstWindow"`
+	}{options(ao), ao.BurstWindow.String()})
+}
+
+// UnmarshalJSON with the BurstWindow as a duration, as written by
+// MarshalJSON.
+func (ao *AnomalyOptions) UnmarshalJSON(data []byte) error {
+	type options AnomalyOptions
+	view := struct {
+		*options
+		BurstWindow string `json:"burstWindow"`
+	}{options: (*options)(ao)}
+	if err := json.Unmarshal(data, &view); err != nil {
+		return err
+	}
+	if view.BurstWindow == "" {
+		return nil
+	}
+	window, err := time.ParseDuration(view.BurstWindow)
+	if err != nil {
+		return errors.Wrap(err, "invalid burstWindow")
+	}
+	ao.BurstWindow = window
+	return nil
+}
+
+// Alert of unusual spending by a customer, with the reason it was raised.
+// Value is what was flagged: the month total, the spend or the total of the
+// burst. Baseline is the median it was compared with, for monthly and large
+// spend alerts, and Score the robust z-score of a monthly spend alert.
+type Alert struct {
+	Kind       AlertKind   `json:"kind"`
+	Spender    Spender     `json:"spender"`
+	Month      ReportMonth `json:"month"`
+	Date       time.Time   `json:"date"`
+	PaymentIDs []string    `json:"paymentIds,omitempty"`
+	Value      float64     `json:"value"`
+	Baseline   float64     `json:"baseline,omitempty"`
+	Score      float64     `json:"score,omitempty"`
+	Reason     string      `json:"reason"`
+}
+
+// AlertsReport of the unusual spending found in the ledgers.
+type AlertsReport struct {
+	GeneratedAt time.Time      `json:"generatedAt"`
+	Options     AnomalyOptions `json:"options"`
+	Alerts      []Alert        `json:"alerts"`
+}
+
+// WriteJSON of the alerts with the options they were raised under, so a
+// reviewer can see why each one was flagged.
+func (ar AlertsReport) WriteJSON(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(ar)
+}
+
+// WriteCSV of the alerts with a header row, one alert per row.
+func (ar AlertsReport) WriteCSV(w io.Writer) error {
+	writer := csv.NewWriter(w)
+	_ = writer.Write([]string{"kind", "month", "date", "first_name", "last_name", "email",
+		"value", "baseline", "score", "payment_ids", "reason"})
+	for _, alert := range ar.Alerts {
+		_ = writer.Write([]string{
+			string(alert.Kind),
+			string(alert.Month),
+			alert.Date.Format("02/01/2006 15:04"),
+			alert.Spender.FirstName,
+			alert.Spender.LastName,
+			alert.Spender.Email,
+			strconv.FormatFloat(alert.Value, 'f', 2, 64),
+			strconv.FormatFloat(alert.Baseline, 'f', 2, 64),
+			strconv.FormatFloat(alert.Score, 'f', 2, 64),
+			strings.Join(alert.PaymentIDs, " "),
+			alert.Reason,
+		})
+	}
+	writer.Flush()
+	return writer.Error()
+}
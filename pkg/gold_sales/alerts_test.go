@@ -0,0 +1,28 @@
+package gold_sales
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAnomalyOptionsBurstWindowIsADuration(t *testing.T) {
+	options := DefaultAnomalyOptions()
+	options.BurstWindow = 90 * time.Minute
+
+	var buf bytes.Buffer
+	require.Nil(t, AlertsReport{Options: options, Alerts: []Alert{}}.WriteJSON(&buf))
+	assert.Contains(t, buf.String(), `"burstWindow": "1h30m0s"`)
+	assert.Contains(t, buf.String(), `"burstSpends": 3`)
+
+	var report AlertsReport
+	require.Nil(t, json.Unmarshal(buf.Bytes(), &report))
+	assert.Equal(t, options, report.Options)
+
+	err := json.Unmarshal([]byte(`{"burstWindow": "an hour"}`), &options)
+	assert.NotNil(t, err, "the window must be a duration")
+}
@@ -0,0 +1,69 @@
+package gold_sales
+
+import (
+	"math"
+	"sort"
+)
+
+// GoldBalance held by a Spender: the grams of gold bought, less the grams
+// sold and spent on card, with refunded spends added back.
+type GoldBalance struct {
+	Spender Spender `json:"spender"`
+	Grams   float64 `json:"grams"`
+	// Transactions that moved gold in or out of the balance.
+	Transactions int `json:"transactions"`
+}
+
+// GoldBalances of the Spenders from their transactions, ordered by email and
+// then name, as spenders are told apart by their names as well as their email.
+// Transactions that move no gold, such as card spends paid in pounds, are
+// ignored.
+func GoldBalances(transactions []GoldPayment) []GoldBalance {
+	balances := make(map[Spender]*GoldBalance)
+	for _, transaction := range transactions {
+		grams, ok := goldMovement(transaction)
+		if !ok {
+			continue
+		}
+		balance, ok := balances[transaction.Spender]
+		if !ok {
+			balance = &GoldBalance{Spender: transaction.Spender}
+			balances[transaction.Spender] = balance
+		}
+		balance.Grams = balance.Grams + grams
+		balance.Transactions++
+	}
+
+	ordered := make([]GoldBalance, 0, len(balances))
+	for _, balance := range balances {
+		ordered = append(ordered, *balance)
+	}
+	sort.Slice(ordered, func(i, j int) bool {
+		if ordered[i].Spender.Email != ordered[j].Spender.Email {
+			return ordered[i].Spender.Email < ordered[j].Spender.Email
+		}
+		if ordered[i].Spender.LastName != ordered[j].Spender.LastName {
+			return ordered[i].Spender.LastName < ordered[j].Spender.LastName
+		}
+		return ordered[i].Spender.FirstName < ordered[j].Spender.FirstName
+	})
+	return ordered
+}
+
+// goldMovement of the transaction in grams, positive when gold is added to
+// the balance. Sales are made in gold, so their amount is the grams sold.
+func goldMovement(transaction GoldPayment) (float64, bool) {
+	switch {
+	case transaction.Description == GoldBuy:
+		return math.Abs(transaction.GramWeight), true
+	case transaction.Description == GoldSell && transaction.FromCurrency == GoldCurrencyCode:
+		return -math.Abs(transaction.Amount), true
+	case transaction.Description == GoldSell:
+		return -math.Abs(transaction.GramWeight), true
+	case transaction.IsGoldRefund():
+		return math.Abs(transaction.GramWeight), true
+	case transaction.IsGoldSpend():
+		return -transaction.GramWeight, true
+	}
+	return 0, false
+}
@@ -0,0 +1,43 @@
+package gold_sales
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGoldBalances(t *testing.T) {
+	jo := Spender{FirstName: "Jo", LastName: "Smith", Email: "jo@mock.com"}
+	sam := Spender{FirstName: "Sam", LastName: "Neil", Email: "sam@mock.com"}
+	shared := Spender{FirstName: "Alex", LastName: "Neil", Email: "sam@mock.com"}
+
+	transactions := []GoldPayment{
+		{Spender: sam, Description: GoldBuy, Amount: 200, Rate: 40, FromCurrency: "GBP",
+			ToCurrency: GoldCurrencyCode, GramWeight: 5},
+		{Spender: jo, Description: GoldBuy, Amount: 400, Rate: 40, FromCurrency: "GBP",
+			ToCurrency: GoldCurrencyCode, GramWeight: 10},
+		{Spender: jo, Description: GoldSpend, Amount: 80, Rate: 40, FromCurrency: "GBP",
+			ToCurrency: GoldCurrencyCode, GramWeight: 2},
+		{Spender: jo, Description: GoldRefund, Amount: 40, Rate: 40, FromCurrency: "GBP",
+			ToCurrency: GoldCurrencyCode, GramWeight: 1},
+		{Spender: jo, Description: GoldSell, Amount: 3, Rate: 40, FromCurrency: GoldCurrencyCode,
+			ToCurrency: "GBP", GramWeight: 0.075},
+		{Spender: sam, Description: GoldSpend, Amount: 10, Rate: 1, FromCurrency: "GBP",
+			ToCurrency: "GBP", GramWeight: 10},
+		{Spender: shared, Description: GoldBuy, Amount: 80, Rate: 40, FromCurrency: "GBP",
+			ToCurrency: GoldCurrencyCode, GramWeight: 2},
+	}
+
+	balances := GoldBalances(transactions)
+	require.Len(t, balances, 3, "spenders sharing an email keep their own balances")
+	assert.Equal(t, jo, balances[0].Spender)
+	assert.InDelta(t, 6.0, balances[0].Grams, 0.0001)
+	assert.Equal(t, 4, balances[0].Transactions)
+	assert.Equal(t, shared, balances[1].Spender)
+	assert.InDelta(t, 2.0, balances[1].Grams, 0.0001)
+	assert.Equal(t, 1, balances[1].Transactions)
+	assert.Equal(t, sam, balances[2].Spender)
+	assert.InDelta(t, 5.0, balances[2].Grams, 0.0001, "spends in pounds move no gold")
+	assert.Equal(t, 1, balances[2].Transactions)
+}
@@ -0,0 +1,97 @@
+package gold_sales
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"strconv"
+	"time"
+)
+
+// jsonCohortReportSchema identifies the layout of the json cohort report, so
+// readers can reject reports they do not understand.
+const jsonCohortReportSchema = "gold_sales/cohort_report/v1"
+
+// Cohort of the customers whose first gold payment was in the same month,
+// with how many of them spent gold in each month after. Retention[N] is the
+// Nth month after the cohort's month, starting with the month itself.
+type Cohort struct {
+	Month     ReportMonth       `json:"month"`
+	Customers int               `json:"customers"`
+	Retention []CohortRetention `json:"retention"`
+}
+
+// CohortRetention of a cohort in a month after it was acquired. Share is the
+// fraction of the cohort that spent gold in the month and the averages are of
+// the net spend of those customers. AverageAmount is only given when every
+// payment the customers made in the month was from the same Currency, as
+// amounts in different currencies cannot be added together.
+type CohortRetention struct {
+	MonthsAfter   int         `json:"monthsAfter"`
+	Month         ReportMonth `json:"month"`
+	Customers     int         `json:"customers"`
+	Share         float64     `json:"share"`
+	AverageGrams  TotalSpend  `json:"averageGrams"`
+	AverageAmount *float64    `json:"averageAmount,omitempty"`
+	Currency      string      `json:"currency,omitempty"`
+}
+
+// CohortReport of every cohort in the ledgers, oldest first. Each cohort is
+// followed up to the last month of the ledgers, so younger cohorts have fewer
+// months of retention.
+type CohortReport struct {
+	GeneratedAt time.Time `json:"generatedAt"`
+	Cohorts     []Cohort  `json:"cohorts"`
+}
+
+// MaxMonthsAfter a cohort was acquired that any cohort is followed for.
+func (cr CohortReport) MaxMonthsAfter() int {
+	maxMonthsAfter := 0
+	for _, cohort := range cr.Cohorts {
+		if len(cohort.Retention) > maxMonthsAfter {
+			maxMonthsAfter = len(cohort.Retention)
+		}
+	}
+	return maxMonthsAfter
+}
+
+// WriteJSON of the cohorts under a versioned schema, for dashboards that
+// chart retention over time.
+func (cr CohortReport) WriteJSON(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(struct {
+		Schema string `json:"schema"`
+		CohortReport
+	}{jsonCohortReportSchema, cr})
+}
+
+// WriteCSV of the report as a retention matrix, a row per cohort with the
+// share retained in each month after it was acquired followed by the average
+// grams spent by the retained customers. Months a cohort has not reached yet
+// are left empty.
+func (cr CohortReport) WriteCSV(w io.Writer) error {
+	writer := csv.NewWriter(w)
+	months := cr.MaxMonthsAfter()
+	header := []string{"cohort", "customers"}
+	for n := 0; n < months; n++ {
+		header = append(header, "retention_"+strconv.Itoa(n))
+	}
+	for n := 0; n < months; n++ {
+		header = append(header, "average_grams_"+strconv.Itoa(n))
+	}
+	_ = writer.Write(header)
+
+	for _, cohort := range cr.Cohorts {
+		shares := make([]string, months)
+		averages := make([]string, months)
+		for n, retention := range cohort.Retention {
+			shares[n] = strconv.FormatFloat(retention.Share, 'f', 4, 64)
+			averages[n] = retention.AverageGrams.String()
+		}
+		row := append([]string{string(cohort.Month), strconv.Itoa(cohort.Customers)}, shares...)
+		_ = writer.Write(append(row, averages...))
+	}
+	writer.Flush()
+	return writer.Error()
+}
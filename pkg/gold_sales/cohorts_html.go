@@ -0,0 +1,76 @@
+package gold_sales
+
+import (
+	"html/template"
+	"io"
+)
+
+// htmlCohortCell of the retention matrix, blank for months the cohort has
+// not reached yet.
+type htmlCohortCell struct {
+	CohortRetention
+	Reached bool
+}
+
+type htmlCohortRow struct {
+	Cohort
+	Cells []htmlCohortCell
+}
+
+type htmlCohortReport struct {
+	CohortReport
+	MonthsAfter []int
+	Rows        []htmlCohortRow
+}
+
+// WriteHTML of the report as a single static page with the retention matrix,
+// each cell shaded by the share of the cohort retained.
+func (cr CohortReport) WriteHTML(w io.Writer) error {
+	months := cr.MaxMonthsAfter()
+	view := htmlCohortReport{
+		CohortReport: cr,
+		MonthsAfter:  make([]int, months),
+		Rows:         make([]htmlCohortRow, 0, len(cr.Cohorts)),
+	}
+	for n := range view.MonthsAfter {
+		view.MonthsAfter[n] = n
+	}
+	for _, cohort := range cr.Cohorts {
+		row := htmlCohortRow{Cohort: cohort, Cells: make([]htmlCohortCell, months)}
+		for n, retention := range cohort.Retention {
+			row.Cells[n] = htmlCohortCell{CohortRetention: retention, Reached: true}
+		}
+		view.Rows = append(view.Rows, row)
+	}
+	return cohortTemplate.Execute(w, view)
+}
+
+var cohortTemplate = template.Must(template.New("cohorts").Funcs(
+	template.FuncMap{"percent": func(share float64) float64 { return share * 100 }},
+).Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>Customer retention by cohort</title>
+<style>
+body { font-family: Helvetica, Arial, sans-serif; color: #222; margin: 2em; }
+h1 { font-size: 1.6em; }
+table { border-collapse: collapse; margin: 0.5em 0 1em 0; }
+th, td { padding: 4px 12px; border: 1px solid #eee; text-align: right; }
+th.cohort, td.cohort { text-align: left; }
+td span { display: block; color: #555; font-size: 0.8em; }
+.muted { color: #777; font-size: 0.9em; }
+</style>
+</head>
+<body>
+<h1>Customer retention by cohort</h1>
+<p class="muted">Generated {{.GeneratedAt.Format "02 Jan 2006 15:04 MST"}}. Customers join the cohort of the month of their first gold payment. Each cell is the share of the cohort that spent gold in the month after, with the average grams they spent.</p>
+<table>
+<thead><tr><th class="cohort">Cohort</th><th>Customers</th>{{range .MonthsAfter}}<th>Month {{.}}</th>{{end}}</tr></thead>
+<tbody>
+{{range .Rows}}<tr><td class="cohort">{{.Month}}</td><td>{{.Customers}}</td>{{range .Cells}}{{if .Reached}}<td style="background: rgba(212, 175, 55, {{printf "%.2f" .Share}})">{{printf "%.1f%%" (percent .Share)}}<span>{{.AverageGrams}} g</span></td>{{else}}<td></td>{{end}}{{end}}</tr>
+{{end}}</tbody>
+</table>
+</body>
+</html>
+`))
@@ -0,0 +1,39 @@
+package gold_sales
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCohortReportWrite(t *testing.T) {
+	report := CohortReport{Cohorts: []Cohort{
+		{Month: "Jan 2020", Customers: 4, Retention: []CohortRetention{
+			{MonthsAfter: 0, Month: "Jan 2020", Customers: 4, Share: 1, AverageGrams: 10},
+			{MonthsAfter: 1, Month: "Feb 2020", Customers: 1, Share: 0.25, AverageGrams: 5.5},
+		}},
+		{Month: "Feb 2020", Customers: 2, Retention: []CohortRetention{
+			{MonthsAfter: 0, Month: "Feb 2020", Customers: 2, Share: 1, AverageGrams: 3},
+		}},
+	}}
+	assert.Equal(t, 2, report.MaxMonthsAfter())
+
+	var csv bytes.Buffer
+	require.NoError(t, report.WriteCSV(&csv))
+	assert.Equal(t, "cohort,customers,retention_0,retention_1,average_grams_0,average_grams_1\n"+
+		"Jan 2020,4,1.0000,0.2500,10.00,5.50\n"+
+		"Feb 2020,2,1.0000,,3.00,\n", csv.String())
+
+	var json bytes.Buffer
+	require.NoError(t, report.WriteJSON(&json))
+	assert.Contains(t, json.String(), `"schema": "gold_sales/cohort_report/v1"`)
+	assert.Contains(t, json.String(), `"monthsAfter": 1`)
+
+	var html bytes.Buffer
+	require.NoError(t, report.WriteHTML(&html))
+	assert.Contains(t, html.String(), "<th>Month 1</th>")
+	assert.Contains(t, html.String(), "25.0%<span>5.50 g</span>")
+	assert.Contains(t, html.String(), "<td></td>")
+}
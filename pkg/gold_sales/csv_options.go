@@ -0,0 +1,70 @@
+package gold_sales
+
+import (
+	"io"
+	"unicode/utf8"
+
+	"github.com/pkg/errors"
+)
+
+const utf8BOM = "\xEF\xBB\xBF"
+
+// CSVOptions control the columns and dialect of a CSV report. Fields are
+// always quoted as described in RFC 4180 when they need to be.
+type CSVOptions struct {
+	// Header row naming the columns.
+	Header bool
+	// Rank of the spender within the month.
+	Rank bool
+	// Email of the spender.
+	Email bool
+	// Delimiter between fields, a comma when not set.
+	Delimiter rune
+	// CRLF line endings rather than LF.
+	CRLF bool
+	// BOM written first so spreadsheets detect UTF-8.
+	BOM bool
+}
+
+// DefaultCSVOptions that keep the original month, first name, last name and
+// total spend columns.
+func DefaultCSVOptions() CSVOptions {
+	return CSVOptions{Delimiter: ','}
+}
+
+// Validate the options can produce a readable CSV.
+func (co CSVOptions) Validate() error {
+	if co.Delimiter == 0 {
+		return nil
+	}
+	if co.Delimiter == '"' || co.Delimiter == '\r' || co.Delimiter == '\n' ||
+		co.Delimiter == utf8.RuneError {
+		return errors.Errorf("invalid CSV delimiter %q", co.Delimiter)
+	}
+	return nil
+}
+
+// columns selects the optional columns from a full row of month, rank,
+// first name, last name, email and total spend.
+func (co CSVOptions) columns(row []string) []string {
+	selected := []string{row[0]}
+	if co.Rank {
+		selected = append(selected, row[1])
+	}
+	selected = append(selected, row[2], row[3])
+	if co.Email {
+		selected = append(selected, row[4])
+	}
+	return append(selected, row[5])
+}
+
+// NewCSVRenderer that writes the report with the options given.
+func NewCSVRenderer(options CSVOptions) (Renderer, error) {
+	if err := options.Validate(); err != nil {
+		return nil, err
+	}
+	return RendererFunc(func(w io.Writer, report *MonthlyTopSpendersAnalysisReport) error {
+		_, err := io.Copy(w, report.FormattedAsCSVWithOptions(options))
+		return err
+	}), nil
+}
@@ -0,0 +1,48 @@
+package gold_sales
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFormattedAsCSVWithOptions(t *testing.T) {
+	testCases := []struct {
+		Name     string
+		Options  CSVOptions
+		Expected string
+	}{
+		{
+			"Default options quote names with commas",
+			DefaultCSVOptions(),
+			"Jun 2020,Jo,\"Smith, Jr.\",12.50\n" +
+				"Jun 2020,Sam,O'Neil,3.25\n",
+		},
+		{
+			"Header, rank and email",
+			CSVOptions{Header: true, Rank: true, Email: true},
+			"month,rank,first_name,last_name,email,total_spend\n" +
+				"Jun 2020,1,Jo,\"Smith, Jr.\",jo@mock.com,12.50\n" +
+				"Jun 2020,2,Sam,O'Neil,sam@mock.com,3.25\n",
+		},
+		{
+			"Tab delimited with CRLF and BOM",
+			CSVOptions{Delimiter: '\t', CRLF: true, BOM: true},
+			utf8BOM +
+				"Jun 2020\tJo\tSmith, Jr.\t12.50\r\n" +
+				"Jun 2020\tSam\tO'Neil\t3.25\r\n",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			output := reportForTests().FormattedAsCSVWithOptions(tc.Options)
+			assert.Equal(t, tc.Expected, output.String())
+		})
+	}
+}
+
+func TestCSVOptionsRejectsQuoteDelimiter(t *testing.T) {
+	_, err := NewCSVRenderer(CSVOptions{Delimiter: '"'})
+	assert.NotNil(t, err, "expected error")
+}
@@ -0,0 +1,163 @@
+package gold_sales
+
+import (
+	"sort"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Descriptions of the transactions that buy and sell gold.
+const (
+	GoldBuy  = "BUY GOLD"
+	GoldSell = "SELL GOLD"
+)
+
+// EventType of a LedgerEvent.
+type EventType string
+
+const (
+	// EventSpend on a card.
+	EventSpend EventType = "spend"
+	// EventBuy of gold.
+	EventBuy EventType = "buy"
+	// EventSell of gold.
+	EventSell EventType = "sell"
+	// EventRefund of a card spend.
+	EventRefund EventType = "refund"
+	// EventCorrection replaces the transaction of an earlier event.
+	EventCorrection EventType = "correction"
+	// EventReversal cancels the transaction of an earlier event.
+	EventReversal EventType = "reversal"
+)
+
+// TransactionEventType for a transaction, from its description.
+func TransactionEventType(transaction GoldPayment) (EventType, error) {
+	switch transaction.Description {
+	case GoldSpend:
+		return EventSpend, nil
+	case GoldBuy:
+		return EventBuy, nil
+	case GoldSell:
+		return EventSell, nil
+	case GoldRefund:
+		return EventRefund, nil
+	}
+	return "", errors.Errorf("no event type for transaction %q", transaction.Description)
+}
+
+// LedgerEvent recorded in the event log. Transactions are never changed once
+// recorded, later events correct or reverse them instead.
+type LedgerEvent struct {
+	// Sequence of the event in the log, starting at 1.
+	Sequence   uint64    `json:"sequence"`
+	Type       EventType `json:"type"`
+	RecordedAt time.Time `json:"recordedAt"`
+	// Transaction recorded, or the corrected transaction for a correction.
+	Transaction *GoldPayment `json:"transaction,omitempty"`
+	// Target is the sequence of the transaction a correction or reversal
+	// applies to.
+	Target uint64 `json:"target,omitempty"`
+	Reason string `json:"reason,omitempty"`
+	// Checksum of the event chained with the checksum of the event before
+	// it, so any change to the history of the log can be detected.
+	Checksum string `json:"checksum"`
+}
+
+// NewTransactionEvent recording the transaction.
+func NewTransactionEvent(transaction GoldPayment) (LedgerEvent, error) {
+	eventType, err := TransactionEventType(transaction)
+	if err != nil {
+		return LedgerEvent{}, err
+	}
+	return LedgerEvent{Type: eventType, Transaction: &transaction}, nil
+}
+
+// NewCorrectionEvent replacing the transaction recorded by the target event.
+func NewCorrectionEvent(target uint64, transaction GoldPayment, reason string) LedgerEvent {
+	return LedgerEvent{
+		Type:        EventCorrection,
+		Transaction: &transaction,
+		Target:      target,
+		Reason:      reason,
+	}
+}
+
+// NewReversalEvent cancelling the transaction recorded by the target event.
+func NewReversalEvent(target uint64, reason string) LedgerEvent {
+	return LedgerEvent{Type: EventReversal, Target: target, Reason: reason}
+}
+
+// Validate the event has what its type needs.
+func (le LedgerEvent) Validate() error {
+	switch le.Type {
+	case EventSpend, EventBuy, EventSell, EventRefund:
+		if le.Transaction == nil {
+			return errors.Errorf("%s event has no transaction", le.Type)
+		}
+		if le.Target != 0 {
+			return errors.Errorf("%s event cannot have a target", le.Type)
+		}
+	case EventCorrection:
+		if le.Transaction == nil {
+			return errors.New("correction event has no transaction")
+		}
+		if le.Target == 0 {
+			return errors.New("correction event has no target")
+		}
+	case EventReversal:
+		if le.Transaction != nil {
+			return errors.New("reversal event cannot have a transaction")
+		}
+		if le.Target == 0 {
+			return errors.New("reversal event has no target")
+		}
+	default:
+		return errors.Errorf("unknown event type %q", le.Type)
+	}
+	return nil
+}
+
+// ReplayLedgerEvents in sequence order, returning the transactions that stand
+// once the corrections and reversals have been applied, in the order they
+// were first recorded. Corrections and reversals must target a transaction
+// that was recorded before them and has not been reversed.
+func ReplayLedgerEvents(events []LedgerEvent) ([]GoldPayment, error) {
+	ordered := make([]LedgerEvent, len(events))
+	copy(ordered, events)
+	sort.SliceStable(ordered, func(i, j int) bool {
+		return ordered[i].Sequence < ordered[j].Sequence
+	})
+
+	transactions := make(map[uint64]GoldPayment)
+	recorded := make([]uint64, 0, len(ordered))
+	for _, event := range ordered {
+		if err := event.Validate(); err != nil {
+			return nil, errors.Wrapf(err, "invalid event %d", event.Sequence)
+		}
+		switch event.Type {
+		case EventSpend, EventBuy, EventSell, EventRefund:
+			transactions[event.Sequence] = *event.Transaction
+			recorded = append(recorded, event.Sequence)
+			continue
+		}
+
+		if _, ok := transactions[event.Target]; !ok {
+			return nil, errors.Errorf("%s event %d targets event %d, which is not a standing transaction",
+				event.Type, event.Sequence, event.Target)
+		}
+		if event.Type == EventReversal {
+			delete(transactions, event.Target)
+		} else {
+			transactions[event.Target] = *event.Transaction
+		}
+	}
+
+	standing := make([]GoldPayment, 0, len(transactions))
+	for _, sequence := range recorded {
+		if transaction, ok := transactions[sequence]; ok {
+			standing = append(standing, transaction)
+		}
+	}
+	return standing, nil
+}
@@ -0,0 +1,124 @@
+package gold_sales
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReplayLedgerEvents(t *testing.T) {
+	spend := GoldPayment{
+		Spender:      Spender{FirstName: "Alayna", LastName: "Sparks", Email: "alayna.sparks@mailinator.com"},
+		Description:  GoldSpend,
+		Amount:       2629.16,
+		Rate:         47.0892,
+		FromCurrency: "GBP",
+		ToCurrency:   GoldCurrencyCode,
+		Date:         time.Date(2020, 3, 22, 13, 28, 0, 0, time.UTC),
+	}
+	corrected := spend
+	corrected.Amount = 262.916
+	sell := GoldPayment{Description: GoldSell, Amount: 2.91, FromCurrency: GoldCurrencyCode, ToCurrency: "GBP"}
+
+	recorded := func(sequence uint64, transaction GoldPayment) LedgerEvent {
+		event, err := NewTransactionEvent(transaction)
+		require.Nil(t, err)
+		event.Sequence = sequence
+		return event
+	}
+	correction := func(sequence, target uint64) LedgerEvent {
+		event := NewCorrectionEvent(target, corrected, "amount keyed in wrong")
+		event.Sequence = sequence
+		return event
+	}
+	reversal := func(sequence, target uint64) LedgerEvent {
+		event := NewReversalEvent(target, "charged back")
+		event.Sequence = sequence
+		return event
+	}
+
+	testCases := []struct {
+		Name          string
+		Events        []LedgerEvent
+		Expected      []GoldPayment
+		ErrorExpected bool
+	}{
+		{
+			"Transactions in the order recorded",
+			[]LedgerEvent{recorded(2, sell), recorded(1, spend)},
+			[]GoldPayment{spend, sell},
+			false,
+		},
+		{
+			"Correction replaces the transaction in place",
+			[]LedgerEvent{recorded(1, spend), recorded(2, sell), correction(3, 1)},
+			[]GoldPayment{corrected, sell},
+			false,
+		},
+		{
+			"Reversal removes the transaction",
+			[]LedgerEvent{recorded(1, spend), recorded(2, sell), reversal(3, 1)},
+			[]GoldPayment{sell},
+			false,
+		},
+		{
+			"Corrected transaction can be reversed",
+			[]LedgerEvent{recorded(1, spend), correction(2, 1), reversal(3, 1)},
+			[]GoldPayment{},
+			false,
+		},
+		{
+			"Reversal of a reversed transaction",
+			[]LedgerEvent{recorded(1, spend), reversal(2, 1), reversal(3, 1)},
+			nil,
+			true,
+		},
+		{
+			"Correction of a later event",
+			[]LedgerEvent{correction(1, 2), recorded(2, spend)},
+			nil,
+			true,
+		},
+		{
+			"Reversal targeting a reversal",
+			[]LedgerEvent{recorded(1, spend), reversal(2, 1), reversal(3, 2)},
+			nil,
+			true,
+		},
+		{
+			"Spend without a transaction",
+			[]LedgerEvent{{Sequence: 1, Type: EventSpend}},
+			nil,
+			true,
+		},
+		{
+			"Unknown event type",
+			[]LedgerEvent{{Sequence: 1, Type: "transfer", Transaction: &spend}},
+			nil,
+			true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			transactions, err := ReplayLedgerEvents(tc.Events)
+			if tc.ErrorExpected {
+				assert.NotNil(t, err, "expected error")
+				return
+			}
+			require.Nil(t, err, "unexpected error")
+			assert.Equal(t, tc.Expected, transactions)
+		})
+	}
+}
+
+func TestNewTransactionEvent(t *testing.T) {
+	event, err := NewTransactionEvent(GoldPayment{Description: GoldBuy})
+	require.Nil(t, err)
+	assert.Equal(t, EventBuy, event.Type)
+
+	_, err = NewTransactionEvent(GoldPayment{Description: "TOP UP"})
+	assert.NotNil(t, err, "expected error for an unknown description")
+}
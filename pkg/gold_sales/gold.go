@@ -1,6 +1,13 @@
 package gold_sales
 
-import "time"
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
 
 // GoldPayment details for a Gold spend.
 type GoldPayment struct {
@@ -12,8 +19,69 @@ type GoldPayment struct {
 	FromCurrency string    `json:"fromCurrency"`
 	Date         time.Time `json:"date"`
 	GramWeight   float64   `json:"gramWeight"`
+	// ID of the transaction, from the ledger or derived by TransactionID.
+	ID string `json:"id,omitempty"`
+	// Reference of the transaction in the ledger it came from, if it has one.
+	Reference string `json:"reference,omitempty"`
+	// OriginalReference of the spend a refund reverses, if it is known.
+	OriginalReference string `json:"originalReference,omitempty"`
 }
 
 const GoldSpend = "CARD SPEND"
 
+// GoldRefund of a card spend, including charge backs.
+const GoldRefund = "CARD REFUND"
+
 const GoldCurrencyCode = "GGM"
+
+// IsGoldSpend reports whether the transaction is a card spend paid in gold.
+func (gp GoldPayment) IsGoldSpend() bool {
+	return gp.Description == GoldSpend && gp.ToCurrency == GoldCurrencyCode && gp.Amount >= 0
+}
+
+// IsGoldRefund reports whether the transaction reverses a card spend paid in
+// gold, either as a card refund or as a card spend with a negative amount.
+func (gp GoldPayment) IsGoldRefund() bool {
+	if gp.ToCurrency != GoldCurrencyCode {
+		return false
+	}
+	return gp.Description == GoldRefund || (gp.Description == GoldSpend && gp.Amount < 0)
+}
+
+// AsGoldSpend returns the transaction as it counts towards the gold spend
+// totals. Spends count as they are and refunds with a negative amount and
+// weight, so adding them up nets the refunds against the spends. It returns
+// false for any other transaction.
+func (gp GoldPayment) AsGoldSpend() (GoldPayment, bool) {
+	if gp.IsGoldRefund() {
+		gp.Amount = -math.Abs(gp.Amount)
+		gp.GramWeight = -math.Abs(gp.GramWeight)
+		return gp, true
+	}
+	return gp, gp.IsGoldSpend()
+}
+
+// TransactionID of the payment: its ID if it has one, its reference in the
+// ledger if not, and otherwise a hash of its contents, so the same
+// transaction read twice has the same ID.
+func (gp GoldPayment) TransactionID() string {
+	if gp.ID != "" {
+		return gp.ID
+	}
+	if gp.Reference != "" {
+		return gp.Reference
+	}
+	fields := []string{
+		gp.Spender.FirstName,
+		gp.Spender.LastName,
+		gp.Spender.Email,
+		gp.Description,
+		strconv.FormatFloat(gp.Amount, 'f', -1, 64),
+		strconv.FormatFloat(gp.Rate, 'f', -1, 64),
+		gp.FromCurrency,
+		gp.ToCurrency,
+		gp.Date.UTC().Format(time.RFC3339),
+	}
+	hash := sha256.Sum256([]byte(strings.Join(fields, "\x1f")))
+	return "sha256:" + hex.EncodeToString(hash[:16])
+}
@@ -0,0 +1,39 @@
+package gold_sales
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTransactionID(t *testing.T) {
+	payment := GoldPayment{
+		Spender:      Spender{FirstName: "Alayna", LastName: "Sparks", Email: "alayna.sparks@mailinator.com"},
+		Description:  GoldSpend,
+		Amount:       2629.16,
+		Rate:         47.0892,
+		FromCurrency: "GBP",
+		ToCurrency:   GoldCurrencyCode,
+		Date:         time.Date(2020, 3, 22, 13, 28, 0, 0, time.UTC),
+	}
+	contentID := payment.TransactionID()
+	assert.Regexp(t, "^sha256:[0-9a-f]{32}$", contentID)
+
+	again := payment
+	again.Date = payment.Date.In(time.FixedZone("BST", 3600))
+	again.GramWeight = 55.83
+	assert.Equal(t, contentID, again.TransactionID(),
+		"the same transaction has the same ID however it was read")
+
+	changed := payment
+	changed.Amount = 2629.17
+	assert.NotEqual(t, contentID, changed.TransactionID())
+
+	referenced := payment
+	referenced.Reference = "T1"
+	assert.Equal(t, "T1", referenced.TransactionID())
+
+	referenced.ID = "ledger-1"
+	assert.Equal(t, "ledger-1", referenced.TransactionID())
+}
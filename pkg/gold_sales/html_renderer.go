@@ -0,0 +1,234 @@
+package gold_sales
+
+import (
+	"html/template"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Dimensions of the inline SVG charts in the HTML report.
+const (
+	chartWidth      = 640.0
+	chartLabelWidth = 180.0
+	chartBarHeight  = 24.0
+	chartBarGap     = 8.0
+	trendHeight     = 220.0
+	trendPadding    = 40.0
+)
+
+// htmlReportMonth is a month of the report with its chart laid out.
+type htmlReportMonth struct {
+	MonthTopSpenders
+	ChartWidth  float64
+	ChartHeight float64
+	Bars        []htmlBar
+}
+
+type htmlBar struct {
+	Label      string
+	Value      TotalSpend
+	X          float64
+	Y          float64
+	Height     float64
+	TextY      float64
+	Width      float64
+	ValueX     float64
+	LabelWidth float64
+}
+
+type htmlTrendPoint struct {
+	Month ReportMonth
+	Value TotalSpend
+	X     float64
+	Y     float64
+}
+
+type htmlReport struct {
+	GeneratedAt time.Time
+	Months      []htmlReportMonth
+	Trend       []htmlTrendPoint
+	TrendLine   string
+	TrendWidth  float64
+	TrendHeight float64
+	TrendBase   float64
+	Provenance  *ReportProvenance
+}
+
+// renderHTML as a single static page with a table and a bar chart per month
+// and a trend line of the total monthly gold spend, followed by the provenance
+// of the report when it is known. Everything is inline so the file can be
+// emailed or archived on its own.
+func renderHTML(w io.Writer, report *MonthlyTopSpendersAnalysisReport) error {
+	view := htmlReport{
+		GeneratedAt: time.Now().UTC(),
+		Months:      make([]htmlReportMonth, 0),
+		TrendWidth:  chartWidth,
+		TrendHeight: trendHeight,
+		TrendBase:   trendHeight - trendPadding,
+		Provenance:  report.Provenance(),
+	}
+	if view.Provenance != nil {
+		view.GeneratedAt = view.Provenance.GeneratedAt
+	}
+
+	months := report.Months()
+	for _, month := range months {
+		view.Months = append(view.Months, layoutBars(month))
+	}
+	view.Trend = layoutTrend(months)
+
+	points := make([]string, len(view.Trend))
+	for i, point := range view.Trend {
+		points[i] = formatCoord(point.X) + "," + formatCoord(point.Y)
+	}
+	view.TrendLine = strings.Join(points, " ")
+
+	return htmlReportTemplate.Execute(w, view)
+}
+
+func layoutBars(month MonthTopSpenders) htmlReportMonth {
+	var maxSpend TotalSpend
+	for _, spend := range month.Spenders {
+		if spend.TotalSpend > maxSpend {
+			maxSpend = spend.TotalSpend
+		}
+	}
+
+	barSpace := chartWidth - chartLabelWidth - 80
+	laidOut := htmlReportMonth{
+		MonthTopSpenders: month,
+		ChartWidth:       chartWidth,
+		ChartHeight: float64(len(month.Spenders))*(chartBarHeight+chartBarGap) +
+			chartBarGap,
+		Bars: make([]htmlBar, 0, len(month.Spenders)),
+	}
+	for i, spend := range month.Spenders {
+		width := 0.0
+		if maxSpend > 0 {
+			width = roundCoord(barSpace * float64(spend.TotalSpend/maxSpend))
+		}
+		y := chartBarGap + float64(i)*(chartBarHeight+chartBarGap)
+		laidOut.Bars = append(laidOut.Bars, htmlBar{
+			Label:      spend.Spender.FirstName + " " + spend.Spender.LastName,
+			Value:      spend.TotalSpend,
+			X:          chartLabelWidth,
+			Y:          y,
+			Height:     chartBarHeight,
+			TextY:      y + chartBarHeight*0.7,
+			Width:      width,
+			ValueX:     chartLabelWidth + width + 6,
+			LabelWidth: chartLabelWidth - 8,
+		})
+	}
+	return laidOut
+}
+
+// layoutTrend of the monthly totals, oldest month on the left.
+func layoutTrend(months []MonthTopSpenders) []htmlTrendPoint {
+	points := make([]htmlTrendPoint, 0, len(months))
+	if len(months) == 0 {
+		return points
+	}
+
+	var maxTotal TotalSpend
+	for _, month := range months {
+		if month.MonthTotal > maxTotal {
+			maxTotal = month.MonthTotal
+		}
+	}
+
+	step := 0.0
+	if len(months) > 1 {
+		step = (chartWidth - 2*trendPadding) / float64(len(months)-1)
+	}
+	plotHeight := trendHeight - 2*trendPadding
+	for i := len(months) - 1; i >= 0; i-- {
+		y := trendHeight - trendPadding
+		if maxTotal > 0 {
+			y = y - plotHeight*float64(months[i].MonthTotal/maxTotal)
+		}
+		points = append(points, htmlTrendPoint{
+			Month: months[i].Month,
+			Value: months[i].MonthTotal,
+			X:     trendPadding + step*float64(len(points)),
+			Y:     roundCoord(y),
+		})
+	}
+	return points
+}
+
+// roundCoord to a tenth of a pixel to keep the SVG compact.
+func roundCoord(value float64) float64 {
+	return math.Round(value*10) / 10
+}
+
+func formatCoord(value float64) string {
+	return strconv.FormatFloat(value, 'f', 1, 64)
+}
+
+var htmlReportTemplate = template.Must(template.New("html_report").Funcs(
+	template.FuncMap{"rank": func(index int) int { return index + 1 }},
+).Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>Monthly top gold spenders</title>
+<style>
+body { font-family: Helvetica, Arial, sans-serif; color: #222; margin: 2em; }
+h1 { font-size: 1.6em; }
+h2 { font-size: 1.2em; margin-top: 2em; border-bottom: 1px solid #ccc; }
+table { border-collapse: collapse; margin: 0.5em 0 1em 0; }
+th, td { padding: 4px 12px; border-bottom: 1px solid #eee; text-align: left; }
+td.number, th.number { text-align: right; }
+svg text { font-size: 12px; fill: #222; }
+.bar { fill: #c9a227; }
+.trend { fill: none; stroke: #c9a227; stroke-width: 2; }
+.point { fill: #8a6d0b; }
+.axis { stroke: #999; }
+.muted { color: #777; font-size: 0.9em; }
+</style>
+</head>
+<body>
+<h1>Monthly top gold spenders</h1>
+<p class="muted">Generated {{.GeneratedAt.Format "02 Jan 2006 15:04 MST"}}. Spend is in grams of gold.</p>
+{{if .Trend}}
+<h2>Total gold card spend by month</h2>
+<svg width="{{.TrendWidth}}" height="{{.TrendHeight}}" role="img" aria-label="Total gold card spend by month">
+<line class="axis" x1="0" y1="{{.TrendBase}}" x2="{{.TrendWidth}}" y2="{{.TrendBase}}"/>
+<polyline class="trend" points="{{.TrendLine}}"/>
+{{range .Trend}}<circle class="point" cx="{{.X}}" cy="{{.Y}}" r="4"><title>{{.Month}}: {{.Value}}g</title></circle>
+<text x="{{.X}}" y="{{$.TrendHeight}}" dy="-12" text-anchor="middle">{{.Month}}</text>
+<text x="{{.X}}" y="{{.Y}}" dy="-10" text-anchor="middle">{{.Value}}</text>
+{{end}}</svg>
+{{end}}
+{{range .Months}}
+<h2>{{.Month}}</h2>
+<table>
+<thead><tr><th>Rank</th><th>Name</th><th>Email</th><th class="number">Spend (g)</th></tr></thead>
+<tbody>
+{{range $i, $s := .Spenders}}<tr><td>{{rank $i}}</td><td>{{$s.Spender.FirstName}} {{$s.Spender.LastName}}</td><td>{{$s.Spender.Email}}</td><td class="number">{{$s.TotalSpend}}</td></tr>
+{{end}}</tbody>
+<tfoot><tr><td></td><td>All spenders</td><td></td><td class="number">{{.MonthTotal}}</td></tr></tfoot>
+</table>
+{{if .Bars}}<svg width="{{.ChartWidth}}" height="{{.ChartHeight}}" role="img" aria-label="Top spenders for {{.Month}}">
+{{range .Bars}}<text x="{{.LabelWidth}}" y="{{.TextY}}" text-anchor="end">{{.Label}}</text>
+<rect class="bar" x="{{.X}}" y="{{.Y}}" width="{{.Width}}" height="{{.Height}}"/>
+<text x="{{.ValueX}}" y="{{.TextY}}">{{.Value}}</text>
+{{end}}</svg>{{end}}
+{{end}}
+{{with .Provenance}}
+<h2>Provenance</h2>
+<p class="muted">Produced by gold_sales_report {{.ToolVersion}} with {{.Parameters.NumTopSpenders}} top spenders over {{.Parameters.NumMonths}} months ranked by {{.Parameters.RankBy}}{{if .Parameters.AsOf}}, as of {{.Parameters.AsOf}}{{end}}.</p>
+<table>
+<thead><tr><th>Input</th><th>SHA-256</th><th class="number">Rows</th><th class="number">Gold spends</th><th class="number">Rejected</th></tr></thead>
+<tbody>
+{{range .Inputs}}<tr><td>{{.Filename}}</td><td><code>{{.SHA256}}</code></td><td class="number">{{.Rows}}</td><td class="number">{{.GoldPayments}}</td><td class="number">{{.Rejected}}</td></tr>
+{{end}}</tbody>
+</table>
+{{end}}
+</body>
+</html>
+`))
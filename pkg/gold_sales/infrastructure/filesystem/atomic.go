@@ -0,0 +1,49 @@
+package filesystem
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+)
+
+// WriteAtomically writes the file through a temporary file in the same
+// directory which is renamed into place once write has succeeded, so a
+// partially written file never appears under the filename.
+func WriteAtomically(filename string, write func(w io.Writer) error) error {
+	dir, base := filepath.Split(filename)
+	if dir == "" {
+		dir = "."
+	}
+	tmpFile, err := ioutil.TempFile(dir, "."+base+".tmp-")
+	if err != nil {
+		return errors.Wrap(err, "failed to create temporary file")
+	}
+	tmpName := tmpFile.Name()
+
+	if err := write(tmpFile); err != nil {
+		tmpFile.Close()
+		os.Remove(tmpName)
+		return err
+	}
+	if err := tmpFile.Sync(); err != nil {
+		tmpFile.Close()
+		os.Remove(tmpName)
+		return errors.Wrap(err, "failed to sync temporary file")
+	}
+	if err := tmpFile.Close(); err != nil {
+		os.Remove(tmpName)
+		return errors.Wrap(err, "failed to close temporary file")
+	}
+	if err := os.Chmod(tmpName, 0644); err != nil {
+		os.Remove(tmpName)
+		return err
+	}
+	if err := os.Rename(tmpName, filename); err != nil {
+		os.Remove(tmpName)
+		return errors.Wrap(err, "failed to move file into place")
+	}
+	return nil
+}
@@ -0,0 +1,39 @@
+package filesystem
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteAtomically(t *testing.T) {
+	dir, err := ioutil.TempDir("", "atomic")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "output.csv")
+
+	require.Nil(t, WriteAtomically(filename, func(w io.Writer) error {
+		_, err := io.WriteString(w, "first")
+		return err
+	}))
+
+	err = WriteAtomically(filename, func(w io.Writer) error {
+		_, _ = io.WriteString(w, "half written")
+		return errors.New("render failed")
+	})
+	assert.NotNil(t, err, "expected error from write")
+
+	content, err := ioutil.ReadFile(filename)
+	require.Nil(t, err)
+	assert.Equal(t, "first", string(content), "failed write must leave the old file")
+
+	entries, err := ioutil.ReadDir(dir)
+	require.Nil(t, err)
+	assert.Len(t, entries, 1, "temporary files must be removed")
+}
@@ -0,0 +1,60 @@
+package filesystem
+
+import (
+	"os"
+	"syscall"
+
+	"github.com/pkg/errors"
+)
+
+// inotifyEvents that mean a file in the directory may have changed.
+const inotifyEvents = syscall.IN_CREATE | syscall.IN_MODIFY | syscall.IN_CLOSE_WRITE |
+	syscall.IN_MOVED_TO | syscall.IN_MOVED_FROM | syscall.IN_DELETE | syscall.IN_ATTRIB
+
+// inotify notifier for the directory. The events only wake the watcher, which
+// scans the directory to find out what changed.
+type inotify struct {
+	file   *os.File
+	events chan struct{}
+}
+
+func newNotifier(dir string) (notifier, error) {
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC | syscall.IN_NONBLOCK)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to start inotify")
+	}
+	if _, err := syscall.InotifyAddWatch(fd, dir, inotifyEvents); err != nil {
+		syscall.Close(fd)
+		return nil, errors.Wrap(err, "failed to watch directory")
+	}
+
+	// A non blocking descriptor goes through the runtime poller, so closing
+	// the file stops the read below.
+	n := &inotify{
+		file:   os.NewFile(uintptr(fd), "inotify"),
+		events: make(chan struct{}, 1),
+	}
+	go n.read()
+	return n, nil
+}
+
+func (n *inotify) read() {
+	buf := make([]byte, 4096)
+	for {
+		if _, err := n.file.Read(buf); err != nil {
+			return
+		}
+		select {
+		case n.events <- struct{}{}:
+		default:
+		}
+	}
+}
+
+func (n *inotify) Events() <-chan struct{} {
+	return n.events
+}
+
+func (n *inotify) Close() error {
+	return n.file.Close()
+}
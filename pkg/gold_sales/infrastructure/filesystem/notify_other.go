@@ -0,0 +1,11 @@
+//go:build !linux
+// +build !linux
+
+package filesystem
+
+import "github.com/pkg/errors"
+
+// newNotifier is only available on Linux, other platforms poll.
+func newNotifier(dir string) (notifier, error) {
+	return nil, errors.New("file notifications are not supported on this platform")
+}
@@ -0,0 +1,219 @@
+package filesystem
+
+import (
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// WatchOptions for a Watcher.
+type WatchOptions struct {
+	// PollInterval between scans of the directory. File notifications wake
+	// the watcher sooner when they are available.
+	PollInterval time.Duration
+	// Settle is how long a file must be left unchanged before it is
+	// reported, so files that are still being written are not picked up.
+	Settle time.Duration
+	// Poll only, without file notifications.
+	Poll bool
+	// Match the files to watch by their path, every file when nil.
+	Match func(filename string) bool
+}
+
+// DefaultWatchOptions poll every 5 seconds and wait for files to be left
+// alone for 2 seconds.
+func DefaultWatchOptions() WatchOptions {
+	return WatchOptions{
+		PollInterval: 5 * time.Second,
+		Settle:       2 * time.Second,
+	}
+}
+
+// Watcher of a directory that reports files once they have been created,
+// changed or removed. Files are found by scanning the directory, woken by
+// file notifications where the platform has them or polling when it does not.
+type Watcher struct {
+	dir      string
+	options  WatchOptions
+	notifier notifier
+	seen     map[string]fileState
+	pending  map[string]pendingFile
+}
+
+// fileState compared between scans to tell whether a file changed.
+type fileState struct {
+	size    int64
+	modTime int64
+}
+
+// pendingFile that has changed but not yet settled.
+type pendingFile struct {
+	state fileState
+	since time.Time
+}
+
+// notifier wakes the watcher when something in the directory changes.
+type notifier interface {
+	Events() <-chan struct{}
+	Close() error
+}
+
+// NewWatcher of the directory. Every matching file already in the directory
+// is reported once it has settled.
+func NewWatcher(dir string, options WatchOptions) (*Watcher, error) {
+	if _, err := ioutil.ReadDir(dir); err != nil {
+		return nil, errors.Wrap(err, "failed to read watched directory")
+	}
+	if options.PollInterval <= 0 {
+		options.PollInterval = DefaultWatchOptions().PollInterval
+	}
+	watcher := &Watcher{
+		dir:     dir,
+		options: options,
+		seen:    make(map[string]fileState),
+		pending: make(map[string]pendingFile),
+	}
+	if !options.Poll {
+		// Polling is the fallback when notifications are unavailable.
+		if n, err := newNotifier(dir); err == nil {
+			watcher.notifier = n
+		}
+	}
+	return watcher, nil
+}
+
+// Polling reports whether the watcher relies on polling alone.
+func (w *Watcher) Polling() bool {
+	return w.notifier == nil
+}
+
+// Close the file notifications.
+func (w *Watcher) Close() error {
+	if w.notifier == nil {
+		return nil
+	}
+	return w.notifier.Close()
+}
+
+// Files in the directory that match, sorted by name.
+func (w *Watcher) Files() ([]string, error) {
+	states, err := w.states()
+	if err != nil {
+		return nil, err
+	}
+	filenames := make([]string, 0, len(states))
+	for filename := range states {
+		filenames = append(filenames, filename)
+	}
+	sort.Strings(filenames)
+	return filenames, nil
+}
+
+// Watch the directory until the context is done, calling changed with the
+// files that were created, changed or removed. Failing to read the directory
+// is passed to failed and the directory is read again at the next poll.
+func (w *Watcher) Watch(
+	ctx context.Context,
+	changed func(filenames []string),
+	failed func(err error),
+) {
+	var events <-chan struct{}
+	if w.notifier != nil {
+		events = w.notifier.Events()
+	}
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-events:
+			if !timer.Stop() {
+				select {
+				case <-timer.C:
+				default:
+				}
+			}
+		case <-timer.C:
+		}
+
+		filenames, err := w.scan(time.Now())
+		if err != nil {
+			failed(err)
+		} else if len(filenames) > 0 {
+			changed(filenames)
+		}
+		timer.Reset(w.nextScan())
+	}
+}
+
+// nextScan is sooner than the poll interval while files are settling.
+func (w *Watcher) nextScan() time.Duration {
+	if len(w.pending) > 0 && w.options.Settle < w.options.PollInterval {
+		return w.options.Settle
+	}
+	return w.options.PollInterval
+}
+
+// scan the directory at now, returning the files removed since the last scan
+// and those that changed and have been left alone for the settle time.
+func (w *Watcher) scan(now time.Time) ([]string, error) {
+	states, err := w.states()
+	if err != nil {
+		return nil, err
+	}
+
+	changed := make([]string, 0)
+	for filename := range w.seen {
+		if _, ok := states[filename]; !ok {
+			delete(w.seen, filename)
+			changed = append(changed, filename)
+		}
+	}
+	for filename := range w.pending {
+		if _, ok := states[filename]; !ok {
+			delete(w.pending, filename)
+		}
+	}
+	for filename, state := range states {
+		if seen, ok := w.seen[filename]; ok && seen == state {
+			delete(w.pending, filename)
+			continue
+		}
+		pending, ok := w.pending[filename]
+		if !ok || pending.state != state {
+			w.pending[filename] = pendingFile{state: state, since: now}
+			continue
+		}
+		if now.Sub(pending.since) >= w.options.Settle {
+			delete(w.pending, filename)
+			w.seen[filename] = state
+			changed = append(changed, filename)
+		}
+	}
+	sort.Strings(changed)
+	return changed, nil
+}
+
+// states of the matching regular files in the directory.
+func (w *Watcher) states() (map[string]fileState, error) {
+	infos, err := ioutil.ReadDir(w.dir)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read watched directory")
+	}
+	states := make(map[string]fileState, len(infos))
+	for _, info := range infos {
+		filename := filepath.Join(w.dir, info.Name())
+		if !info.Mode().IsRegular() ||
+			(w.options.Match != nil && !w.options.Match(filename)) {
+			continue
+		}
+		states[filename] = fileState{size: info.Size(), modTime: info.ModTime().UnixNano()}
+	}
+	return states, nil
+}
@@ -0,0 +1,112 @@
+package filesystem
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWatcherScanWaitsForFilesToSettle(t *testing.T) {
+	dir, err := ioutil.TempDir("", "watch")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+	ledger := filepath.Join(dir, "ledger.csv")
+	require.Nil(t, ioutil.WriteFile(filepath.Join(dir, "notes.txt"), []byte("ignored"), 0644))
+
+	watcher, err := NewWatcher(dir, WatchOptions{
+		Settle: time.Minute,
+		Poll:   true,
+		Match:  func(filename string) bool { return strings.HasSuffix(filename, ".csv") },
+	})
+	require.Nil(t, err)
+	start := time.Now()
+
+	require.Nil(t, ioutil.WriteFile(ledger, []byte("first_name"), 0644))
+	changed, err := watcher.scan(start)
+	require.Nil(t, err)
+	assert.Empty(t, changed, "a new file is not reported until it settles")
+
+	require.Nil(t, ioutil.WriteFile(ledger, []byte("first_name,last_name"), 0644))
+	changed, err = watcher.scan(start.Add(50 * time.Second))
+	require.Nil(t, err)
+	assert.Empty(t, changed, "a write restarts the settle time")
+
+	changed, err = watcher.scan(start.Add(100 * time.Second))
+	require.Nil(t, err)
+	assert.Empty(t, changed)
+	changed, err = watcher.scan(start.Add(111 * time.Second))
+	require.Nil(t, err)
+	assert.Equal(t, []string{ledger}, changed)
+
+	changed, err = watcher.scan(start.Add(200 * time.Second))
+	require.Nil(t, err)
+	assert.Empty(t, changed, "an unchanged file is only reported once")
+
+	files, err := watcher.Files()
+	require.Nil(t, err)
+	assert.Equal(t, []string{ledger}, files)
+
+	require.Nil(t, os.Remove(ledger))
+	changed, err = watcher.scan(start.Add(201 * time.Second))
+	require.Nil(t, err)
+	assert.Equal(t, []string{ledger}, changed, "a removed file is reported straight away")
+}
+
+func TestWatcherWatch(t *testing.T) {
+	testCases := []struct {
+		Name string
+		Poll bool
+	}{
+		{"Polling", true},
+		{"Notifications", false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "watch")
+			require.Nil(t, err)
+			defer os.RemoveAll(dir)
+
+			pollInterval := 20 * time.Millisecond
+			if !tc.Poll {
+				// Long enough that only a notification wakes the watcher.
+				pollInterval = time.Hour
+			}
+			watcher, err := NewWatcher(dir, WatchOptions{
+				PollInterval: pollInterval,
+				Settle:       20 * time.Millisecond,
+				Poll:         tc.Poll,
+			})
+			require.Nil(t, err)
+			defer watcher.Close()
+			if !tc.Poll && watcher.Polling() {
+				t.Skip("file notifications are not available")
+			}
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			changes := make(chan []string, 1)
+			go watcher.Watch(ctx, func(filenames []string) {
+				changes <- filenames
+			}, func(err error) {
+				t.Errorf("unexpected error: %s", err)
+			})
+
+			ledger := filepath.Join(dir, "ledger.csv")
+			require.Nil(t, ioutil.WriteFile(ledger, []byte("first_name"), 0644))
+			select {
+			case changed := <-changes:
+				assert.Equal(t, []string{ledger}, changed)
+			case <-time.After(5 * time.Second):
+				t.Fatal("change was not reported")
+			}
+		})
+	}
+}
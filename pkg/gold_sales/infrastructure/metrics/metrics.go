@@ -0,0 +1,288 @@
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/JonPulfer/gold_sales/pkg/gold_sales/infrastructure/filesystem"
+)
+
+// DefaultDurationBuckets in seconds for timing histograms.
+var DefaultDurationBuckets = []float64{
+	0.001, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// DefaultSizeBuckets in bytes for size histograms.
+var DefaultSizeBuckets = []float64{
+	256, 1024, 4096, 16384, 65536, 262144, 1048576, 4194304}
+
+// Registry holds the metrics for a run and exposes them in the Prometheus
+// text format.
+type Registry struct {
+	mu         sync.Mutex
+	collectors []collector
+	names      map[string]bool
+}
+
+func NewRegistry() *Registry {
+	return &Registry{
+		collectors: make([]collector, 0),
+		names:      make(map[string]bool),
+	}
+}
+
+// collector is implemented by each type of metric the Registry can hold.
+type collector interface {
+	name() string
+	write(w *bufio.Writer)
+}
+
+func (r *Registry) register(c collector) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.names[c.name()] {
+		panic("metrics: duplicate metric name " + c.name())
+	}
+	r.names[c.name()] = true
+	r.collectors = append(r.collectors, c)
+}
+
+// Counter registers a new Counter with the label names given.
+func (r *Registry) Counter(name, help string, labelNames ...string) *Counter {
+	c := &Counter{
+		metricName: name,
+		help:       help,
+		labelNames: labelNames,
+		series:     make(map[string]*counterSeries),
+	}
+	r.register(c)
+	return c
+}
+
+// Histogram registers a new Histogram with the upper bounds given.
+func (r *Registry) Histogram(name, help string, buckets []float64) *Histogram {
+	upperBounds := make([]float64, len(buckets))
+	copy(upperBounds, buckets)
+	sort.Float64s(upperBounds)
+	h := &Histogram{
+		metricName:  name,
+		help:        help,
+		upperBounds: upperBounds,
+		counts:      make([]uint64, len(upperBounds)),
+	}
+	r.register(h)
+	return h
+}
+
+// WriteTo the io.Writer all the registered metrics in the Prometheus text
+// exposition format.
+func (r *Registry) WriteTo(w io.Writer) (int64, error) {
+	r.mu.Lock()
+	collectors := make([]collector, len(r.collectors))
+	copy(collectors, r.collectors)
+	r.mu.Unlock()
+
+	sort.Slice(collectors, func(i, j int) bool {
+		return collectors[i].name() < collectors[j].name()
+	})
+
+	counting := &countingWriter{w: w}
+	buf := bufio.NewWriter(counting)
+	for _, c := range collectors {
+		c.write(buf)
+	}
+	err := buf.Flush()
+	return counting.n, err
+}
+
+// WriteFile with the current state of the metrics, suitable for the node
+// exporter textfile collector. The file is replaced atomically, so the
+// collector never reads it half written.
+func (r *Registry) WriteFile(filename string) error {
+	return filesystem.WriteAtomically(filename, func(w io.Writer) error {
+		_, err := r.WriteTo(w)
+		return err
+	})
+}
+
+// Handler serving the metrics for a Prometheus scrape.
+func (r *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		_, _ = r.WriteTo(w)
+	})
+}
+
+// Counter that only ever increases, optionally partitioned by labels.
+type Counter struct {
+	mu         sync.Mutex
+	metricName string
+	help       string
+	labelNames []string
+	series     map[string]*counterSeries
+}
+
+type counterSeries struct {
+	labelValues []string
+	value       float64
+}
+
+// Inc the counter for the label values by one.
+func (c *Counter) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+// Add to the counter for the label values. Negative values are ignored.
+func (c *Counter) Add(value float64, labelValues ...string) {
+	if c == nil || value < 0 {
+		return
+	}
+	if len(labelValues) != len(c.labelNames) {
+		panic(fmt.Sprintf("metrics: %s expects %d label values, got %d",
+			c.metricName, len(c.labelNames), len(labelValues)))
+	}
+	key := strings.Join(labelValues, "\xff")
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.series[key]; !ok {
+		c.series[key] = &counterSeries{labelValues: labelValues}
+	}
+	c.series[key].value = c.series[key].value + value
+}
+
+// Value of the counter for the label values.
+func (c *Counter) Value(labelValues ...string) float64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if series, ok := c.series[strings.Join(labelValues, "\xff")]; ok {
+		return series.value
+	}
+	return 0
+}
+
+func (c *Counter) name() string {
+	return c.metricName
+}
+
+func (c *Counter) write(w *bufio.Writer) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	writeHeader(w, c.metricName, c.help, "counter")
+	if len(c.labelNames) == 0 && len(c.series) == 0 {
+		fmt.Fprintf(w, "%s 0\n", c.metricName)
+		return
+	}
+	keys := make([]string, 0, len(c.series))
+	for key := range c.series {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		series := c.series[key]
+		fmt.Fprintf(w, "%s%s %s\n", c.metricName,
+			formatLabels(c.labelNames, series.labelValues),
+			formatValue(series.value))
+	}
+}
+
+// Histogram of observations counted into cumulative buckets.
+type Histogram struct {
+	mu          sync.Mutex
+	metricName  string
+	help        string
+	upperBounds []float64
+	counts      []uint64
+	count       uint64
+	sum         float64
+}
+
+// Observe a value in the Histogram.
+func (h *Histogram) Observe(value float64) {
+	if h == nil {
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for i, upperBound := range h.upperBounds {
+		if value <= upperBound {
+			h.counts[i]++
+		}
+	}
+	h.count++
+	h.sum = h.sum + value
+}
+
+// ObserveSince the start time as a duration in seconds.
+func (h *Histogram) ObserveSince(start time.Time) {
+	h.Observe(time.Since(start).Seconds())
+}
+
+// Count of the observations made.
+func (h *Histogram) Count() uint64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.count
+}
+
+func (h *Histogram) name() string {
+	return h.metricName
+}
+
+func (h *Histogram) write(w *bufio.Writer) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	writeHeader(w, h.metricName, h.help, "histogram")
+	for i, upperBound := range h.upperBounds {
+		fmt.Fprintf(w, "%s_bucket{le=\"%s\"} %d\n", h.metricName,
+			formatValue(upperBound), h.counts[i])
+	}
+	fmt.Fprintf(w, "%s_bucket{le=\"+Inf\"} %d\n", h.metricName, h.count)
+	fmt.Fprintf(w, "%s_sum %s\n", h.metricName, formatValue(h.sum))
+	fmt.Fprintf(w, "%s_count %d\n", h.metricName, h.count)
+}
+
+func writeHeader(w *bufio.Writer, name, help, metricType string) {
+	help = strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(help)
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, metricType)
+}
+
+func formatLabels(names, values []string) string {
+	if len(names) == 0 {
+		return ""
+	}
+	escape := strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+	pairs := make([]string, len(names))
+	for i, name := range names {
+		pairs[i] = name + `="` + escape.Replace(values[i]) + `"`
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func formatValue(value float64) string {
+	if math.IsInf(value, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
+
+// countingWriter keeps track of the bytes written through it.
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	cw.n = cw.n + int64(n)
+	return n, err
+}
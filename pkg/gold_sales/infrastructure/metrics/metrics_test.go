@@ -0,0 +1,83 @@
+package metrics
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRegistryWritesTextFormat(t *testing.T) {
+	registry := NewRegistry()
+	rejected := registry.Counter("rows_rejected_total", "Rows rejected.", "reason")
+	duration := registry.Histogram("parse_duration_seconds", "Parse time.",
+		[]float64{0.5, 0.1})
+
+	rejected.Inc("invalid_rate")
+	rejected.Add(2, "invalid_amount")
+	rejected.Inc(`quote"d`)
+	duration.Observe(0.2)
+	duration.Observe(5)
+
+	var buf bytes.Buffer
+	_, err := registry.WriteTo(&buf)
+	require.Nil(t, err, "unexpected error")
+
+	expected := `# HELP parse_duration_seconds Parse time.
+# TYPE parse_duration_seconds histogram
+parse_duration_seconds_bucket{le="0.1"} 0
+parse_duration_seconds_bucket{le="0.5"} 1
+parse_duration_seconds_bucket{le="+Inf"} 2
+parse_duration_seconds_sum 5.2
+parse_duration_seconds_count 2
+# HELP rows_rejected_total Rows rejected.
+# TYPE rows_rejected_total counter
+rows_rejected_total{reason="invalid_amount"} 2
+rows_rejected_total{reason="invalid_rate"} 1
+rows_rejected_total{reason="quote\"d"} 1
+`
+	assert.Equal(t, expected, buf.String())
+}
+
+func TestRegistryWriteFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "metrics")
+	require.Nil(t, err)
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	filename := filepath.Join(dir, "gold_sales.prom")
+	require.Nil(t, ioutil.WriteFile(filename, []byte("stale"), 0644))
+
+	registry := NewRegistry()
+	registry.Counter("reports_total", "Reports written.").Inc()
+	require.Nil(t, registry.WriteFile(filename), "unexpected error")
+
+	contents, err := ioutil.ReadFile(filename)
+	require.Nil(t, err)
+	assert.Contains(t, string(contents), "reports_total 1\n")
+	assert.NotContains(t, string(contents), "stale")
+	entries, err := ioutil.ReadDir(dir)
+	require.Nil(t, err)
+	assert.Len(t, entries, 1, "no temporary file is left behind")
+}
+
+func TestNilMetricsRecordNothing(t *testing.T) {
+	var counter *Counter
+	var histogram *Histogram
+
+	assert.NotPanics(t, func() {
+		counter.Inc()
+		histogram.Observe(1)
+	})
+}
+
+func TestDuplicateMetricPanics(t *testing.T) {
+	registry := NewRegistry()
+	registry.Counter("rows_read_total", "Rows read.")
+
+	assert.Panics(t, func() {
+		registry.Counter("rows_read_total", "Rows read.")
+	})
+}
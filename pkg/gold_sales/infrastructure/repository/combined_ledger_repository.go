@@ -0,0 +1,63 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/JonPulfer/gold_sales/pkg/gold_sales"
+)
+
+// CombinedLedgerRepository reads the payments from several ledgers as if they
+// were one.
+type CombinedLedgerRepository struct {
+	repositories []LedgerRepository
+}
+
+// NewCombinedLedgerRepository over the repositories, fetched in order.
+func NewCombinedLedgerRepository(repositories ...LedgerRepository) *CombinedLedgerRepository {
+	return &CombinedLedgerRepository{repositories: repositories}
+}
+
+func (clr CombinedLedgerRepository) FetchAll(ctx context.Context) ([]gold_sales.GoldPayment, error) {
+	payments := make([]gold_sales.GoldPayment, 0)
+	for _, repository := range clr.repositories {
+		fetched, err := repository.FetchAll(ctx)
+		if err != nil {
+			return nil, err
+		}
+		payments = append(payments, fetched...)
+	}
+	return payments, nil
+}
+
+// Close every repository, returning the first error.
+func (clr CombinedLedgerRepository) Close() error {
+	var closeErr error
+	for _, repository := range clr.repositories {
+		if err := CloseLedger(repository); err != nil && closeErr == nil {
+			closeErr = err
+		}
+	}
+	return closeErr
+}
+
+// Sources of every repository that can describe its ledgers.
+func (clr CombinedLedgerRepository) Sources() []gold_sales.InputProvenance {
+	sources := make([]gold_sales.InputProvenance, 0)
+	for _, repository := range clr.repositories {
+		if source, ok := repository.(LedgerSource); ok {
+			sources = append(sources, source.Sources()...)
+		}
+	}
+	return sources
+}
+
+// Violations of every repository that checks business rules.
+func (clr CombinedLedgerRepository) Violations() []gold_sales.RuleViolation {
+	violations := make([]gold_sales.RuleViolation, 0)
+	for _, repository := range clr.repositories {
+		if checker, ok := repository.(RuleChecker); ok {
+			violations = append(violations, checker.Violations()...)
+		}
+	}
+	return violations
+}
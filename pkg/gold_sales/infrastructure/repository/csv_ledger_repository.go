@@ -1,14 +1,22 @@
 package repository
 
 import (
+	"bufio"
+	"context"
+	"crypto/sha256"
 	"encoding/csv"
+	"encoding/hex"
 	"fmt"
+	"io"
 	"os"
 	"regexp"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/JonPulfer/gold_sales/pkg/gold_sales"
+	"github.com/JonPulfer/gold_sales/pkg/gold_sales/infrastructure/metrics"
+	"github.com/JonPulfer/gold_sales/pkg/gold_sales/infrastructure/tracing"
 )
 
 // CSVLedgerRepository uses a CSV file as a LedgerRepository for Gold Payments.
@@ -16,6 +24,9 @@ type CSVLedgerRepository struct {
 	filename      string
 	file          *os.File
 	fieldColIndex map[string]int
+	columns       map[string]string
+	metrics       *LedgerMetrics
+	source        *gold_sales.InputProvenance
 }
 
 // NewCSVLedgerRepository opens the provided CSV file as a LedgerRepository.
@@ -28,35 +39,178 @@ func NewCSVLedgerRepository(filename string) (*CSVLedgerRepository, error) {
 	return &CSVLedgerRepository{
 		filename:      filename,
 		file:          file,
-		fieldColIndex: colIndex}, nil
+		fieldColIndex: colIndex,
+		source:        &gold_sales.InputProvenance{}}, nil
 }
 
-func (clr CSVLedgerRepository) FetchAll() ([]gold_sales.GoldPayment, error) {
+// Close the ledger file.
+func (clr CSVLedgerRepository) Close() error {
+	return clr.file.Close()
+}
+
+// Sources of the payments from the last FetchAll.
+func (clr CSVLedgerRepository) Sources() []gold_sales.InputProvenance {
+	if clr.source == nil || clr.source.SHA256 == "" {
+		return nil
+	}
+	return []gold_sales.InputProvenance{*clr.source}
+}
+
+// MapColumns from the headers used in the file to the required field names
+// they hold, for ledgers whose headers differ from requiredHeaders.
+func (clr *CSVLedgerRepository) MapColumns(fieldHeaders map[string]string) {
+	clr.columns = make(map[string]string)
+	for field, header := range fieldHeaders {
+		clr.columns[cleanNonPrintable.ReplaceAllString(header, "")] = field
+	}
+}
+
+// Instrument the repository to record its ingestion metrics in the Registry.
+func (clr *CSVLedgerRepository) Instrument(registry *metrics.Registry) {
+	clr.InstrumentWith(NewLedgerMetrics(registry))
+}
+
+// InstrumentWith metrics shared with other repositories, as a metric can only
+// be registered once.
+func (clr *CSVLedgerRepository) InstrumentWith(ledgerMetrics *LedgerMetrics) {
+	clr.metrics = ledgerMetrics
+}
+
+func (clr CSVLedgerRepository) FetchAll(ctx context.Context) ([]gold_sales.GoldPayment, error) {
 	goldPayments := make([]gold_sales.GoldPayment, 0)
+	defer clr.metrics.recordParse(time.Now())
 
-	rdr := csv.NewReader(clr.file)
-	rows, err := rdr.ReadAll()
+	span, ctx := tracing.StartSpanFromContext(ctx, "CSVLedgerRepository.FetchAll")
+	span.SetTag("filename", clr.filename)
+	defer span.Finish()
+
+	rows, _, checksum, err := clr.readRows(ctx)
 	if err != nil {
 		return nil, err
 	}
 
-	if err := clr.parseHeaders(rows[0]); err != nil {
-		return nil, err
-	}
+	parseSpan, _ := tracing.StartSpanFromContext(ctx, "CSVLedgerRepository.parseRows")
+	defer parseSpan.Finish()
 
-	for _, row := range rows[1:] {
+	for _, row := range rows {
+		clr.metrics.recordRow(clr.description(row))
 		payment, err := clr.parseRow(row)
 		if err != nil {
+			clr.metrics.recordRejection(err)
 			return nil, err
 		}
 		if payment != nil {
 			goldPayments = append(goldPayments, *payment)
+		} else {
+			clr.metrics.recordRejection(LedgerRepositoryError{
+				Reason: RejectedNotGoldSpend})
+		}
+	}
+	parseSpan.SetTag("payments", len(goldPayments))
+
+	if clr.source != nil {
+		*clr.source = gold_sales.InputProvenance{
+			Filename:     clr.filename,
+			SHA256:       checksum,
+			Rows:         len(rows),
+			GoldPayments: len(goldPayments),
+			Rejected:     len(rows) - len(goldPayments),
 		}
 	}
 
 	return goldPayments, nil
 }
 
+// FetchTransactions of every type in the ledger, not only the gold spends.
+func (clr CSVLedgerRepository) FetchTransactions(ctx context.Context) ([]gold_sales.GoldPayment, error) {
+	span, ctx := tracing.StartSpanFromContext(ctx, "CSVLedgerRepository.FetchTransactions")
+	span.SetTag("filename", clr.filename)
+	defer span.Finish()
+
+	rows, _, _, err := clr.readRows(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	transactions := make([]gold_sales.GoldPayment, 0, len(rows))
+	for _, row := range rows {
+		transaction, err := clr.parseTransaction(row)
+		if err != nil {
+			return nil, err
+		}
+		transactions = append(transactions, *transaction)
+	}
+	span.SetTag("transactions", len(transactions))
+
+	return transactions, nil
+}
+
+// readRows from the start of the file and parse the header row, returning
+// the rows that follow it, the line of the file each row starts on and the
+// SHA-256 of the file.
+func (clr *CSVLedgerRepository) readRows(ctx context.Context) ([][]string, []int, string, error) {
+	span, _ := tracing.StartSpanFromContext(ctx, "csv.ReadAll")
+	defer span.Finish()
+
+	if _, err := clr.file.Seek(0, io.SeekStart); err != nil {
+		return nil, nil, "", err
+	}
+	hash := sha256.New()
+	counter := &lineCounter{r: bufio.NewReader(io.TeeReader(clr.file, hash))}
+	rdr := csv.NewReader(counter)
+	rdr.FieldsPerRecord = -1
+	rows := make([][]string, 0)
+	lines := make([]int, 0)
+	for {
+		row, err := rdr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			span.SetTag("rows", len(rows))
+			return nil, nil, "", err
+		}
+		rows = append(rows, row)
+		lines = append(lines, counter.lines-strings.Count(strings.Join(row, ""), "\n"))
+	}
+	span.SetTag("rows", len(rows))
+	if len(rows) == 0 {
+		return nil, nil, "", LedgerRepositoryError{Message: "ledger is empty, no header row found"}
+	}
+
+	if err := clr.parseHeaders(rows[0]); err != nil {
+		return nil, nil, "", err
+	}
+
+	return rows[1:], lines[1:], hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// lineCounter hands the CSV reader one line of the file at a time, counting
+// the lines read, so that once a record has been read the count is the line
+// it ends on. Records with quoted fields can span lines.
+type lineCounter struct {
+	r       *bufio.Reader
+	pending []byte
+	lines   int
+}
+
+func (lc *lineCounter) Read(p []byte) (int, error) {
+	if len(lc.pending) == 0 {
+		line, err := lc.r.ReadBytes('\n')
+		if len(line) == 0 {
+			return 0, err
+		}
+		if err != nil && err != io.EOF {
+			return 0, err
+		}
+		lc.lines++
+		lc.pending = line
+	}
+	n := copy(p, lc.pending)
+	lc.pending = lc.pending[n:]
+	return n, nil
+}
+
 // requiredHeaders we need to find in the CSV file to be able to extract the
 // payment information.
 var requiredHeaders = []string{
@@ -77,12 +231,16 @@ var cleanNonPrintable = regexp.MustCompile("[^a-z_A-Z0-9]+")
 // parseHeaders validates we have all the expected headers in the CSV and records
 // the column index for each header.
 func (clr *CSVLedgerRepository) parseHeaders(headers []string) error {
+	clr.fieldColIndex = make(map[string]int)
 	requiredHeaderFound := make(map[string]bool)
 	for _, requiredHeader := range requiredHeaders {
 		requiredHeaderFound[requiredHeader] = false
 	}
 	for colIdx, header := range headers {
 		header = cleanNonPrintable.ReplaceAllString(header, "")
+		if field, ok := clr.columns[header]; ok {
+			header = field
+		}
 		if _, ok := requiredHeaderFound[header]; ok {
 			requiredHeaderFound[header] = true
 		}
@@ -105,10 +263,42 @@ func (clr *CSVLedgerRepository) parseHeaders(headers []string) error {
 	return nil
 }
 
+// optionalField in the row, empty when the ledger has no column for it.
+func (clr CSVLedgerRepository) optionalField(row []string, field string) string {
+	colIdx, ok := clr.fieldColIndex[field]
+	if !ok || colIdx >= len(row) {
+		return ""
+	}
+	return row[colIdx]
+}
+
+// description of the transaction in the row, if the row has one.
+func (clr CSVLedgerRepository) description(row []string) string {
+	return clr.optionalField(row, "description")
+}
+
+// parseRow returns the gold spend or refund in the row, or nil if the row is
+// another type of transaction. Refunds are returned with a negative amount.
 func (clr CSVLedgerRepository) parseRow(row []string) (*gold_sales.GoldPayment, error) {
+	transaction, err := clr.parseTransaction(row)
+	if err != nil {
+		return nil, err
+	}
+
+	if payment, ok := transaction.AsGoldSpend(); ok {
+		return &payment, nil
+	}
+
+	return nil, nil
+}
+
+// parseTransaction from the row whatever its type.
+func (clr CSVLedgerRepository) parseTransaction(row []string) (*gold_sales.GoldPayment, error) {
 	if len(row) != len(clr.fieldColIndex) {
 		return nil, LedgerRepositoryError{
-			Message: "failed to parse row, unexpected number of fields"}
+			Message: "failed to parse row, unexpected number of fields",
+			Reason:  RejectedFieldCount,
+		}
 	}
 
 	amount, err := strconv.ParseFloat(row[clr.fieldColIndex["amount"]], 64)
@@ -116,6 +306,7 @@ func (clr CSVLedgerRepository) parseRow(row []string) (*gold_sales.GoldPayment,
 		return nil, LedgerRepositoryError{
 			Message: "failed to parse amount: " +
 				row[clr.fieldColIndex["amount"]],
+			Reason: RejectedAmount,
 		}
 	}
 
@@ -124,6 +315,7 @@ func (clr CSVLedgerRepository) parseRow(row []string) (*gold_sales.GoldPayment,
 		return nil, LedgerRepositoryError{
 			Message: "failed to parse rate: " +
 				row[clr.fieldColIndex["rate"]],
+			Reason: RejectedRate,
 		}
 	}
 
@@ -132,6 +324,7 @@ func (clr CSVLedgerRepository) parseRow(row []string) (*gold_sales.GoldPayment,
 		return nil, LedgerRepositoryError{
 			Message: "failed to parse date: " +
 				row[clr.fieldColIndex["date"]],
+			Reason: RejectedDate,
 		}
 	}
 
@@ -141,19 +334,17 @@ func (clr CSVLedgerRepository) parseRow(row []string) (*gold_sales.GoldPayment,
 			LastName:  row[clr.fieldColIndex["last_name"]],
 			Email:     row[clr.fieldColIndex["email"]],
 		},
-		Description:  row[clr.fieldColIndex["description"]],
-		Amount:       amount,
-		Rate:         rate,
-		FromCurrency: row[clr.fieldColIndex["from_currency"]],
-		ToCurrency:   row[clr.fieldColIndex["to_currency"]],
-		Date:         date,
-		GramWeight:   amount / rate,
-	}
-
-	if transaction.Description == gold_sales.GoldSpend &&
-		transaction.ToCurrency == gold_sales.GoldCurrencyCode {
-		return &transaction, nil
+		Description:       row[clr.fieldColIndex["description"]],
+		Amount:            amount,
+		Rate:              rate,
+		FromCurrency:      row[clr.fieldColIndex["from_currency"]],
+		ToCurrency:        row[clr.fieldColIndex["to_currency"]],
+		Date:              date,
+		GramWeight:        amount / rate,
+		ID:                clr.optionalField(row, "transaction_id"),
+		Reference:         clr.optionalField(row, "reference"),
+		OriginalReference: clr.optionalField(row, "original_reference"),
 	}
 
-	return nil, nil
+	return &transaction, nil
 }
@@ -1,9 +1,16 @@
 package repository
 
 import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/JonPulfer/gold_sales/pkg/gold_sales"
+	"github.com/JonPulfer/gold_sales/pkg/gold_sales/infrastructure/metrics"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -363,3 +370,160 @@ func TestParseRow(t *testing.T) {
 		})
 	}
 }
+
+func TestFetchAllRecordsMetrics(t *testing.T) {
+	ledger := "first_name,last_name,email,description,merchant_code,amount,from_currency,to_currency,rate,date\n" +
+		"Alayna,Sparks,alayna.sparks@mailinator.com,CARD SPEND,5311,2629.16,GBP,GGM,47.0892,22/03/2020 13:28\n" +
+		"Niyah,Singleton,niyah.singleton@mailinator.com,CARD SPEND,5462,682.28,GBP,GBP,1,12/05/2020 08:22\n" +
+		"Riley,Hayden,riley.hayden@mailinator.com,SELL GOLD,,2.91,GGM,GBP,47.7534,18/05/2020 14:40\n"
+	filename := writeTempLedger(t, ledger)
+
+	clr, err := NewCSVLedgerRepository(filename)
+	require.Nil(t, err, "unexpected error")
+	registry := metrics.NewRegistry()
+	clr.Instrument(registry)
+
+	payments, err := clr.FetchAll(context.Background())
+	require.Nil(t, err, "unexpected error")
+	assert.Len(t, payments, 1)
+
+	assert.Equal(t, 3.0, clr.metrics.RowsRead.Value())
+	assert.Equal(t, 2.0, clr.metrics.RowsRejected.Value(RejectedNotGoldSpend))
+	assert.Equal(t, 2.0, clr.metrics.Payments.Value("CARD SPEND"))
+	assert.Equal(t, 1.0, clr.metrics.Payments.Value("SELL GOLD"))
+	assert.Equal(t, uint64(1), clr.metrics.ParseDuration.Count())
+
+	checksum := sha256.Sum256([]byte(ledger))
+	assert.Equal(t, []gold_sales.InputProvenance{{
+		Filename:     filename,
+		SHA256:       hex.EncodeToString(checksum[:]),
+		Rows:         3,
+		GoldPayments: 1,
+		Rejected:     2,
+	}}, clr.Sources())
+}
+
+// writeTempLedger with the contents, removed again when the test finishes.
+func writeTempLedger(t *testing.T, contents string) string {
+	dir, err := ioutil.TempDir("", "ledger")
+	require.Nil(t, err)
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	filename := filepath.Join(dir, "ledger.csv")
+	require.Nil(t, ioutil.WriteFile(filename, []byte(contents), 0644))
+	return filename
+}
+
+func TestSummariseLinesOfMultilineRecords(t *testing.T) {
+	ledger := "first_name,last_name,email,description,merchant_code,amount,from_currency,to_currency,rate,date\r\n" +
+		"Alayna,Sparks,alayna.sparks@mailinator.com,\"CARD\r\nSPEND\",5311,2629.16,GBP,GGM,47.0892,22/03/2020 13:28\r\n" +
+		"\r\n" +
+		"Niyah,Singleton,niyah.singleton@mailinator.com,CARD SPEND,5462,bad,GBP,GBP,1,12/05/2020 08:22\r\n" +
+		"Riley,Hayden,riley.hayden@mailinator.com,\"SELL\n\nGOLD\",,2.91,GGM,GBP,47.7534,18/05/2020 14:40\n" +
+		"Riley,Hayden,riley.hayden@mailinator.com,SELL GOLD,,2.91,GGM,GBP"
+	clr, err := NewCSVLedgerRepository(writeTempLedger(t, ledger))
+	require.Nil(t, err, "unexpected error")
+
+	summary, err := clr.Summarise(context.Background())
+	require.Nil(t, err, "unexpected error")
+
+	require.Len(t, summary.RowErrors, 2)
+	assert.Equal(t, 5, summary.RowErrors[0].Line)
+	assert.Equal(t, 9, summary.RowErrors[1].Line)
+}
+
+func TestSummariseReportsEveryRowError(t *testing.T) {
+	ledger := "first_name,last_name,email,description,merchant_code,amount,from_currency,to_currency,rate,date\n" +
+		"Alayna,Sparks,alayna.sparks@mailinator.com,CARD SPEND,5311,2629.16,GBP,GGM,47.0892,22/03/2020 13:28\n" +
+		"Niyah,Singleton,niyah.singleton@mailinator.com,CARD SPEND,5462,bad,GBP,GBP,1,12/05/2020 08:22\n" +
+		"Riley,Hayden,riley.hayden@mailinator.com,SELL GOLD,,2.91,GGM,GBP,47.7534,18/05/2020 14:40\n" +
+		"Riley,Hayden,riley.hayden@mailinator.com,SELL GOLD,,2.91,GGM,GBP\n"
+	clr, err := NewCSVLedgerRepository(writeTempLedger(t, ledger))
+	require.Nil(t, err, "unexpected error")
+
+	summary, err := clr.Summarise(context.Background())
+	require.Nil(t, err, "unexpected error")
+
+	assert.Equal(t, 4, summary.Rows)
+	assert.Equal(t, 1, summary.GoldPayments)
+	assert.False(t, summary.Valid())
+	require.Len(t, summary.RowErrors, 2)
+	assert.Equal(t, RowError{Line: 3, Reason: RejectedAmount,
+		Message: "failed to parse amount: bad"}, summary.RowErrors[0])
+	assert.Equal(t, 5, summary.RowErrors[1].Line)
+	assert.Equal(t, RejectedFieldCount, summary.RowErrors[1].Reason)
+	assert.Equal(t, map[string]int{"CARD SPEND": 1, "SELL GOLD": 1}, summary.ByDescription)
+	assert.Equal(t, map[string]int{"GBP/GGM": 1, "GGM/GBP": 1}, summary.ByCurrencyPair)
+	assert.Equal(t, gold_sales.OrderedReportMonths{"May 2020", "Mar 2020"}, summary.Months())
+
+	payments, err := clr.FetchAll(context.Background())
+	assert.NotNil(t, err, "FetchAll should still fail on the first bad row")
+	assert.Nil(t, payments)
+}
+
+func TestFetchAllWithMappedColumns(t *testing.T) {
+	ledger := "given_name,family_name,email,type,merchant_code,value,from_currency,to_currency,fx_rate,date\n" +
+		"Alayna,Sparks,alayna.sparks@mailinator.com,CARD SPEND,5311,2629.16,GBP,GGM,47.0892,22/03/2020 13:28\n"
+	clr, err := NewCSVLedgerRepository(writeTempLedger(t, ledger))
+	require.Nil(t, err, "unexpected error")
+
+	_, err = clr.FetchAll(context.Background())
+	assert.NotNil(t, err, "expected missing headers without a mapping")
+
+	clr.MapColumns(map[string]string{
+		"first_name":  "given_name",
+		"last_name":   "family_name",
+		"description": "type",
+		"amount":      "value",
+		"rate":        "fx_rate",
+	})
+	payments, err := clr.FetchAll(context.Background())
+	require.Nil(t, err, "unexpected error")
+	require.Len(t, payments, 1)
+	assert.Equal(t, "Sparks", payments[0].Spender.LastName)
+	assert.Equal(t, 2629.16, payments[0].Amount)
+}
+
+func TestFetchAllReadsRefunds(t *testing.T) {
+	ledger := "first_name,last_name,email,description,merchant_code,amount,from_currency,to_currency,rate,date,reference,original_reference\n" +
+		"Alayna,Sparks,alayna.sparks@mailinator.com,CARD SPEND,5311,2629.16,GBP,GGM,47.0892,22/03/2020 13:28,T1,\n" +
+		"Alayna,Sparks,alayna.sparks@mailinator.com,CARD REFUND,5311,2629.16,GBP,GGM,47.0892,02/04/2020 09:00,T2,T1\n" +
+		"Niyah,Singleton,niyah.singleton@mailinator.com,CARD REFUND,5462,682.28,GBP,GBP,1,12/05/2020 08:22,T3,\n"
+	clr, err := NewCSVLedgerRepository(writeTempLedger(t, ledger))
+	require.Nil(t, err, "unexpected error")
+
+	payments, err := clr.FetchAll(context.Background())
+	require.Nil(t, err, "unexpected error")
+	require.Len(t, payments, 2, "the refund not in gold is not read")
+	assert.Equal(t, "T1", payments[0].Reference)
+	assert.Equal(t, gold_sales.GoldRefund, payments[1].Description)
+	assert.Equal(t, -2629.16, payments[1].Amount)
+	assert.Less(t, payments[1].GramWeight, 0.0)
+	assert.Equal(t, "T2", payments[1].Reference)
+	assert.Equal(t, "T1", payments[1].OriginalReference)
+
+	summary, err := clr.Summarise(context.Background())
+	require.Nil(t, err, "unexpected error")
+	assert.Equal(t, 1, summary.GoldPayments)
+	assert.Equal(t, 1, summary.GoldRefunds)
+}
+
+func TestCloseLedgerClosesWrappedLedgers(t *testing.T) {
+	ledger := "first_name,last_name,email,description,merchant_code,amount,from_currency,to_currency,rate,date\n" +
+		"Alayna,Sparks,alayna.sparks@mailinator.com,CARD SPEND,5311,2629.16,GBP,GGM,47.0892,22/03/2020 13:28\n"
+	first, err := NewCSVLedgerRepository(writeTempLedger(t, ledger))
+	require.Nil(t, err)
+	second, err := NewCSVLedgerRepository(writeTempLedger(t, ledger))
+	require.Nil(t, err)
+	repos := NewDeduplicatedLedgerRepository(
+		NewCombinedLedgerRepository(first, NewValidatedLedgerRepository(second, "second", nil)),
+		WarnDuplicates)
+
+	require.Nil(t, CloseLedger(repos))
+	_, err = first.FetchAll(context.Background())
+	assert.NotNil(t, err, "the first ledger should be closed")
+	_, err = second.FetchAll(context.Background())
+	assert.NotNil(t, err, "the validated ledger should be closed")
+	assert.NotNil(t, first.Close(), "a ledger is only closed once")
+	assert.Nil(t, CloseLedger(NewMockLedgerRepository(nil)), "nothing to close")
+}
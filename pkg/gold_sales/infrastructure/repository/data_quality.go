@@ -0,0 +1,266 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/mail"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/JonPulfer/gold_sales/pkg/gold_sales"
+	"github.com/JonPulfer/gold_sales/pkg/gold_sales/infrastructure/tracing"
+)
+
+// DataQualityOptions for profiling a ledger.
+type DataQualityOptions struct {
+	// MaxRateChange is the largest day to day change in the average rate of
+	// a currency pair, as a fraction, before it is reported.
+	MaxRateChange float64
+	// Now is the time after which rows are future dated.
+	Now time.Time
+}
+
+// DefaultDataQualityOptions report rate changes of more than 5% a day.
+func DefaultDataQualityOptions() DataQualityOptions {
+	return DataQualityOptions{MaxRateChange: 0.05, Now: time.Now().UTC()}
+}
+
+// Reasons a row is reported in a DataQualityReport.
+const (
+	IssueInvalidRate        = "invalid_rate"
+	IssueFutureDated        = "future_dated"
+	IssueUnknownDescription = "unknown_gold_description"
+	IssueInvalidEmail       = "invalid_email"
+	IssueNotInGold          = "card_transaction_not_in_gold"
+)
+
+// knownGoldDescriptions of transactions paid in gold.
+var knownGoldDescriptions = map[string]bool{
+	gold_sales.GoldSpend:  true,
+	gold_sales.GoldRefund: true,
+	gold_sales.GoldBuy:    true,
+}
+
+// DataQualityReport profiles every row of a ledger, so the ledger can be
+// checked before a report produced from it is trusted. Each list of rows is
+// a RowError, with Reason saying what was found.
+type DataQualityReport struct {
+	Filename    string    `json:"filename"`
+	GeneratedAt time.Time `json:"generatedAt"`
+	Rows        int       `json:"rows"`
+	// EmptyFields counts the rows with nothing in each column, by header.
+	EmptyFields    map[string]int `json:"emptyFields"`
+	ByDescription  map[string]int `json:"byDescription"`
+	ByCurrencyPair map[string]int `json:"byCurrencyPair"`
+	RowErrors      []RowError     `json:"rowErrors"`
+	// InvalidRates are rows with a rate that is not positive.
+	InvalidRates []RowError   `json:"invalidRates"`
+	RateChanges  []RateChange `json:"rateChanges"`
+	FutureDated  []RowError   `json:"futureDated"`
+	// UnknownGoldDescriptions are rows paid in gold whose description is
+	// not a card spend, card refund or gold buy.
+	UnknownGoldDescriptions []RowError `json:"unknownGoldDescriptions"`
+	InvalidEmails           []RowError `json:"invalidEmails"`
+	// NotInGold are card transactions that are not paid in gold, so are
+	// left out of the gold spend totals.
+	NotInGold  []RowError  `json:"notInGold"`
+	Duplicates []Duplicate `json:"duplicates"`
+}
+
+// RateChange in the average daily rate of a currency pair larger than the
+// DataQualityOptions allow. Change is a fraction of the previous rate.
+type RateChange struct {
+	CurrencyPair string  `json:"currencyPair"`
+	PreviousDay  string  `json:"previousDay"`
+	PreviousRate float64 `json:"previousRate"`
+	Day          string  `json:"day"`
+	Rate         float64 `json:"rate"`
+	Change       float64 `json:"change"`
+}
+
+// Issues found in the ledger, not counting the empty fields, which are
+// expected in some columns.
+func (dqr DataQualityReport) Issues() int {
+	return len(dqr.RowErrors) + len(dqr.InvalidRates) + len(dqr.RateChanges) +
+		len(dqr.FutureDated) + len(dqr.UnknownGoldDescriptions) +
+		len(dqr.InvalidEmails) + len(dqr.NotInGold) + len(dqr.Duplicates)
+}
+
+// WriteJSON of the findings for the ledger, indented so they can be read
+// alongside the HTML page.
+func (dqr DataQualityReport) WriteJSON(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(dqr)
+}
+
+// dailyRate of a currency pair, summed so it can be averaged.
+type dailyRate struct {
+	total float64
+	rows  int
+}
+
+// Profile every row of the ledger for the DataQualityReport, carrying on past
+// rows that cannot be parsed.
+func (clr CSVLedgerRepository) Profile(
+	ctx context.Context,
+	options DataQualityOptions,
+) (*DataQualityReport, error) {
+	span, ctx := tracing.StartSpanFromContext(ctx, "CSVLedgerRepository.Profile")
+	span.SetTag("filename", clr.filename)
+	defer span.Finish()
+
+	rows, lines, _, err := clr.readRows(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	columns := 0
+	for _, colIdx := range clr.fieldColIndex {
+		if colIdx >= columns {
+			columns = colIdx + 1
+		}
+	}
+	headers := make([]string, columns)
+	for header, colIdx := range clr.fieldColIndex {
+		headers[colIdx] = header
+	}
+	report := &DataQualityReport{
+		Filename:                clr.filename,
+		GeneratedAt:             options.Now,
+		EmptyFields:             make(map[string]int),
+		ByDescription:           make(map[string]int),
+		ByCurrencyPair:          make(map[string]int),
+		RowErrors:               make([]RowError, 0),
+		InvalidRates:            make([]RowError, 0),
+		FutureDated:             make([]RowError, 0),
+		UnknownGoldDescriptions: make([]RowError, 0),
+		InvalidEmails:           make([]RowError, 0),
+		NotInGold:               make([]RowError, 0),
+	}
+	for header := range clr.fieldColIndex {
+		report.EmptyFields[header] = 0
+	}
+
+	rates := make(map[string]map[string]*dailyRate)
+	transactions := make([]gold_sales.GoldPayment, 0, len(rows))
+	for rowIdx, row := range rows {
+		line := lines[rowIdx]
+		report.Rows++
+		for colIdx, value := range row {
+			if colIdx < len(headers) && headers[colIdx] != "" &&
+				strings.TrimSpace(value) == "" {
+				report.EmptyFields[headers[colIdx]]++
+			}
+		}
+
+		transaction, err := clr.parseTransaction(row)
+		if err != nil {
+			rowError := RowError{Line: line, Message: err.Error()}
+			if lre, ok := err.(LedgerRepositoryError); ok {
+				rowError.Reason = lre.Reason
+			}
+			report.RowErrors = append(report.RowErrors, rowError)
+			continue
+		}
+		transactions = append(transactions, *transaction)
+
+		pair := transaction.FromCurrency + "/" + transaction.ToCurrency
+		report.ByDescription[transaction.Description]++
+		report.ByCurrencyPair[pair]++
+		issue := func(reason, message string) RowError {
+			return RowError{Line: line, Reason: reason, Message: message}
+		}
+
+		if transaction.Rate <= 0 {
+			report.InvalidRates = append(report.InvalidRates, issue(IssueInvalidRate,
+				fmt.Sprintf("rate %v is not positive", transaction.Rate)))
+		} else if transaction.FromCurrency != transaction.ToCurrency {
+			day := transaction.Date.Format("2006-01-02")
+			if rates[pair] == nil {
+				rates[pair] = make(map[string]*dailyRate)
+			}
+			if rates[pair][day] == nil {
+				rates[pair][day] = &dailyRate{}
+			}
+			rates[pair][day].total += transaction.Rate
+			rates[pair][day].rows++
+		}
+		if !options.Now.IsZero() && transaction.Date.After(options.Now) {
+			report.FutureDated = append(report.FutureDated, issue(IssueFutureDated,
+				"dated "+transaction.Date.Format("02/01/2006 15:04")))
+		}
+		if transaction.ToCurrency == gold_sales.GoldCurrencyCode &&
+			!knownGoldDescriptions[transaction.Description] {
+			report.UnknownGoldDescriptions = append(report.UnknownGoldDescriptions,
+				issue(IssueUnknownDescription,
+					fmt.Sprintf("%q paid in gold", transaction.Description)))
+		}
+		if !validEmail(transaction.Spender.Email) {
+			report.InvalidEmails = append(report.InvalidEmails, issue(IssueInvalidEmail,
+				fmt.Sprintf("%q is not an email address", transaction.Spender.Email)))
+		}
+		if (transaction.Description == gold_sales.GoldSpend ||
+			transaction.Description == gold_sales.GoldRefund) &&
+			transaction.ToCurrency != gold_sales.GoldCurrencyCode {
+			report.NotInGold = append(report.NotInGold, issue(IssueNotInGold,
+				fmt.Sprintf("%s of %.2f from %s to %s", transaction.Description,
+					transaction.Amount, transaction.FromCurrency, transaction.ToCurrency)))
+		}
+	}
+	report.RateChanges = rateChanges(rates, options.MaxRateChange)
+	_, report.Duplicates = FindDuplicates(transactions)
+	span.SetTag("rows", report.Rows).SetTag("issues", report.Issues())
+
+	return report, nil
+}
+
+// rateChanges between the days each currency pair was traded on larger than
+// the maximum change, ordered by currency pair and day.
+func rateChanges(rates map[string]map[string]*dailyRate, maxChange float64) []RateChange {
+	pairs := make([]string, 0, len(rates))
+	for pair := range rates {
+		pairs = append(pairs, pair)
+	}
+	sort.Strings(pairs)
+
+	changes := make([]RateChange, 0)
+	for _, pair := range pairs {
+		days := make([]string, 0, len(rates[pair]))
+		for day := range rates[pair] {
+			days = append(days, day)
+		}
+		sort.Strings(days)
+		for i := 1; i < len(days); i++ {
+			previous := rates[pair][days[i-1]]
+			current := rates[pair][days[i]]
+			previousRate := previous.total / float64(previous.rows)
+			rate := current.total / float64(current.rows)
+			change := (rate - previousRate) / previousRate
+			if math.Abs(change) > maxChange {
+				changes = append(changes, RateChange{
+					CurrencyPair: pair,
+					PreviousDay:  days[i-1],
+					PreviousRate: previousRate,
+					Day:          days[i],
+					Rate:         rate,
+					Change:       change,
+				})
+			}
+		}
+	}
+	return changes
+}
+
+// validEmail is a bare address with a domain, without a display name.
+func validEmail(email string) bool {
+	address, err := mail.ParseAddress(email)
+	if err != nil || address.Address != email {
+		return false
+	}
+	return strings.Contains(email[strings.LastIndex(email, "@")+1:], ".")
+}
@@ -0,0 +1,126 @@
+package repository
+
+import (
+	"html/template"
+	"io"
+	"sort"
+)
+
+// htmlCount of a value in the DataQualityReport, for the tables of counts.
+type htmlCount struct {
+	Name  string
+	Count int
+}
+
+// htmlRowIssues are the rows reported for one check.
+type htmlRowIssues struct {
+	Title string
+	Rows  []RowError
+}
+
+type htmlDataQualityReport struct {
+	DataQualityReport
+	Issues         int
+	EmptyFields    []htmlCount
+	ByDescription  []htmlCount
+	ByCurrencyPair []htmlCount
+	RowIssues      []htmlRowIssues
+}
+
+// WriteHTML of the report as a single static page.
+func (dqr DataQualityReport) WriteHTML(w io.Writer) error {
+	view := htmlDataQualityReport{
+		DataQualityReport: dqr,
+		Issues:            dqr.Issues(),
+		EmptyFields:       sortedCounts(dqr.EmptyFields),
+		ByDescription:     sortedCounts(dqr.ByDescription),
+		ByCurrencyPair:    sortedCounts(dqr.ByCurrencyPair),
+		RowIssues: []htmlRowIssues{
+			{"Rows that cannot be parsed", dqr.RowErrors},
+			{"Card transactions not paid in gold", dqr.NotInGold},
+			{"Unknown descriptions paid in gold", dqr.UnknownGoldDescriptions},
+			{"Invalid rates", dqr.InvalidRates},
+			{"Future dated rows", dqr.FutureDated},
+			{"Invalid emails", dqr.InvalidEmails},
+		},
+	}
+	return dataQualityTemplate.Execute(w, view)
+}
+
+// sortedCounts by name.
+func sortedCounts(counts map[string]int) []htmlCount {
+	sorted := make([]htmlCount, 0, len(counts))
+	for name, count := range counts {
+		sorted = append(sorted, htmlCount{Name: name, Count: count})
+	}
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Name < sorted[j].Name })
+	return sorted
+}
+
+var dataQualityTemplate = template.Must(template.New("data_quality").Funcs(
+	template.FuncMap{"percent": func(change float64) float64 { return change * 100 }},
+).Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>Data quality of {{.Filename}}</title>
+<style>
+body { font-family: Helvetica, Arial, sans-serif; color: #222; margin: 2em; }
+h1 { font-size: 1.6em; }
+h2 { font-size: 1.2em; margin-top: 2em; border-bottom: 1px solid #ccc; }
+table { border-collapse: collapse; margin: 0.5em 0 1em 0; }
+th, td { padding: 4px 12px; border-bottom: 1px solid #eee; text-align: left; }
+td.number, th.number { text-align: right; }
+.muted { color: #777; font-size: 0.9em; }
+</style>
+</head>
+<body>
+<h1>Data quality of {{.Filename}}</h1>
+<p class="muted">Generated {{.GeneratedAt.Format "02 Jan 2006 15:04 MST"}}. {{.Rows}} rows, {{.Issues}} issues found.</p>
+<h2>Empty fields</h2>
+<table>
+<thead><tr><th>Column</th><th class="number">Empty</th></tr></thead>
+<tbody>
+{{range .EmptyFields}}<tr><td>{{.Name}}</td><td class="number">{{.Count}}</td></tr>
+{{end}}</tbody>
+</table>
+<h2>Rows by description</h2>
+<table>
+<thead><tr><th>Description</th><th class="number">Rows</th></tr></thead>
+<tbody>
+{{range .ByDescription}}<tr><td>{{.Name}}</td><td class="number">{{.Count}}</td></tr>
+{{end}}</tbody>
+</table>
+<h2>Rows by currency pair</h2>
+<table>
+<thead><tr><th>From/to</th><th class="number">Rows</th></tr></thead>
+<tbody>
+{{range .ByCurrencyPair}}<tr><td>{{.Name}}</td><td class="number">{{.Count}}</td></tr>
+{{end}}</tbody>
+</table>
+{{range .RowIssues}}
+<h2>{{.Title}} ({{len .Rows}})</h2>
+{{if .Rows}}<table>
+<thead><tr><th class="number">Line</th><th>Found</th></tr></thead>
+<tbody>
+{{range .Rows}}<tr><td class="number">{{.Line}}</td><td>{{.Message}}</td></tr>
+{{end}}</tbody>
+</table>{{end}}
+{{end}}
+<h2>Rate changes ({{len .RateChanges}})</h2>
+{{if .RateChanges}}<table>
+<thead><tr><th>From/to</th><th>From day</th><th class="number">Rate</th><th>To day</th><th class="number">Rate</th><th class="number">Change</th></tr></thead>
+<tbody>
+{{range .RateChanges}}<tr><td>{{.CurrencyPair}}</td><td>{{.PreviousDay}}</td><td class="number">{{printf "%.4f" .PreviousRate}}</td><td>{{.Day}}</td><td class="number">{{printf "%.4f" .Rate}}</td><td class="number">{{printf "%+.1f%%" (percent .Change)}}</td></tr>
+{{end}}</tbody>
+</table>{{end}}
+<h2>Duplicate transactions ({{len .Duplicates}})</h2>
+{{if .Duplicates}}<table>
+<thead><tr><th>ID</th><th class="number">Times</th><th>Email</th><th>Description</th><th class="number">Amount</th><th>Date</th></tr></thead>
+<tbody>
+{{range .Duplicates}}<tr><td><code>{{.ID}}</code></td><td class="number">{{.Count}}</td><td>{{.Payment.Spender.Email}}</td><td>{{.Payment.Description}}</td><td class="number">{{printf "%.2f" .Payment.Amount}}</td><td>{{.Payment.Date.Format "02/01/2006 15:04"}}</td></tr>
+{{end}}</tbody>
+</table>{{end}}
+</body>
+</html>
+`))
@@ -0,0 +1,90 @@
+package repository
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProfile(t *testing.T) {
+	ledger := "first_name,last_name,email,description,merchant_code,amount,from_currency,to_currency,rate,date\n" +
+		"Alayna,Sparks,alayna.sparks@mailinator.com,CARD SPEND,5311,2629.16,GBP,GGM,47.0892,22/03/2020 13:28\n" +
+		"Niyah,Singleton,niyah.singleton@mailinator.com,CARD SPEND,5462,682.28,GBP,GBP,1,12/05/2020 08:22\n" +
+		"Riley,Hayden,riley.hayden@mailinator.com,SELL GOLD,,2.91,GGM,GBP,47.7534,18/05/2020 14:40\n" +
+		"Riley,Hayden,riley.hayden@mailinator.com,SELL GOLD,,2.91,GGM,GBP,52.7534,19/05/2020 09:10\n" +
+		"Riley,Hayden,riley.hayden@mailinator,TOP UP,,100,GBP,GGM,47.7534,19/05/2020 09:10\n" +
+		"Amanda,Burn,amanda.burn@mailinator.com,BUY GOLD,,100,GBP,GGM,0,02/01/2031 03:07\n" +
+		"Amanda,Burn,amanda.burn@mailinator.com,BUY GOLD,,bad,GBP,GGM,47.1,02/01/2020 03:07\n" +
+		"Alayna,Sparks,alayna.sparks@mailinator.com,CARD SPEND,5311,2629.16,GBP,GGM,47.0892,22/03/2020 13:28\n"
+	clr, err := NewCSVLedgerRepository(writeTempLedger(t, ledger))
+	require.Nil(t, err, "unexpected error")
+
+	options := DataQualityOptions{
+		MaxRateChange: 0.05,
+		Now:           time.Date(2020, 9, 1, 0, 0, 0, 0, time.UTC),
+	}
+	report, err := clr.Profile(context.Background(), options)
+	require.Nil(t, err, "unexpected error")
+
+	assert.Equal(t, 8, report.Rows)
+	assert.Equal(t, 5, report.EmptyFields["merchant_code"])
+	assert.Equal(t, 0, report.EmptyFields["email"])
+	assert.Equal(t, map[string]int{"CARD SPEND": 3, "SELL GOLD": 2, "TOP UP": 1, "BUY GOLD": 1},
+		report.ByDescription)
+	assert.Equal(t, map[string]int{"GBP/GGM": 4, "GBP/GBP": 1, "GGM/GBP": 2}, report.ByCurrencyPair)
+
+	lines := func(rows []RowError) []int {
+		found := make([]int, len(rows))
+		for i, row := range rows {
+			found[i] = row.Line
+		}
+		return found
+	}
+	assert.Equal(t, []int{8}, lines(report.RowErrors))
+	assert.Equal(t, []int{3}, lines(report.NotInGold), "the card spend from GBP to GBP")
+	assert.Equal(t, []int{6}, lines(report.UnknownGoldDescriptions))
+	assert.Equal(t, []int{6}, lines(report.InvalidEmails))
+	assert.Equal(t, []int{7}, lines(report.InvalidRates))
+	assert.Equal(t, []int{7}, lines(report.FutureDated))
+	require.Len(t, report.RateChanges, 1)
+	assert.Equal(t, "GGM/GBP", report.RateChanges[0].CurrencyPair)
+	assert.Equal(t, "2020-05-19", report.RateChanges[0].Day)
+	assert.InDelta(t, 0.1047, report.RateChanges[0].Change, 0.0001)
+	require.Len(t, report.Duplicates, 1)
+	assert.Equal(t, "alayna.sparks@mailinator.com", report.Duplicates[0].Payment.Spender.Email)
+	assert.Equal(t, 8, report.Issues())
+
+	var encoded bytes.Buffer
+	require.Nil(t, report.WriteJSON(&encoded))
+	var decoded DataQualityReport
+	require.Nil(t, json.Unmarshal(encoded.Bytes(), &decoded))
+	assert.Equal(t, report.NotInGold, decoded.NotInGold)
+
+	var page bytes.Buffer
+	require.Nil(t, report.WriteHTML(&page))
+	assert.Contains(t, page.String(), "Card transactions not paid in gold (1)")
+	assert.Contains(t, page.String(), "CARD SPEND of 682.28 from GBP to GBP")
+	assert.Contains(t, page.String(), "10.5%")
+}
+
+func TestProfileLinesOfMultilineRecords(t *testing.T) {
+	ledger := "first_name,last_name,email,description,merchant_code,amount,from_currency,to_currency,rate,date\n" +
+		"Alayna,Sparks,alayna.sparks@mailinator.com,\"CARD\nSPEND\",5311,2629.16,GBP,GGM,47.0892,22/03/2020 13:28\n" +
+		"Niyah,Singleton,niyah.singleton@mailinator.com,CARD SPEND,5462,bad,GBP,GBP,1,12/05/2020 08:22\n" +
+		"Riley,Hayden,riley.hayden@mailinator,SELL GOLD,,2.91,GGM,GBP,47.7534,18/05/2020 14:40\n"
+	clr, err := NewCSVLedgerRepository(writeTempLedger(t, ledger))
+	require.Nil(t, err, "unexpected error")
+
+	report, err := clr.Profile(context.Background(), DefaultDataQualityOptions())
+	require.Nil(t, err, "unexpected error")
+
+	require.Len(t, report.RowErrors, 1)
+	assert.Equal(t, 4, report.RowErrors[0].Line)
+	require.Len(t, report.InvalidEmails, 1)
+	assert.Equal(t, 5, report.InvalidEmails[0].Line)
+}
@@ -0,0 +1,169 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/pkg/errors"
+
+	"github.com/JonPulfer/gold_sales/pkg/gold_sales"
+	"github.com/JonPulfer/gold_sales/pkg/gold_sales/infrastructure/tracing"
+)
+
+// DuplicatePolicy for payments fetched with the ID of an earlier payment.
+type DuplicatePolicy string
+
+const (
+	// DropDuplicates keeps the first payment with an ID.
+	DropDuplicates DuplicatePolicy = "drop"
+	// WarnDuplicates keeps every payment, only reporting the duplicates, the
+	// default. Without an ID or reference in the ledger, two identical
+	// purchases cannot be told apart from one read twice.
+	WarnDuplicates DuplicatePolicy = "warn"
+	// FailOnDuplicates fails the fetch when any payment is duplicated.
+	FailOnDuplicates DuplicatePolicy = "fail"
+)
+
+// RejectedDuplicate is the reason a duplicated payment was rejected.
+const RejectedDuplicate = "duplicate"
+
+// ParseDuplicatePolicy from its name, defaulting to WarnDuplicates when empty.
+func ParseDuplicatePolicy(name string) (DuplicatePolicy, error) {
+	switch DuplicatePolicy(name) {
+	case "", WarnDuplicates:
+		return WarnDuplicates, nil
+	case DropDuplicates, FailOnDuplicates:
+		return DuplicatePolicy(name), nil
+	}
+	return WarnDuplicates, errors.Errorf("unknown duplicate policy %q", name)
+}
+
+// Duplicate payment found while fetching. Count is the number of times the
+// payment was found, including the first.
+type Duplicate struct {
+	ID      string                 `json:"id"`
+	Count   int                    `json:"count"`
+	Payment gold_sales.GoldPayment `json:"payment"`
+}
+
+// FindDuplicates among the payments, setting the ID of every payment to its
+// TransactionID. The payments are returned without the duplicates, keeping
+// the first payment with each ID, along with the duplicates in the order
+// they were first found.
+func FindDuplicates(
+	payments []gold_sales.GoldPayment,
+) ([]gold_sales.GoldPayment, []Duplicate) {
+	unique := make([]gold_sales.GoldPayment, 0, len(payments))
+	found := make(map[string]int)
+	duplicates := make([]Duplicate, 0)
+	duplicateIndex := make(map[string]int)
+	for _, payment := range payments {
+		payment.ID = payment.TransactionID()
+		if _, ok := found[payment.ID]; !ok {
+			found[payment.ID] = len(unique)
+			unique = append(unique, payment)
+			continue
+		}
+		if i, ok := duplicateIndex[payment.ID]; ok {
+			duplicates[i].Count++
+			continue
+		}
+		duplicateIndex[payment.ID] = len(duplicates)
+		duplicates = append(duplicates, Duplicate{
+			ID:      payment.ID,
+			Count:   2,
+			Payment: unique[found[payment.ID]],
+		})
+	}
+	return unique, duplicates
+}
+
+// DeduplicatedLedgerRepository fetches the payments of another repository,
+// applying a DuplicatePolicy to payments that share a TransactionID, as they
+// do when overlapping exports of a ledger are read together.
+type DeduplicatedLedgerRepository struct {
+	repository LedgerRepository
+	policy     DuplicatePolicy
+	metrics    *LedgerMetrics
+	duplicates *[]Duplicate
+}
+
+// NewDeduplicatedLedgerRepository over the repository.
+func NewDeduplicatedLedgerRepository(
+	repository LedgerRepository,
+	policy DuplicatePolicy,
+) *DeduplicatedLedgerRepository {
+	return &DeduplicatedLedgerRepository{
+		repository: repository,
+		policy:     policy,
+		duplicates: &[]Duplicate{},
+	}
+}
+
+// InstrumentWith metrics shared with other repositories, to count the
+// duplicates found.
+func (dlr *DeduplicatedLedgerRepository) InstrumentWith(ledgerMetrics *LedgerMetrics) {
+	dlr.metrics = ledgerMetrics
+}
+
+func (dlr DeduplicatedLedgerRepository) FetchAll(ctx context.Context) ([]gold_sales.GoldPayment, error) {
+	span, ctx := tracing.StartSpanFromContext(ctx, "DeduplicatedLedgerRepository.FetchAll")
+	span.SetTag("policy", string(dlr.policy))
+	defer span.Finish()
+
+	payments, err := dlr.repository.FetchAll(ctx)
+	if err != nil {
+		return nil, err
+	}
+	unique, duplicates := FindDuplicates(payments)
+	*dlr.duplicates = duplicates
+	span.SetTag("duplicates", len(payments)-len(unique))
+	dlr.metrics.recordDuplicates(dlr.policy, len(payments)-len(unique))
+
+	switch {
+	case dlr.policy == FailOnDuplicates && len(duplicates) > 0:
+		return nil, LedgerRepositoryError{
+			Message: fmt.Sprintf("%d payments are duplicated, the first is %s",
+				len(duplicates), duplicates[0].ID),
+			Reason: RejectedDuplicate,
+		}
+	case dlr.policy == WarnDuplicates:
+		for i := range payments {
+			payments[i].ID = payments[i].TransactionID()
+		}
+		return payments, nil
+	}
+	return unique, nil
+}
+
+// Close the repository being deduplicated.
+func (dlr DeduplicatedLedgerRepository) Close() error {
+	return CloseLedger(dlr.repository)
+}
+
+// Duplicates found by the last FetchAll.
+func (dlr DeduplicatedLedgerRepository) Duplicates() []Duplicate {
+	return *dlr.duplicates
+}
+
+// Sources of the repository, if it can describe its ledgers.
+func (dlr DeduplicatedLedgerRepository) Sources() []gold_sales.InputProvenance {
+	if source, ok := dlr.repository.(LedgerSource); ok {
+		return source.Sources()
+	}
+	return nil
+}
+
+// Violations of the business rules found by the repository, if it checks
+// them.
+func (dlr DeduplicatedLedgerRepository) Violations() []gold_sales.RuleViolation {
+	if checker, ok := dlr.repository.(RuleChecker); ok {
+		return checker.Violations()
+	}
+	return nil
+}
+
+// Policy applied to the duplicates.
+func (dlr DeduplicatedLedgerRepository) Policy() DuplicatePolicy {
+	return dlr.policy
+}
@@ -0,0 +1,74 @@
+package repository
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/JonPulfer/gold_sales/pkg/gold_sales"
+	"github.com/JonPulfer/gold_sales/pkg/gold_sales/infrastructure/metrics"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDeduplicatedLedgerRepository(t *testing.T) {
+	spender := gold_sales.Spender{FirstName: "Alayna", LastName: "Sparks",
+		Email: "alayna.sparks@mailinator.com"}
+	spend := func(amount float64, reference string) gold_sales.GoldPayment {
+		return gold_sales.GoldPayment{Spender: spender, Description: gold_sales.GoldSpend,
+			Amount: amount, Rate: 47.0892, FromCurrency: "GBP",
+			ToCurrency: gold_sales.GoldCurrencyCode, Reference: reference,
+			Date: time.Date(2020, 3, 22, 13, 28, 0, 0, time.UTC)}
+	}
+	// The same ledger exported twice with overlapping rows, the references
+	// keeping apart two spends with the same contents.
+	ledger := MockLedger{spender: {
+		spend(100, ""), spend(250, ""), spend(100, ""), spend(100, ""),
+		spend(50, "T1"), spend(50, "T2"), spend(50, "T1"),
+	}}
+
+	testCases := []struct {
+		Policy        DuplicatePolicy
+		Payments      int
+		ErrorExpected bool
+	}{
+		{DropDuplicates, 4, false},
+		{WarnDuplicates, 7, false},
+		{FailOnDuplicates, 0, true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(string(tc.Policy), func(t *testing.T) {
+			ledgerMetrics := NewLedgerMetrics(metrics.NewRegistry())
+			repos := NewDeduplicatedLedgerRepository(NewMockLedgerRepository(ledger), tc.Policy)
+			repos.InstrumentWith(ledgerMetrics)
+
+			payments, err := repos.FetchAll(context.Background())
+			if tc.ErrorExpected {
+				require.NotNil(t, err, "expected error")
+				assert.Equal(t, RejectedDuplicate, err.(LedgerRepositoryError).Reason)
+			} else {
+				require.Nil(t, err, "unexpected error")
+				assert.Len(t, payments, tc.Payments)
+				for _, payment := range payments {
+					assert.NotEmpty(t, payment.ID, "every payment carries its ID")
+				}
+			}
+
+			duplicates := repos.Duplicates()
+			require.Len(t, duplicates, 2)
+			assert.Equal(t, 3, duplicates[0].Count)
+			assert.Equal(t, 100.0, duplicates[0].Payment.Amount)
+			assert.Equal(t, "T1", duplicates[1].ID)
+			assert.Equal(t, 2, duplicates[1].Count)
+			assert.Equal(t, 3.0, ledgerMetrics.Duplicates.Value(string(tc.Policy)))
+		})
+	}
+
+	policy, err := ParseDuplicatePolicy("")
+	require.Nil(t, err)
+	assert.Equal(t, WarnDuplicates, policy, "duplicates are kept unless asked otherwise")
+	_, err = ParseDuplicatePolicy("ignore")
+	assert.NotNil(t, err, "expected error for an unknown policy")
+}
@@ -0,0 +1,299 @@
+package repository
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+
+	"github.com/JonPulfer/gold_sales/pkg/gold_sales"
+	"github.com/JonPulfer/gold_sales/pkg/gold_sales/infrastructure/tracing"
+)
+
+// EventLog is an append only journal of LedgerEvents kept as JSON lines, one
+// event per line. Every event carries its sequence number and a checksum
+// chained with the event before it, so the log is verified as it is read.
+// It is a LedgerRepository of the gold spends and refunds that stand once
+// corrections and reversals have been replayed. Appends hold a lock file
+// beside the log, so only one process appends at a time, and a final line
+// left unfinished by an append that crashed is dropped.
+type EventLog struct {
+	filename string
+	source   *gold_sales.InputProvenance
+}
+
+// NewEventLog using the file, which is created when the first events are
+// appended.
+func NewEventLog(filename string) *EventLog {
+	return &EventLog{
+		filename: filename,
+		source:   &gold_sales.InputProvenance{},
+	}
+}
+
+// Sources of the payments from the last FetchAll.
+func (el EventLog) Sources() []gold_sales.InputProvenance {
+	if el.source == nil || el.source.SHA256 == "" {
+		return nil
+	}
+	return []gold_sales.InputProvenance{*el.source}
+}
+
+// FetchAll of the gold spends standing in the log.
+func (el EventLog) FetchAll(ctx context.Context) ([]gold_sales.GoldPayment, error) {
+	span, ctx := tracing.StartSpanFromContext(ctx, "EventLog.FetchAll")
+	span.SetTag("filename", el.filename)
+	defer span.Finish()
+
+	events, checksum, _, err := el.readEvents(ctx)
+	if err != nil {
+		return nil, err
+	}
+	transactions, err := gold_sales.ReplayLedgerEvents(events)
+	if err != nil {
+		return nil, LedgerRepositoryError{Message: "failed to replay event log: " + err.Error()}
+	}
+
+	goldPayments := make([]gold_sales.GoldPayment, 0, len(transactions))
+	for _, transaction := range transactions {
+		if payment, ok := transaction.AsGoldSpend(); ok {
+			goldPayments = append(goldPayments, payment)
+		}
+	}
+	span.SetTag("events", len(events)).SetTag("payments", len(goldPayments))
+
+	if el.source != nil {
+		*el.source = gold_sales.InputProvenance{
+			Filename:     el.filename,
+			SHA256:       checksum,
+			Rows:         len(events),
+			GoldPayments: len(goldPayments),
+			Rejected:     len(events) - len(goldPayments),
+		}
+	}
+
+	return goldPayments, nil
+}
+
+// Events in the log, in sequence order, once the log has been verified.
+func (el EventLog) Events(ctx context.Context) ([]gold_sales.LedgerEvent, error) {
+	events, _, _, err := el.readEvents(ctx)
+	return events, err
+}
+
+// Balances of gold held by each spender, projected from the transactions
+// standing in the log.
+func (el EventLog) Balances(ctx context.Context) ([]gold_sales.GoldBalance, error) {
+	events, _, _, err := el.readEvents(ctx)
+	if err != nil {
+		return nil, err
+	}
+	transactions, err := gold_sales.ReplayLedgerEvents(events)
+	if err != nil {
+		return nil, LedgerRepositoryError{Message: "failed to replay event log: " + err.Error()}
+	}
+	return gold_sales.GoldBalances(transactions), nil
+}
+
+// AppendTransactions to the log as spend, buy, sell and refund events.
+func (el EventLog) AppendTransactions(
+	ctx context.Context,
+	transactions []gold_sales.GoldPayment,
+) ([]gold_sales.LedgerEvent, error) {
+	events := make([]gold_sales.LedgerEvent, 0, len(transactions))
+	for _, transaction := range transactions {
+		event, err := gold_sales.NewTransactionEvent(transaction)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, event)
+	}
+	return el.Append(ctx, events...)
+}
+
+// Append the events to the log, numbering them after the last event and
+// chaining their checksums. The events are only written if the log still
+// replays with them added, so a correction or reversal must target a
+// standing transaction. An unfinished final line is truncated before the
+// events are written. The appended events are returned.
+func (el EventLog) Append(
+	ctx context.Context,
+	events ...gold_sales.LedgerEvent,
+) ([]gold_sales.LedgerEvent, error) {
+	span, ctx := tracing.StartSpanFromContext(ctx, "EventLog.Append")
+	span.SetTag("filename", el.filename).SetTag("events", len(events))
+	defer span.Finish()
+
+	unlock, err := el.lock()
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	existing, _, complete, err := el.readEvents(ctx)
+	if err != nil && !os.IsNotExist(errors.Cause(err)) {
+		return nil, err
+	}
+
+	var sequence uint64
+	var previous string
+	if len(existing) > 0 {
+		sequence = existing[len(existing)-1].Sequence
+		previous = existing[len(existing)-1].Checksum
+	}
+	now := time.Now().UTC()
+	appended := make([]gold_sales.LedgerEvent, len(events))
+	for i, event := range events {
+		sequence++
+		event.Sequence = sequence
+		if event.RecordedAt.IsZero() {
+			event.RecordedAt = now
+		}
+		event.Checksum = ""
+		event.Checksum, err = eventChecksum(previous, event)
+		if err != nil {
+			return nil, err
+		}
+		previous = event.Checksum
+		appended[i] = event
+	}
+	if _, err := gold_sales.ReplayLedgerEvents(append(existing, appended...)); err != nil {
+		return nil, err
+	}
+
+	file, err := os.OpenFile(el.filename, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+	if info, err := file.Stat(); err == nil && info.Size() > complete {
+		if err := file.Truncate(complete); err != nil {
+			file.Close()
+			return nil, errors.Wrap(err, "failed to truncate unfinished event")
+		}
+	}
+	buf := bufio.NewWriter(file)
+	encoder := json.NewEncoder(buf)
+	for _, event := range appended {
+		if err := encoder.Encode(event); err != nil {
+			file.Close()
+			return nil, err
+		}
+	}
+	if err := buf.Flush(); err != nil {
+		file.Close()
+		return nil, err
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return nil, errors.Wrap(err, "failed to sync event log")
+	}
+	return appended, file.Close()
+}
+
+// lock the log for appending by creating a lock file beside it, which fails
+// while another append holds it. The returned func releases the lock.
+func (el EventLog) lock() (func(), error) {
+	lockFilename := el.filename + ".lock"
+	file, err := os.OpenFile(lockFilename, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+	if os.IsExist(err) {
+		return nil, errors.Errorf(
+			"event log is locked by another append, remove %s if none is running", lockFilename)
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to lock event log")
+	}
+	if err := file.Close(); err != nil {
+		_ = os.Remove(lockFilename)
+		return nil, errors.Wrap(err, "failed to lock event log")
+	}
+	return func() { _ = os.Remove(lockFilename) }, nil
+}
+
+// readEvents from the log, checking the sequence numbers run on from one and
+// every checksum matches. It returns the SHA-256 of the events read and the
+// length of the file they take up. A final line without a newline is an
+// append that never finished, so it is left out with a warning rather than
+// failing the read.
+func (el EventLog) readEvents(ctx context.Context) ([]gold_sales.LedgerEvent, string, int64, error) {
+	span, _ := tracing.StartSpanFromContext(ctx, "EventLog.readEvents")
+	defer span.Finish()
+
+	file, err := os.Open(el.filename)
+	if err != nil {
+		return nil, "", 0, err
+	}
+	defer file.Close()
+
+	events := make([]gold_sales.LedgerEvent, 0)
+	hash := sha256.New()
+	reader := bufio.NewReader(file)
+	var complete int64
+	var previous string
+	for line := 1; ; line++ {
+		raw, err := reader.ReadBytes('\n')
+		if err == io.EOF {
+			if len(raw) > 0 {
+				log.Warn().Str("filename", el.filename).Int("line", line).
+					Msg("ignoring unfinished event at the end of the event log")
+			}
+			break
+		}
+		if err != nil {
+			return nil, "", 0, err
+		}
+
+		var event gold_sales.LedgerEvent
+		if err := json.Unmarshal(raw, &event); err != nil {
+			return nil, "", 0, corruptEventLog(line, "failed to parse event: "+err.Error())
+		}
+		if event.Sequence != uint64(len(events)+1) {
+			return nil, "", 0, corruptEventLog(line,
+				fmt.Sprintf("expected sequence %d, found %d", len(events)+1, event.Sequence))
+		}
+		recorded := event.Checksum
+		event.Checksum = ""
+		checksum, err := eventChecksum(previous, event)
+		if err != nil {
+			return nil, "", 0, err
+		}
+		if recorded != checksum {
+			return nil, "", 0, corruptEventLog(line,
+				fmt.Sprintf("checksum of event %d does not match", event.Sequence))
+		}
+		event.Checksum = recorded
+		previous = recorded
+		events = append(events, event)
+		hash.Write(raw)
+		complete = complete + int64(len(raw))
+	}
+	span.SetTag("events", len(events))
+
+	return events, hex.EncodeToString(hash.Sum(nil)), complete, nil
+}
+
+// eventChecksum is the SHA-256 of the checksum of the previous event and the
+// event encoded without its own checksum.
+func eventChecksum(previous string, event gold_sales.LedgerEvent) (string, error) {
+	encoded, err := json.Marshal(event)
+	if err != nil {
+		return "", err
+	}
+	hash := sha256.New()
+	hash.Write([]byte(previous))
+	hash.Write(encoded)
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+func corruptEventLog(line int, message string) error {
+	return LedgerRepositoryError{
+		Message: fmt.Sprintf("event log is corrupt on line %d: %s", line, message),
+	}
+}
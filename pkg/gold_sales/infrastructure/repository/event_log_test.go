@@ -0,0 +1,192 @@
+package repository
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/JonPulfer/gold_sales/pkg/gold_sales"
+)
+
+func TestEventLogReplaysCorrectionsAndReversals(t *testing.T) {
+	ledger := "first_name,last_name,email,description,merchant_code,amount,from_currency,to_currency,rate,date\n" +
+		"Alayna,Sparks,alayna.sparks@mailinator.com,CARD SPEND,5311,2629.16,GBP,GGM,47.0892,22/03/2020 13:28\n" +
+		"Niyah,Singleton,niyah.singleton@mailinator.com,CARD SPEND,5462,682.28,GBP,GGM,47.1,12/05/2020 08:22\n" +
+		"Riley,Hayden,riley.hayden@mailinator.com,SELL GOLD,,2.91,GGM,GBP,47.7534,18/05/2020 14:40\n"
+	clr, err := NewCSVLedgerRepository(writeTempLedger(t, ledger))
+	require.Nil(t, err)
+	ctx := context.Background()
+	transactions, err := clr.FetchTransactions(ctx)
+	require.Nil(t, err)
+	require.Len(t, transactions, 3)
+
+	dir, err := ioutil.TempDir("", "events")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+	log := NewEventLog(filepath.Join(dir, "ledger.events"))
+
+	appended, err := log.AppendTransactions(ctx, transactions)
+	require.Nil(t, err, "unexpected error")
+	assert.Equal(t, []gold_sales.EventType{gold_sales.EventSpend, gold_sales.EventSpend,
+		gold_sales.EventSell}, []gold_sales.EventType{appended[0].Type, appended[1].Type,
+		appended[2].Type})
+	assert.Equal(t, uint64(3), appended[2].Sequence)
+
+	corrected := transactions[0]
+	corrected.Amount = 262.916
+	_, err = log.Append(ctx,
+		gold_sales.NewCorrectionEvent(1, corrected, "amount keyed in wrong"),
+		gold_sales.NewReversalEvent(2, "charged back"))
+	require.Nil(t, err, "unexpected error")
+
+	_, err = log.Append(ctx, gold_sales.NewReversalEvent(2, "charged back again"))
+	assert.NotNil(t, err, "expected error reversing a reversed transaction")
+
+	payments, err := log.FetchAll(ctx)
+	require.Nil(t, err, "unexpected error")
+	assert.Equal(t, []gold_sales.GoldPayment{corrected}, payments)
+
+	events, err := log.Events(ctx)
+	require.Nil(t, err)
+	require.Len(t, events, 5, "the rejected reversal is not written")
+	assert.Equal(t, uint64(5), events[4].Sequence)
+	require.Len(t, log.Sources(), 1)
+	assert.Equal(t, 5, log.Sources()[0].Rows)
+	assert.Equal(t, 1, log.Sources()[0].GoldPayments)
+}
+
+func TestEventLogDetectsChangedHistory(t *testing.T) {
+	spend := gold_sales.GoldPayment{
+		Spender:     gold_sales.Spender{Email: "alayna.sparks@mailinator.com"},
+		Description: gold_sales.GoldSpend,
+		Amount:      2629.16,
+		ToCurrency:  gold_sales.GoldCurrencyCode,
+	}
+
+	testCases := []struct {
+		Name   string
+		Change func(contents string) string
+	}{
+		{"Amount changed", func(contents string) string {
+			return strings.Replace(contents, "2629.16", "26.29", 1)
+		}},
+		{"Event removed", func(contents string) string {
+			lines := strings.SplitAfter(contents, "\n")
+			return lines[0] + lines[2]
+		}},
+		{"Events reordered", func(contents string) string {
+			lines := strings.SplitAfter(contents, "\n")
+			return lines[1] + lines[0] + lines[2]
+		}},
+		{"Partial event before the last", func(contents string) string {
+			lines := strings.SplitAfter(contents, "\n")
+			return lines[0] + `{"sequence":2,"type":"sp` + "\n" + lines[2]
+		}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "events")
+			require.Nil(t, err)
+			defer os.RemoveAll(dir)
+			filename := filepath.Join(dir, "ledger.events")
+			log := NewEventLog(filename)
+			ctx := context.Background()
+			_, err = log.AppendTransactions(ctx, []gold_sales.GoldPayment{spend, spend, spend})
+			require.Nil(t, err)
+
+			contents, err := ioutil.ReadFile(filename)
+			require.Nil(t, err)
+			require.Nil(t, ioutil.WriteFile(filename, []byte(tc.Change(string(contents))), 0644))
+
+			_, err = log.FetchAll(ctx)
+			require.NotNil(t, err, "expected error")
+			assert.IsType(t, LedgerRepositoryError{}, err)
+			_, err = log.AppendTransactions(ctx, []gold_sales.GoldPayment{spend})
+			assert.NotNil(t, err, "expected appending to a corrupt log to fail")
+		})
+	}
+}
+
+func TestEventLogDropsUnfinishedAppend(t *testing.T) {
+	spend := gold_sales.GoldPayment{
+		Spender:     gold_sales.Spender{Email: "alayna.sparks@mailinator.com"},
+		Description: gold_sales.GoldSpend,
+		Amount:      2629.16,
+		ToCurrency:  gold_sales.GoldCurrencyCode,
+	}
+	dir, err := ioutil.TempDir("", "events")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "ledger.events")
+	log := NewEventLog(filename)
+	ctx := context.Background()
+	_, err = log.AppendTransactions(ctx, []gold_sales.GoldPayment{spend, spend})
+	require.Nil(t, err)
+
+	file, err := os.OpenFile(filename, os.O_APPEND|os.O_WRONLY, 0644)
+	require.Nil(t, err)
+	_, err = file.WriteString(`{"sequence":3,"type":"sp`)
+	require.Nil(t, err)
+	require.Nil(t, file.Close())
+
+	payments, err := log.FetchAll(ctx)
+	require.Nil(t, err, "unexpected error")
+	assert.Len(t, payments, 2)
+
+	appended, err := log.AppendTransactions(ctx, []gold_sales.GoldPayment{spend})
+	require.Nil(t, err, "unexpected error")
+	assert.Equal(t, uint64(3), appended[0].Sequence)
+	events, err := log.Events(ctx)
+	require.Nil(t, err, "expected the unfinished event to be truncated")
+	assert.Len(t, events, 3)
+}
+
+func TestEventLogAppendsOneAtATime(t *testing.T) {
+	dir, err := ioutil.TempDir("", "events")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "ledger.events")
+	log := NewEventLog(filename)
+	spend := gold_sales.GoldPayment{Description: gold_sales.GoldSpend, ToCurrency: gold_sales.GoldCurrencyCode}
+
+	require.Nil(t, ioutil.WriteFile(filename+".lock", nil, 0644))
+	_, err = log.AppendTransactions(context.Background(), []gold_sales.GoldPayment{spend})
+	assert.NotNil(t, err, "expected error appending while the log is locked")
+
+	require.Nil(t, os.Remove(filename+".lock"))
+	_, err = log.AppendTransactions(context.Background(), []gold_sales.GoldPayment{spend})
+	require.Nil(t, err, "unexpected error")
+	_, err = os.Stat(filename + ".lock")
+	assert.True(t, os.IsNotExist(err), "expected the lock to be released")
+}
+
+func TestEventLogBalances(t *testing.T) {
+	jo := gold_sales.Spender{FirstName: "Jo", LastName: "Smith", Email: "jo@mock.com"}
+	buy := gold_sales.GoldPayment{Spender: jo, Description: gold_sales.GoldBuy, Amount: 400,
+		Rate: 40, FromCurrency: "GBP", ToCurrency: gold_sales.GoldCurrencyCode, GramWeight: 10}
+	spend := gold_sales.GoldPayment{Spender: jo, Description: gold_sales.GoldSpend, Amount: 80,
+		Rate: 40, FromCurrency: "GBP", ToCurrency: gold_sales.GoldCurrencyCode, GramWeight: 2}
+
+	dir, err := ioutil.TempDir("", "events")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+	log := NewEventLog(filepath.Join(dir, "ledger.events"))
+	ctx := context.Background()
+	_, err = log.AppendTransactions(ctx, []gold_sales.GoldPayment{buy, spend, spend})
+	require.Nil(t, err)
+	_, err = log.Append(ctx, gold_sales.NewReversalEvent(3, "charged back"))
+	require.Nil(t, err)
+
+	balances, err := log.Balances(ctx)
+	require.Nil(t, err, "unexpected error")
+	require.Len(t, balances, 1)
+	assert.InDelta(t, 8.0, balances[0].Grams, 0.0001)
+	assert.Equal(t, 2, balances[0].Transactions)
+}
@@ -0,0 +1,120 @@
+package repository
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"os"
+
+	"github.com/pkg/errors"
+
+	"github.com/JonPulfer/gold_sales/pkg/gold_sales"
+	"github.com/JonPulfer/gold_sales/pkg/gold_sales/infrastructure/tracing"
+)
+
+// JSONLedgerRepository keeps Gold Payments in a file of JSON lines, one
+// payment per line. It is both a LedgerRepository and a LedgerStore so
+// ledgers can be imported once and reported on many times.
+type JSONLedgerRepository struct {
+	filename string
+	source   *gold_sales.InputProvenance
+}
+
+// NewJSONLedgerRepository using the file, which is created when the first
+// payments are stored.
+func NewJSONLedgerRepository(filename string) *JSONLedgerRepository {
+	return &JSONLedgerRepository{
+		filename: filename,
+		source:   &gold_sales.InputProvenance{},
+	}
+}
+
+// Sources of the payments from the last FetchAll.
+func (jlr JSONLedgerRepository) Sources() []gold_sales.InputProvenance {
+	if jlr.source == nil || jlr.source.SHA256 == "" {
+		return nil
+	}
+	return []gold_sales.InputProvenance{*jlr.source}
+}
+
+func (jlr JSONLedgerRepository) FetchAll(ctx context.Context) ([]gold_sales.GoldPayment, error) {
+	span, _ := tracing.StartSpanFromContext(ctx, "JSONLedgerRepository.FetchAll")
+	span.SetTag("filename", jlr.filename)
+	defer span.Finish()
+
+	file, err := os.Open(jlr.filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	goldPayments := make([]gold_sales.GoldPayment, 0)
+	hash := sha256.New()
+	scanner := bufio.NewScanner(io.TeeReader(file, hash))
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	line := 0
+	for scanner.Scan() {
+		line++
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var payment gold_sales.GoldPayment
+		if err := json.Unmarshal(scanner.Bytes(), &payment); err != nil {
+			return nil, errors.Wrapf(err, "failed to parse payment on line %d", line)
+		}
+		goldPayments = append(goldPayments, payment)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	span.SetTag("payments", len(goldPayments))
+
+	if jlr.source != nil {
+		*jlr.source = gold_sales.InputProvenance{
+			Filename:     jlr.filename,
+			SHA256:       hex.EncodeToString(hash.Sum(nil)),
+			Rows:         len(goldPayments),
+			GoldPayments: len(goldPayments),
+		}
+	}
+
+	return goldPayments, nil
+}
+
+// Store the payments at the end of the file.
+func (jlr JSONLedgerRepository) Store(ctx context.Context, payments []gold_sales.GoldPayment) error {
+	span, _ := tracing.StartSpanFromContext(ctx, "JSONLedgerRepository.Store")
+	span.SetTag("filename", jlr.filename).SetTag("payments", len(payments))
+	defer span.Finish()
+
+	file, err := os.OpenFile(jlr.filename, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+
+	buf := bufio.NewWriter(file)
+	encoder := json.NewEncoder(buf)
+	for _, payment := range payments {
+		if err := encoder.Encode(payment); err != nil {
+			file.Close()
+			return err
+		}
+	}
+	if err := buf.Flush(); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// Truncate the store, removing every payment.
+func (jlr JSONLedgerRepository) Truncate(_ context.Context) error {
+	err := os.Remove(jlr.filename)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,51 @@
+package repository
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/JonPulfer/gold_sales/pkg/gold_sales"
+)
+
+func TestJSONLedgerRepositoryRoundTrip(t *testing.T) {
+	dir, err := ioutil.TempDir("", "store")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	store := NewJSONLedgerRepository(filepath.Join(dir, "ledger.jsonl"))
+	ctx := context.Background()
+	payment := gold_sales.GoldPayment{
+		Spender: gold_sales.Spender{
+			FirstName: "Alayna",
+			LastName:  "Sparks",
+			Email:     "alayna.sparks@mailinator.com",
+		},
+		Description:  gold_sales.GoldSpend,
+		Amount:       2629.16,
+		Rate:         47.0892,
+		ToCurrency:   gold_sales.GoldCurrencyCode,
+		FromCurrency: "GBP",
+		Date:         time.Date(2020, 3, 22, 13, 28, 0, 0, time.UTC),
+		GramWeight:   2629.16 / 47.0892,
+	}
+
+	require.Nil(t, store.Store(ctx, []gold_sales.GoldPayment{payment}))
+	require.Nil(t, store.Store(ctx, []gold_sales.GoldPayment{payment}))
+
+	payments, err := store.FetchAll(ctx)
+	require.Nil(t, err, "unexpected error")
+	require.Len(t, payments, 2, "stores should append")
+	assert.Equal(t, payment, payments[0])
+
+	require.Nil(t, store.Truncate(ctx))
+	require.Nil(t, store.Truncate(ctx), "truncating an empty store is fine")
+	_, err = store.FetchAll(ctx)
+	assert.NotNil(t, err, "expected error reading a missing store")
+}
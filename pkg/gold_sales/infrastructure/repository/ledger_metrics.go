@@ -0,0 +1,88 @@
+package repository
+
+import (
+	"time"
+
+	"github.com/JonPulfer/gold_sales/pkg/gold_sales"
+	"github.com/JonPulfer/gold_sales/pkg/gold_sales/infrastructure/metrics"
+)
+
+// LedgerMetrics recorded while fetching payments from a ledger. A nil
+// LedgerMetrics records nothing.
+type LedgerMetrics struct {
+	RowsRead      *metrics.Counter
+	RowsRejected  *metrics.Counter
+	Payments      *metrics.Counter
+	Duplicates    *metrics.Counter
+	Violations    *metrics.Counter
+	ParseDuration *metrics.Histogram
+}
+
+// NewLedgerMetrics registered in the Registry.
+func NewLedgerMetrics(registry *metrics.Registry) *LedgerMetrics {
+	return &LedgerMetrics{
+		RowsRead: registry.Counter(
+			"gold_sales_ledger_rows_read_total",
+			"Rows read from the ledger, excluding the header."),
+		RowsRejected: registry.Counter(
+			"gold_sales_ledger_rows_rejected_total",
+			"Rows that did not produce a gold payment, by reason.",
+			"reason"),
+		Payments: registry.Counter(
+			"gold_sales_ledger_payments_total",
+			"Rows read from the ledger by transaction type.",
+			"description"),
+		Duplicates: registry.Counter(
+			"gold_sales_ledger_duplicates_total",
+			"Payments found again with the ID of an earlier payment, by the policy applied.",
+			"policy"),
+		Violations: registry.Counter(
+			"gold_sales_ledger_rule_violations_total",
+			"Payments that broke a business rule, by rule and severity.",
+			"rule", "severity"),
+		ParseDuration: registry.Histogram(
+			"gold_sales_ledger_parse_duration_seconds",
+			"Time taken to read and parse the ledger.",
+			metrics.DefaultDurationBuckets),
+	}
+}
+
+func (lm *LedgerMetrics) recordParse(start time.Time) {
+	if lm == nil {
+		return
+	}
+	lm.ParseDuration.ObserveSince(start)
+}
+
+func (lm *LedgerMetrics) recordRow(description string) {
+	if lm == nil {
+		return
+	}
+	lm.RowsRead.Inc()
+	lm.Payments.Inc(description)
+}
+
+func (lm *LedgerMetrics) recordRejection(err error) {
+	if lm == nil {
+		return
+	}
+	reason := "unknown"
+	if lre, ok := err.(LedgerRepositoryError); ok && lre.Reason != "" {
+		reason = lre.Reason
+	}
+	lm.RowsRejected.Inc(reason)
+}
+
+func (lm *LedgerMetrics) recordDuplicates(policy DuplicatePolicy, duplicates int) {
+	if lm == nil {
+		return
+	}
+	lm.Duplicates.Add(float64(duplicates), string(policy))
+}
+
+func (lm *LedgerMetrics) recordViolation(violation gold_sales.RuleViolation) {
+	if lm == nil {
+		return
+	}
+	lm.Violations.Inc(violation.Rule, string(violation.Severity))
+}
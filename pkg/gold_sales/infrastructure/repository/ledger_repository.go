@@ -1,12 +1,43 @@
 package repository
 
 import (
+	"context"
+	"io"
+
 	"github.com/JonPulfer/gold_sales/pkg/gold_sales"
 )
 
 // LedgerRepository provides access to stored GoldTransactions.
 type LedgerRepository interface {
-	FetchAll() ([]gold_sales.GoldPayment, error)
+	FetchAll(ctx context.Context) ([]gold_sales.GoldPayment, error)
+}
+
+// LedgerSource is a LedgerRepository that can describe the ledgers its
+// payments were last fetched from.
+type LedgerSource interface {
+	Sources() []gold_sales.InputProvenance
+}
+
+// CloseLedger closes the repository if it holds its ledger open, as CSV
+// ledgers and the repositories wrapping them do.
+func CloseLedger(repository LedgerRepository) error {
+	if closer, ok := repository.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+// RuleChecker is a LedgerRepository that checks the payments it fetches
+// against business rules, and can list the violations last found.
+type RuleChecker interface {
+	Violations() []gold_sales.RuleViolation
+}
+
+// LedgerStore keeps GoldPayments loaded from another LedgerRepository.
+type LedgerStore interface {
+	LedgerRepository
+	Store(ctx context.Context, payments []gold_sales.GoldPayment) error
+	Truncate(ctx context.Context) error
 }
 
 type MockLedgerRepository struct {
@@ -19,7 +50,7 @@ func NewMockLedgerRepository(mockLedger MockLedger) *MockLedgerRepository {
 	return &MockLedgerRepository{ledger: mockLedger}
 }
 
-func (mlr MockLedgerRepository) FetchAll() ([]gold_sales.GoldPayment, error) {
+func (mlr MockLedgerRepository) FetchAll(_ context.Context) ([]gold_sales.GoldPayment, error) {
 	goldTransactions := make([]gold_sales.GoldPayment, 0)
 	for _, spenderPayments := range mlr.ledger {
 		goldTransactions = append(goldTransactions, spenderPayments...)
@@ -29,8 +60,19 @@ func (mlr MockLedgerRepository) FetchAll() ([]gold_sales.GoldPayment, error) {
 
 type LedgerRepositoryError struct {
 	Message string
+	// Reason the row was rejected, suitable for use as a metric label.
+	Reason string
 }
 
+// Reasons a row from a ledger can be rejected.
+const (
+	RejectedFieldCount   = "field_count"
+	RejectedAmount       = "invalid_amount"
+	RejectedRate         = "invalid_rate"
+	RejectedDate         = "invalid_date"
+	RejectedNotGoldSpend = "not_gold_spend"
+)
+
 func (lre LedgerRepositoryError) Error() string {
 	return lre.Message
 }
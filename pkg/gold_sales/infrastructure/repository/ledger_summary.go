@@ -0,0 +1,98 @@
+package repository
+
+import (
+	"context"
+	"sort"
+
+	"github.com/JonPulfer/gold_sales/pkg/gold_sales"
+	"github.com/JonPulfer/gold_sales/pkg/gold_sales/infrastructure/tracing"
+)
+
+// LedgerSummary of every row in a ledger, gold spend or not, used to check a
+// ledger before it is reported on.
+type LedgerSummary struct {
+	Rows           int                            `json:"rows"`
+	GoldPayments   int                            `json:"goldPayments"`
+	GoldRefunds    int                            `json:"goldRefunds"`
+	RowErrors      []RowError                     `json:"rowErrors"`
+	ByDescription  map[string]int                 `json:"byDescription"`
+	ByCurrencyPair map[string]int                 `json:"byCurrencyPair"`
+	ByMonth        map[gold_sales.ReportMonth]int `json:"byMonth"`
+	Duplicates     []Duplicate                    `json:"duplicates"`
+}
+
+// RowError found in the ledger. Line is the line in the file, counting the
+// header as line 1.
+type RowError struct {
+	Line    int    `json:"line"`
+	Reason  string `json:"reason"`
+	Message string `json:"message"`
+}
+
+func newLedgerSummary() *LedgerSummary {
+	return &LedgerSummary{
+		RowErrors:      make([]RowError, 0),
+		ByDescription:  make(map[string]int),
+		ByCurrencyPair: make(map[string]int),
+		ByMonth:        make(map[gold_sales.ReportMonth]int),
+		Duplicates:     make([]Duplicate, 0),
+	}
+}
+
+// Valid when every row could be parsed.
+func (ls LedgerSummary) Valid() bool {
+	return len(ls.RowErrors) == 0
+}
+
+// Months in the summary, most recent first.
+func (ls LedgerSummary) Months() gold_sales.OrderedReportMonths {
+	months := make(gold_sales.OrderedReportMonths, 0, len(ls.ByMonth))
+	for month := range ls.ByMonth {
+		months = append(months, month)
+	}
+	sort.Sort(months)
+	return months
+}
+
+// Summarise every row of the ledger, carrying on past rows that cannot be
+// parsed so that all the problems are reported together. Duplicates are the
+// transactions of any type found more than once.
+func (clr CSVLedgerRepository) Summarise(ctx context.Context) (*LedgerSummary, error) {
+	span, ctx := tracing.StartSpanFromContext(ctx, "CSVLedgerRepository.Summarise")
+	span.SetTag("filename", clr.filename)
+	defer span.Finish()
+
+	rows, lines, _, err := clr.readRows(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	summary := newLedgerSummary()
+	transactions := make([]gold_sales.GoldPayment, 0, len(rows))
+	for rowIdx, row := range rows {
+		summary.Rows++
+		transaction, err := clr.parseTransaction(row)
+		if err != nil {
+			rowError := RowError{Line: lines[rowIdx], Message: err.Error()}
+			if lre, ok := err.(LedgerRepositoryError); ok {
+				rowError.Reason = lre.Reason
+			}
+			summary.RowErrors = append(summary.RowErrors, rowError)
+			continue
+		}
+
+		summary.ByDescription[transaction.Description]++
+		summary.ByCurrencyPair[transaction.FromCurrency+"/"+transaction.ToCurrency]++
+		summary.ByMonth[gold_sales.ParseReportMonth(transaction.Date)]++
+		if transaction.IsGoldSpend() {
+			summary.GoldPayments++
+		} else if transaction.IsGoldRefund() {
+			summary.GoldRefunds++
+		}
+		transactions = append(transactions, *transaction)
+	}
+	_, summary.Duplicates = FindDuplicates(transactions)
+	span.SetTag("rows", summary.Rows).SetTag("rowErrors", len(summary.RowErrors))
+
+	return summary, nil
+}
@@ -0,0 +1,77 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/JonPulfer/gold_sales/pkg/gold_sales"
+	"github.com/JonPulfer/gold_sales/pkg/gold_sales/infrastructure/tracing"
+)
+
+// ValidatedLedgerRepository checks the payments of another repository
+// against the rules configured for it, leaving out the payments a rule
+// rejects.
+type ValidatedLedgerRepository struct {
+	repository LedgerRepository
+	source     string
+	rules      *gold_sales.RuleSet
+	metrics    *LedgerMetrics
+	violations *[]gold_sales.RuleViolation
+}
+
+// NewValidatedLedgerRepository checking the payments of the repository,
+// named source in the violations, against the rules.
+func NewValidatedLedgerRepository(
+	repository LedgerRepository,
+	source string,
+	rules *gold_sales.RuleSet,
+) *ValidatedLedgerRepository {
+	return &ValidatedLedgerRepository{
+		repository: repository,
+		source:     source,
+		rules:      rules,
+		violations: &[]gold_sales.RuleViolation{},
+	}
+}
+
+// InstrumentWith metrics shared with other repositories, to count the rule
+// violations found.
+func (vlr *ValidatedLedgerRepository) InstrumentWith(ledgerMetrics *LedgerMetrics) {
+	vlr.metrics = ledgerMetrics
+}
+
+func (vlr ValidatedLedgerRepository) FetchAll(ctx context.Context) ([]gold_sales.GoldPayment, error) {
+	span, ctx := tracing.StartSpanFromContext(ctx, "ValidatedLedgerRepository.FetchAll")
+	span.SetTag("source", vlr.source)
+	defer span.Finish()
+
+	payments, err := vlr.repository.FetchAll(ctx)
+	if err != nil {
+		return nil, err
+	}
+	kept, violations := vlr.rules.Apply(vlr.source, payments)
+	*vlr.violations = violations
+	for _, violation := range violations {
+		vlr.metrics.recordViolation(violation)
+	}
+	span.SetTag("violations", len(violations)).SetTag("rejected", len(payments)-len(kept))
+
+	return kept, nil
+}
+
+// Close the repository being validated.
+func (vlr ValidatedLedgerRepository) Close() error {
+	return CloseLedger(vlr.repository)
+}
+
+// Violations found by the last FetchAll.
+func (vlr ValidatedLedgerRepository) Violations() []gold_sales.RuleViolation {
+	return *vlr.violations
+}
+
+// Sources of the repository, if it can describe its ledgers.
+func (vlr ValidatedLedgerRepository) Sources() []gold_sales.InputProvenance {
+	if source, ok := vlr.repository.(LedgerSource); ok {
+		return source.Sources()
+	}
+	return nil
+}
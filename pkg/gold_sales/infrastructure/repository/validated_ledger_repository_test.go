@@ -0,0 +1,52 @@
+package repository
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/JonPulfer/gold_sales/pkg/gold_sales"
+	"github.com/JonPulfer/gold_sales/pkg/gold_sales/infrastructure/metrics"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidatedLedgerRepository(t *testing.T) {
+	spender := gold_sales.Spender{Email: "alayna.sparks@mailinator.com"}
+	spend := func(amount float64) gold_sales.GoldPayment {
+		return gold_sales.GoldPayment{Spender: spender, Description: gold_sales.GoldSpend,
+			Amount: amount, Rate: 50, ToCurrency: gold_sales.GoldCurrencyCode,
+			GramWeight: amount / 50, Date: time.Date(2020, 3, 22, 13, 28, 0, 0, time.UTC)}
+	}
+	registry := gold_sales.NewRuleRegistry()
+	rejectLarge, err := registry.Build([]gold_sales.RuleConfig{
+		{Rule: "maxGramWeight", Severity: gold_sales.RuleReject, Limit: 10}})
+	require.Nil(t, err)
+	warnLarge, err := registry.Build([]gold_sales.RuleConfig{
+		{Rule: "maxGramWeight", Severity: gold_sales.RuleWarn, Limit: 10}})
+	require.Nil(t, err)
+
+	ledgerMetrics := NewLedgerMetrics(metrics.NewRegistry())
+	partner := NewValidatedLedgerRepository(NewMockLedgerRepository(MockLedger{
+		spender: {spend(100), spend(1000)}}), "partner.csv", rejectLarge)
+	partner.InstrumentWith(ledgerMetrics)
+	ours := NewValidatedLedgerRepository(NewMockLedgerRepository(MockLedger{
+		spender: {spend(2000)}}), "ours.csv", warnLarge)
+	repos := NewDeduplicatedLedgerRepository(
+		NewCombinedLedgerRepository(partner, ours), DropDuplicates)
+
+	payments, err := repos.FetchAll(context.Background())
+	require.Nil(t, err, "unexpected error")
+	require.Len(t, payments, 2, "the rejected payment is left out")
+	assert.Equal(t, 100.0, payments[0].Amount)
+	assert.Equal(t, 2000.0, payments[1].Amount)
+
+	violations := repos.Violations()
+	require.Len(t, violations, 2)
+	assert.Equal(t, "partner.csv", violations[0].Source)
+	assert.Equal(t, gold_sales.RuleReject, violations[0].Severity)
+	assert.Equal(t, "ours.csv", violations[1].Source)
+	assert.Equal(t, gold_sales.RuleWarn, violations[1].Severity)
+	assert.Equal(t, 1.0, ledgerMetrics.Violations.Value("maxGramWeight", "reject"))
+}
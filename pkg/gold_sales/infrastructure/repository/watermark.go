@@ -0,0 +1,250 @@
+package repository
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding"
+	"encoding/csv"
+	"encoding/hex"
+	"hash"
+	"io"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/JonPulfer/gold_sales/pkg/gold_sales"
+	"github.com/JonPulfer/gold_sales/pkg/gold_sales/infrastructure/tracing"
+)
+
+// ErrWatermarkInvalid is the cause of the error from FetchSince when the
+// ledger was truncated or rewritten after the Watermark was taken, so it has
+// to be ingested again from the start.
+var ErrWatermarkInvalid = errors.New("watermark no longer matches the ledger")
+
+// Watermark of how far an append only CSV ledger has been ingested. Offset is
+// the byte offset after the last row ingested, which starts at LastRowOffset
+// and has the LastRowHash. The HeaderFingerprint is the hash of the header row.
+// ChecksumState is the SHA-256 of the ledger up to the Offset, saved part way
+// so the checksum of the whole ledger can be taken without reading it again.
+type Watermark struct {
+	Offset            int64  `json:"offset"`
+	LastRowOffset     int64  `json:"lastRowOffset"`
+	LastRowHash       string `json:"lastRowHash"`
+	HeaderFingerprint string `json:"headerFingerprint"`
+	Rows              int    `json:"rows"`
+	GoldPayments      int    `json:"goldPayments"`
+	ChecksumState     string `json:"checksumState"`
+}
+
+// IsZero when nothing has been ingested yet.
+func (w Watermark) IsZero() bool {
+	return w == Watermark{}
+}
+
+// IncrementalLedger can fetch only the payments added since a Watermark.
+type IncrementalLedger interface {
+	FetchSince(ctx context.Context, since Watermark) ([]gold_sales.GoldPayment, Watermark, error)
+}
+
+// FetchSince returns the gold payments in the rows appended after the
+// Watermark and the Watermark after them. A final row without its line ending
+// is taken once it has as many fields as the header, as ledgers often end
+// without one. Otherwise it is still being written and is left for the next
+// fetch. The error has the cause ErrWatermarkInvalid when the ledger no longer
+// matches the Watermark. The Sources are the whole ledger ingested so far.
+func (clr *CSVLedgerRepository) FetchSince(
+	ctx context.Context,
+	since Watermark,
+) ([]gold_sales.GoldPayment, Watermark, error) {
+	defer clr.metrics.recordParse(time.Now())
+	span, _ := tracing.StartSpanFromContext(ctx, "CSVLedgerRepository.FetchSince")
+	span.SetTag("filename", clr.filename).SetTag("offset", since.Offset)
+	defer span.Finish()
+
+	if _, err := clr.file.Seek(0, io.SeekStart); err != nil {
+		return nil, since, err
+	}
+	rdr := bufio.NewReader(clr.file)
+	header, complete, err := readRecord(rdr)
+	if err != nil {
+		return nil, since, err
+	}
+	if len(header) == 0 || !complete {
+		return nil, since, LedgerRepositoryError{Message: "ledger is empty, no header row found"}
+	}
+	headerFields, err := parseRecord(header)
+	if err != nil {
+		return nil, since, err
+	}
+	if err := clr.parseHeaders(headerFields); err != nil {
+		return nil, since, err
+	}
+
+	watermark := Watermark{Offset: int64(len(header)), HeaderFingerprint: hashBytes(header)}
+	checksum := sha256.New()
+	_, _ = checksum.Write(header)
+	if !since.IsZero() {
+		if err := clr.checkWatermark(since, watermark.HeaderFingerprint); err != nil {
+			return nil, since, err
+		}
+		if err := restoreChecksum(checksum, since.ChecksumState); err != nil {
+			return nil, since, err
+		}
+		if _, err := clr.file.Seek(since.Offset, io.SeekStart); err != nil {
+			return nil, since, err
+		}
+		rdr.Reset(clr.file)
+		watermark = since
+	}
+
+	goldPayments := make([]gold_sales.GoldPayment, 0)
+	for {
+		raw, complete, err := readRecord(rdr)
+		if err != nil {
+			return nil, since, err
+		}
+		if len(raw) == 0 || !complete && !isFinalRecord(raw, len(headerFields)) {
+			break
+		}
+		row, err := parseRecord(raw)
+		if err != nil {
+			return nil, since, err
+		}
+		if row != nil {
+			clr.metrics.recordRow(clr.description(row))
+			payment, err := clr.parseRow(row)
+			if err != nil {
+				clr.metrics.recordRejection(err)
+				return nil, since, err
+			}
+			if payment != nil {
+				goldPayments = append(goldPayments, *payment)
+				watermark.GoldPayments++
+			} else {
+				clr.metrics.recordRejection(LedgerRepositoryError{
+					Reason: RejectedNotGoldSpend})
+			}
+			watermark.LastRowOffset = watermark.Offset
+			watermark.LastRowHash = hashBytes(raw)
+			watermark.Rows++
+		}
+		watermark.Offset += int64(len(raw))
+		_, _ = checksum.Write(raw)
+	}
+	span.SetTag("payments", len(goldPayments)).SetTag("watermark", watermark.Offset)
+
+	state, err := checksum.(encoding.BinaryMarshaler).MarshalBinary()
+	if err != nil {
+		return nil, since, err
+	}
+	watermark.ChecksumState = hex.EncodeToString(state)
+	if clr.source != nil {
+		*clr.source = gold_sales.InputProvenance{
+			Filename:     clr.filename,
+			SHA256:       hex.EncodeToString(checksum.Sum(nil)),
+			Rows:         watermark.Rows,
+			GoldPayments: watermark.GoldPayments,
+			Rejected:     watermark.Rows - watermark.GoldPayments,
+		}
+	}
+
+	return goldPayments, watermark, nil
+}
+
+// checkWatermark still describes the start of the ledger.
+func (clr *CSVLedgerRepository) checkWatermark(since Watermark, headerFingerprint string) error {
+	if since.HeaderFingerprint != headerFingerprint {
+		return errors.Wrap(ErrWatermarkInvalid, "ledger header changed")
+	}
+	info, err := clr.file.Stat()
+	if err != nil {
+		return err
+	}
+	if info.Size() < since.Offset {
+		return errors.Wrap(ErrWatermarkInvalid, "ledger was truncated")
+	}
+	if since.Rows == 0 {
+		return nil
+	}
+	lastRow := make([]byte, since.Offset-since.LastRowOffset)
+	if _, err := clr.file.ReadAt(lastRow, since.LastRowOffset); err != nil {
+		return err
+	}
+	if hashBytes(lastRow) != since.LastRowHash {
+		return errors.Wrap(ErrWatermarkInvalid, "ledger was rewritten")
+	}
+	if len(lastRow) == 0 || lastRow[len(lastRow)-1] == '\n' || info.Size() == since.Offset {
+		return nil
+	}
+	// The last row had no line ending, so anything appended has to start a
+	// new line rather than carry on the row.
+	next := make([]byte, 1)
+	if _, err := clr.file.ReadAt(next, since.Offset); err != nil {
+		return err
+	}
+	if next[0] != '\n' && next[0] != '\r' {
+		return errors.Wrap(ErrWatermarkInvalid, "last row was still being written")
+	}
+	return nil
+}
+
+// restoreChecksum of the ledger up to a Watermark from its saved state. A
+// Watermark saved without one has to be ingested again from the start.
+func restoreChecksum(checksum hash.Hash, state string) error {
+	saved, err := hex.DecodeString(state)
+	if err != nil || len(saved) == 0 {
+		return errors.Wrap(ErrWatermarkInvalid, "watermark has no checksum")
+	}
+	if err := checksum.(encoding.BinaryUnmarshaler).UnmarshalBinary(saved); err != nil {
+		return errors.Wrap(ErrWatermarkInvalid, "watermark checksum is corrupt")
+	}
+	return nil
+}
+
+// isFinalRecord without a line ending that is complete, with its quotes
+// closed and as many fields as the header.
+func isFinalRecord(raw []byte, headerFields int) bool {
+	if bytes.Count(raw, []byte{'"'})%2 != 0 {
+		return false
+	}
+	fields, err := parseRecord(raw)
+	return err == nil && len(fields) == headerFields
+}
+
+// readRecord returns the bytes of the next CSV record including its line
+// ending, which may span lines when a quoted field contains a newline.
+// complete is false when the ledger ends part way through the record.
+func readRecord(rdr *bufio.Reader) ([]byte, bool, error) {
+	var record []byte
+	for {
+		line, err := rdr.ReadBytes('\n')
+		record = append(record, line...)
+		if err == io.EOF {
+			return record, false, nil
+		}
+		if err != nil {
+			return nil, false, err
+		}
+		if bytes.Count(record, []byte{'"'})%2 == 0 {
+			return record, true, nil
+		}
+	}
+}
+
+// parseRecord into its fields, nil for a blank line.
+func parseRecord(raw []byte) ([]string, error) {
+	rdr := csv.NewReader(bytes.NewReader(raw))
+	rdr.FieldsPerRecord = -1
+	fields, err := rdr.Read()
+	if err == io.EOF {
+		return nil, nil
+	}
+	return fields, err
+}
+
+func hashBytes(raw []byte) string {
+	checksum := sha256.Sum256(raw)
+	return hex.EncodeToString(checksum[:])
+}
@@ -0,0 +1,115 @@
+package repository
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const watermarkLedgerHeader = "first_name,last_name,email,description,merchant_code,amount,from_currency,to_currency,rate,date\n"
+
+func TestFetchSinceReadsOnlyAppendedRows(t *testing.T) {
+	first := "Alayna,Sparks,alayna.sparks@mailinator.com,CARD SPEND,5311,2629.16,GBP,GGM,47.0892,22/03/2020 13:28\n"
+	second := "Niyah,Singleton,niyah.singleton@mailinator.com,CARD SPEND,5462,682.28,GBP,GGM,47.7534,12/05/2020 08:22\n"
+	partial := "Riley,Hayden,riley.hayden@mailinator.com,CARD SPEND"
+	filename := writeTempLedger(t, watermarkLedgerHeader+first+partial)
+
+	clr, err := NewCSVLedgerRepository(filename)
+	require.Nil(t, err, "unexpected error")
+	payments, watermark, err := clr.FetchSince(context.Background(), Watermark{})
+	require.Nil(t, err, "unexpected error")
+	require.Len(t, payments, 1, "the partial row is left for the next fetch")
+	assert.Equal(t, int64(len(watermarkLedgerHeader+first)), watermark.Offset)
+	assert.Equal(t, 1, watermark.Rows)
+
+	appendToLedger(t, filename, ",5311,2.91,GBP,GGM,47.7534,18/05/2020 14:40\n"+second)
+	payments, watermark, err = clr.FetchSince(context.Background(), watermark)
+	require.Nil(t, err, "unexpected error")
+	require.Len(t, payments, 2)
+	assert.Equal(t, "Hayden", payments[0].Spender.LastName)
+	assert.Equal(t, "Singleton", payments[1].Spender.LastName)
+	assert.Equal(t, 3, watermark.Rows)
+
+	payments, unchanged, err := clr.FetchSince(context.Background(), watermark)
+	require.Nil(t, err, "unexpected error")
+	assert.Empty(t, payments)
+	assert.Equal(t, watermark, unchanged)
+}
+
+func TestFetchSinceDetectsInvalidWatermark(t *testing.T) {
+	row := "Alayna,Sparks,alayna.sparks@mailinator.com,CARD SPEND,5311,2629.16,GBP,GGM,47.0892,22/03/2020 13:28\n"
+	testCases := []struct {
+		Name      string
+		Rewritten string
+	}{
+		{"Truncated", watermarkLedgerHeader},
+		{"Rewritten", watermarkLedgerHeader + strings.Replace(row, "2629.16", "2629.17", 1)},
+		{"Header changed", strings.Replace(watermarkLedgerHeader, ",", ", ", -1) + row},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			filename := writeTempLedger(t, watermarkLedgerHeader+row)
+			clr, err := NewCSVLedgerRepository(filename)
+			require.Nil(t, err, "unexpected error")
+			_, watermark, err := clr.FetchSince(context.Background(), Watermark{})
+			require.Nil(t, err, "unexpected error")
+
+			require.Nil(t, ioutil.WriteFile(filename, []byte(tc.Rewritten), 0644))
+			clr, err = NewCSVLedgerRepository(filename)
+			require.Nil(t, err, "unexpected error")
+			_, _, err = clr.FetchSince(context.Background(), watermark)
+			assert.Equal(t, ErrWatermarkInvalid, errors.Cause(err))
+		})
+	}
+}
+
+func TestFetchSinceMatchesFetchAllWithoutFinalNewline(t *testing.T) {
+	first := "Alayna,Sparks,alayna.sparks@mailinator.com,CARD SPEND,5311,2629.16,GBP,GGM,47.0892,22/03/2020 13:28\n"
+	last := "Niyah,Singleton,niyah.singleton@mailinator.com,CARD SPEND,5462,682.28,GBP,GGM,47.7534,12/05/2020 08:22"
+	appended := "Riley,Hayden,riley.hayden@mailinator.com,CARD SPEND,5311,2.91,GBP,GGM,47.7534,18/05/2020 14:40"
+	filename := writeTempLedger(t, watermarkLedgerHeader+first+last)
+
+	clr, err := NewCSVLedgerRepository(filename)
+	require.Nil(t, err, "unexpected error")
+	payments, watermark, err := clr.FetchSince(context.Background(), Watermark{})
+	require.Nil(t, err, "unexpected error")
+	sources := clr.Sources()
+
+	all, err := clr.FetchAll(context.Background())
+	require.Nil(t, err, "unexpected error")
+	assert.Equal(t, all, payments, "the final row is complete without a newline")
+	assert.Equal(t, clr.Sources(), sources)
+
+	appendToLedger(t, filename, "\n"+appended)
+	payments, watermark, err = clr.FetchSince(context.Background(), watermark)
+	require.Nil(t, err, "unexpected error")
+	require.Len(t, payments, 1)
+	assert.Equal(t, "Hayden", payments[0].Spender.LastName)
+	assert.Equal(t, 3, watermark.Rows)
+	sources = clr.Sources()
+
+	all, err = clr.FetchAll(context.Background())
+	require.Nil(t, err, "unexpected error")
+	assert.Len(t, all, 3)
+	assert.Equal(t, clr.Sources(), sources, "the checksum covers the whole ledger")
+
+	appendToLedger(t, filename, "5")
+	_, _, err = clr.FetchSince(context.Background(), watermark)
+	assert.Equal(t, ErrWatermarkInvalid, errors.Cause(err),
+		"a final row that was still being written is caught")
+}
+
+func appendToLedger(t *testing.T, filename string, contents string) {
+	file, err := os.OpenFile(filename, os.O_APPEND|os.O_WRONLY, 0644)
+	require.Nil(t, err)
+	_, err = file.WriteString(contents)
+	require.Nil(t, err)
+	require.Nil(t, file.Close())
+}
@@ -0,0 +1,180 @@
+package snapshot
+
+import (
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+	"sync"
+
+	"github.com/pkg/errors"
+
+	"github.com/JonPulfer/gold_sales/pkg/gold_sales"
+	"github.com/JonPulfer/gold_sales/pkg/gold_sales/infrastructure/filesystem"
+)
+
+// storeVersion of the snapshot file layout. Files written with another
+// version are ignored rather than trusted.
+const storeVersion = 2
+
+// MonthSnapshot of the per spender totals for a month, along with the
+// checksum of the payments they were computed from.
+type MonthSnapshot struct {
+	Month    gold_sales.ReportMonth     `json:"month"`
+	Checksum string                     `json:"checksum"`
+	Totals   gold_sales.MonthlySpenders `json:"totals"`
+}
+
+type storeFile struct {
+	Version int             `json:"version"`
+	Input   string          `json:"input,omitempty"`
+	Months  []MonthSnapshot `json:"months"`
+}
+
+// FileStore keeps a snapshot of each month in a JSON file. It holds the
+// latest snapshot for every month, so a month whose payments change is
+// replaced rather than kept alongside the old one, along with the checksum
+// of the inputs the months were last aggregated from.
+type FileStore struct {
+	filename string
+	mu       sync.Mutex
+	input    string
+	months   map[gold_sales.ReportMonth]MonthSnapshot
+	changed  bool
+}
+
+// OpenFileStore from the file, starting empty if the file does not exist yet
+// or was written by another version.
+func OpenFileStore(filename string) (*FileStore, error) {
+	store := &FileStore{
+		filename: filename,
+		months:   make(map[gold_sales.ReportMonth]MonthSnapshot),
+	}
+
+	contents, err := ioutil.ReadFile(filename)
+	if os.IsNotExist(err) {
+		return store, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var file storeFile
+	if err := json.Unmarshal(contents, &file); err != nil {
+		return nil, errors.Wrapf(err, "failed to parse snapshot store %s", filename)
+	}
+	if file.Version != storeVersion {
+		return store, nil
+	}
+	store.input = file.Input
+	for _, month := range file.Months {
+		store.months[month.Month] = month
+	}
+	return store, nil
+}
+
+// Lookup the totals for the month if they were computed from payments with
+// the checksum.
+func (fs *FileStore) Lookup(
+	month gold_sales.ReportMonth,
+	checksum string,
+) (gold_sales.MonthlySpenders, bool) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	snapshot, ok := fs.months[month]
+	if !ok || snapshot.Checksum != checksum {
+		return nil, false
+	}
+	totals := make(gold_sales.MonthlySpenders, len(snapshot.Totals))
+	copy(totals, snapshot.Totals)
+	return totals, true
+}
+
+// Save the totals for the month computed from payments with the checksum.
+func (fs *FileStore) Save(
+	month gold_sales.ReportMonth,
+	checksum string,
+	totals gold_sales.MonthlySpenders,
+) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	saved := make(gold_sales.MonthlySpenders, len(totals))
+	copy(saved, totals)
+	fs.months[month] = MonthSnapshot{Month: month, Checksum: checksum, Totals: saved}
+	fs.changed = true
+}
+
+// LookupInput the totals of every month if they were aggregated from inputs
+// with the checksum.
+func (fs *FileStore) LookupInput(
+	checksum string,
+) (map[gold_sales.ReportMonth]gold_sales.MonthlySpenders, bool) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	if checksum == "" || fs.input != checksum {
+		return nil, false
+	}
+	months := make(map[gold_sales.ReportMonth]gold_sales.MonthlySpenders, len(fs.months))
+	for month, snapshot := range fs.months {
+		totals := make(gold_sales.MonthlySpenders, len(snapshot.Totals))
+		copy(totals, snapshot.Totals)
+		months[month] = totals
+	}
+	return months, true
+}
+
+// SaveInput checksum that the months were aggregated from, dropping the
+// snapshots of any other months as they are not in the inputs.
+func (fs *FileStore) SaveInput(checksum string, months []gold_sales.ReportMonth) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	inInput := make(map[gold_sales.ReportMonth]bool, len(months))
+	for _, month := range months {
+		inInput[month] = true
+	}
+	for month := range fs.months {
+		if !inInput[month] {
+			delete(fs.months, month)
+			fs.changed = true
+		}
+	}
+	if fs.input != checksum {
+		fs.input = checksum
+		fs.changed = true
+	}
+}
+
+// Flush the snapshots to the file if any were saved since it was opened.
+func (fs *FileStore) Flush() error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	if !fs.changed {
+		return nil
+	}
+	file := storeFile{
+		Version: storeVersion,
+		Input:   fs.input,
+		Months:  make([]MonthSnapshot, 0, len(fs.months)),
+	}
+	for _, month := range fs.months {
+		file.Months = append(file.Months, month)
+	}
+	sort.Slice(file.Months, func(i, j int) bool {
+		return gold_sales.OrderedReportMonths{file.Months[i].Month, file.Months[j].Month}.Less(0, 1)
+	})
+
+	err := filesystem.WriteAtomically(fs.filename, func(w io.Writer) error {
+		return json.NewEncoder(w).Encode(file)
+	})
+	if err != nil {
+		return err
+	}
+	fs.changed = false
+	return nil
+}
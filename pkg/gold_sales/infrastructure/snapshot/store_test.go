@@ -0,0 +1,82 @@
+package snapshot
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/JonPulfer/gold_sales/pkg/gold_sales"
+)
+
+func TestFileStoreRoundTrip(t *testing.T) {
+	dir, err := ioutil.TempDir("", "snapshot")
+	require.Nil(t, err)
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	filename := filepath.Join(dir, "snapshots.json")
+
+	store, err := OpenFileStore(filename)
+	require.Nil(t, err, "a missing file is an empty store")
+	require.Nil(t, store.Flush())
+	_, err = os.Stat(filename)
+	assert.True(t, os.IsNotExist(err), "nothing to flush without changes")
+
+	totals := gold_sales.MonthlySpenders{{
+		Spender:     gold_sales.Spender{Email: "jo@mock.com"},
+		TotalSpend:  12.5,
+		TotalAmount: 600,
+	}}
+	store.Save("Jun 2020", "abc", totals)
+	require.Nil(t, store.Flush())
+
+	reopened, err := OpenFileStore(filename)
+	require.Nil(t, err)
+	loaded, ok := reopened.Lookup("Jun 2020", "abc")
+	assert.True(t, ok)
+	assert.Equal(t, totals, loaded)
+
+	_, ok = reopened.Lookup("Jun 2020", "changed")
+	assert.False(t, ok, "a different checksum must not match")
+	_, ok = reopened.Lookup("Jul 2020", "abc")
+	assert.False(t, ok)
+
+	require.Nil(t, ioutil.WriteFile(filename, []byte(`{"version": 99, "months": [
+		{"month": "Jun 2020", "checksum": "abc", "totals": []}]}`), 0644))
+	other, err := OpenFileStore(filename)
+	require.Nil(t, err)
+	_, ok = other.Lookup("Jun 2020", "abc")
+	assert.False(t, ok, "snapshots from another version are ignored")
+}
+
+func TestFileStoreInput(t *testing.T) {
+	dir, err := ioutil.TempDir("", "snapshot")
+	require.Nil(t, err)
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	filename := filepath.Join(dir, "snapshots.json")
+
+	store, err := OpenFileStore(filename)
+	require.Nil(t, err)
+	_, ok := store.LookupInput("inputs")
+	assert.False(t, ok, "nothing saved for the inputs yet")
+
+	june := gold_sales.MonthlySpenders{{Spender: gold_sales.Spender{Email: "jo@mock.com"}, TotalSpend: 1}}
+	july := gold_sales.MonthlySpenders{{Spender: gold_sales.Spender{Email: "sam@mock.com"}, TotalSpend: 2}}
+	store.Save("Jun 2020", "june", june)
+	store.Save("Jul 2020", "july", july)
+	store.SaveInput("inputs", []gold_sales.ReportMonth{"Jun 2020"})
+	require.Nil(t, store.Flush())
+
+	reopened, err := OpenFileStore(filename)
+	require.Nil(t, err)
+	months, ok := reopened.LookupInput("inputs")
+	require.True(t, ok)
+	assert.Equal(t, map[gold_sales.ReportMonth]gold_sales.MonthlySpenders{"Jun 2020": june}, months,
+		"months not in the inputs are dropped")
+	_, ok = reopened.LookupInput("changed")
+	assert.False(t, ok, "different inputs must not match")
+	_, ok = reopened.LookupInput("")
+	assert.False(t, ok, "inputs without a checksum never match")
+}
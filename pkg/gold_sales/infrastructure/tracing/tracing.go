@@ -0,0 +1,33 @@
+package tracing
+
+import (
+	"context"
+
+	"github.com/opentracing/opentracing-go"
+)
+
+// Span of work within a trace. It is an OpenTracing span, so it is recorded
+// by whichever tracer started it, whether the WriterTracer or a tracer for a
+// collector registered with opentracing.SetGlobalTracer.
+type Span = opentracing.Span
+
+type tracerKey struct{}
+
+// ContextWithTracer so spans started from the context are recorded by the
+// tracer rather than the global tracer.
+func ContextWithTracer(ctx context.Context, tracer opentracing.Tracer) context.Context {
+	return context.WithValue(ctx, tracerKey{}, tracer)
+}
+
+// StartSpanFromContext starts a span as a child of any span already in the
+// context and returns a context carrying the new span. The span is started
+// by the tracer in the context, or the global OpenTracing tracer if there is
+// none, which does nothing until a tracer is registered, so callers never
+// need to check whether tracing is enabled.
+func StartSpanFromContext(ctx context.Context, operation string) (Span, context.Context) {
+	tracer, ok := ctx.Value(tracerKey{}).(opentracing.Tracer)
+	if !ok || tracer == nil {
+		tracer = opentracing.GlobalTracer()
+	}
+	return opentracing.StartSpanFromContextWithTracer(ctx, tracer, operation)
+}
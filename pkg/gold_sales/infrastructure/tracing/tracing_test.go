@@ -0,0 +1,49 @@
+package tracing
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/opentracing/opentracing-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestChildSpansShareTrace(t *testing.T) {
+	var buf bytes.Buffer
+	ctx := ContextWithTracer(context.Background(), NewWriterTracer(&buf))
+
+	parent, ctx := StartSpanFromContext(ctx, "parent")
+	child, _ := StartSpanFromContext(ctx, "child")
+	child.SetTag("rows", 3).LogKV("event", "parsed")
+	child.Finish()
+	parent.Finish()
+	parent.Finish()
+
+	spans := make([]FinishedSpan, 0)
+	scanner := bufio.NewScanner(&buf)
+	for scanner.Scan() {
+		var span FinishedSpan
+		require.Nil(t, json.Unmarshal(scanner.Bytes(), &span))
+		spans = append(spans, span)
+	}
+	require.Len(t, spans, 2)
+	assert.Equal(t, "child", spans[0].Operation)
+	assert.Equal(t, 3.0, spans[0].Attributes["rows"])
+	assert.Equal(t, []map[string]interface{}{{"event": "parsed"}}, spans[0].Logs)
+	assert.Equal(t, spans[1].TraceID, spans[0].TraceID)
+	assert.Equal(t, spans[1].SpanID, spans[0].ParentID)
+	assert.Empty(t, spans[1].ParentID)
+}
+
+func TestSpanWithoutTracerIsNoop(t *testing.T) {
+	span, _ := StartSpanFromContext(context.Background(), "untraced")
+
+	assert.Equal(t, opentracing.NoopTracer{}, span.Tracer())
+	assert.NotPanics(t, func() {
+		span.SetTag("rows", 1).Finish()
+	})
+}
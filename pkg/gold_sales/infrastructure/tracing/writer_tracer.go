@@ -0,0 +1,228 @@
+package tracing
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/log"
+)
+
+// FinishedSpan as written by the WriterTracer.
+type FinishedSpan struct {
+	TraceID    string                   `json:"traceId"`
+	SpanID     string                   `json:"spanId"`
+	ParentID   string                   `json:"parentId,omitempty"`
+	Operation  string                   `json:"operation"`
+	Start      time.Time                `json:"start"`
+	Duration   time.Duration            `json:"durationNs"`
+	Attributes map[string]interface{}   `json:"attributes,omitempty"`
+	Logs       []map[string]interface{} `json:"logs,omitempty"`
+}
+
+// WriterTracer is an OpenTracing tracer that writes each finished span as a
+// line of JSON, for use with stdout or a local file when no collector is
+// run. Spans cannot be injected into or extracted from carriers, as they
+// never leave the process.
+type WriterTracer struct {
+	mu      sync.Mutex
+	encoder *json.Encoder
+}
+
+// NewWriterTracer writing the spans to w.
+func NewWriterTracer(w io.Writer) *WriterTracer {
+	return &WriterTracer{encoder: json.NewEncoder(w)}
+}
+
+// StartSpan as a child of the first span referenced in the options, or as
+// the root of a new trace.
+func (wt *WriterTracer) StartSpan(
+	operation string,
+	opts ...opentracing.StartSpanOption,
+) opentracing.Span {
+	options := opentracing.StartSpanOptions{}
+	for _, opt := range opts {
+		opt.Apply(&options)
+	}
+	start := options.StartTime
+	if start.IsZero() {
+		start = time.Now()
+	}
+
+	span := &writerSpan{
+		tracer: wt,
+		context: SpanContext{
+			SpanID:  newID(8),
+			baggage: make(map[string]string),
+		},
+		finished: FinishedSpan{
+			Operation:  operation,
+			Start:      start,
+			Attributes: make(map[string]interface{}),
+		},
+	}
+	for _, ref := range options.References {
+		if parent, ok := ref.ReferencedContext.(SpanContext); ok {
+			span.context.TraceID = parent.TraceID
+			span.finished.ParentID = parent.SpanID
+			for key, value := range parent.baggage {
+				span.context.baggage[key] = value
+			}
+			break
+		}
+	}
+	if span.context.TraceID == "" {
+		span.context.TraceID = newID(16)
+	}
+	for key, value := range options.Tags {
+		span.finished.Attributes[key] = value
+	}
+	return span
+}
+
+// Inject is not supported, spans stay within the process.
+func (wt *WriterTracer) Inject(opentracing.SpanContext, interface{}, interface{}) error {
+	return opentracing.ErrUnsupportedFormat
+}
+
+// Extract is not supported, spans stay within the process.
+func (wt *WriterTracer) Extract(interface{}, interface{}) (opentracing.SpanContext, error) {
+	return nil, opentracing.ErrUnsupportedFormat
+}
+
+func (wt *WriterTracer) write(span FinishedSpan) {
+	wt.mu.Lock()
+	defer wt.mu.Unlock()
+	_ = wt.encoder.Encode(span)
+}
+
+// SpanContext of a span started by the WriterTracer.
+type SpanContext struct {
+	TraceID string
+	SpanID  string
+	baggage map[string]string
+}
+
+// ForeachBaggageItem of the span until the handler returns false.
+func (sc SpanContext) ForeachBaggageItem(handler func(k, v string) bool) {
+	for key, value := range sc.baggage {
+		if !handler(key, value) {
+			return
+		}
+	}
+}
+
+type writerSpan struct {
+	mu       sync.Mutex
+	tracer   *WriterTracer
+	context  SpanContext
+	finished FinishedSpan
+	done     bool
+}
+
+func (ws *writerSpan) Finish() {
+	ws.FinishWithOptions(opentracing.FinishOptions{})
+}
+
+func (ws *writerSpan) FinishWithOptions(opts opentracing.FinishOptions) {
+	ws.mu.Lock()
+	if ws.done {
+		ws.mu.Unlock()
+		return
+	}
+	ws.done = true
+	finish := opts.FinishTime
+	if finish.IsZero() {
+		finish = time.Now()
+	}
+	for _, record := range opts.LogRecords {
+		ws.appendLog(record.Fields)
+	}
+	ws.finished.TraceID = ws.context.TraceID
+	ws.finished.SpanID = ws.context.SpanID
+	ws.finished.Duration = finish.Sub(ws.finished.Start)
+	finished := ws.finished
+	ws.mu.Unlock()
+
+	ws.tracer.write(finished)
+}
+
+func (ws *writerSpan) Context() opentracing.SpanContext {
+	return ws.context
+}
+
+func (ws *writerSpan) SetOperationName(operation string) opentracing.Span {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+	ws.finished.Operation = operation
+	return ws
+}
+
+func (ws *writerSpan) SetTag(key string, value interface{}) opentracing.Span {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+	ws.finished.Attributes[key] = value
+	return ws
+}
+
+func (ws *writerSpan) LogFields(fields ...log.Field) {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+	ws.appendLog(fields)
+}
+
+func (ws *writerSpan) LogKV(alternatingKeyValues ...interface{}) {
+	fields, err := log.InterleavedKVToFields(alternatingKeyValues...)
+	if err != nil {
+		fields = []log.Field{log.Error(err)}
+	}
+	ws.LogFields(fields...)
+}
+
+func (ws *writerSpan) SetBaggageItem(key, value string) opentracing.Span {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+	ws.context.baggage[key] = value
+	return ws
+}
+
+func (ws *writerSpan) BaggageItem(key string) string {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+	return ws.context.baggage[key]
+}
+
+func (ws *writerSpan) Tracer() opentracing.Tracer {
+	return ws.tracer
+}
+
+func (ws *writerSpan) LogEvent(event string) {
+	ws.LogFields(log.String("event", event))
+}
+
+func (ws *writerSpan) LogEventWithPayload(event string, payload interface{}) {
+	ws.LogFields(log.String("event", event), log.Object("payload", payload))
+}
+
+func (ws *writerSpan) Log(data opentracing.LogData) {
+	ws.LogFields(data.ToLogRecord().Fields...)
+}
+
+// appendLog of the fields, with the span locked.
+func (ws *writerSpan) appendLog(fields []log.Field) {
+	entry := make(map[string]interface{}, len(fields))
+	for _, field := range fields {
+		entry[field.Key()] = field.Value()
+	}
+	ws.finished.Logs = append(ws.finished.Logs, entry)
+}
+
+func newID(numBytes int) string {
+	id := make([]byte, numBytes)
+	_, _ = rand.Read(id)
+	return hex.EncodeToString(id)
+}
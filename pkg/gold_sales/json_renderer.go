@@ -0,0 +1,66 @@
+package gold_sales
+
+import (
+	"encoding/json"
+	"io"
+)
+
+// jsonReportSchema identifies the layout of the json output format, so
+// readers can reject reports they do not understand.
+const jsonReportSchema = "gold_sales/top_spenders_report/v1"
+
+// jsonReport is the layout of the json output format, newest month first.
+type jsonReport struct {
+	Schema     string            `json:"schema"`
+	Months     []jsonReportMonth `json:"months"`
+	Provenance *ReportProvenance `json:"provenance,omitempty"`
+}
+
+type jsonReportMonth struct {
+	Month      ReportMonth `json:"month"`
+	MonthTotal TotalSpend  `json:"monthTotal"`
+	Spenders   []jsonSpend `json:"spenders"`
+}
+
+type jsonSpend struct {
+	Rank      int        `json:"rank"`
+	FirstName string     `json:"firstName"`
+	LastName  string     `json:"lastName"`
+	Email     string     `json:"email"`
+	Grams     TotalSpend `json:"grams"`
+	Amount    float64    `json:"amount"`
+	Currency  string     `json:"currency,omitempty"`
+}
+
+// renderJSON as a document with the ranked spenders of each month and the
+// provenance of the report, for dashboards and other programs to consume.
+func renderJSON(w io.Writer, report *MonthlyTopSpendersAnalysisReport) error {
+	view := jsonReport{
+		Schema:     jsonReportSchema,
+		Months:     make([]jsonReportMonth, 0),
+		Provenance: report.Provenance(),
+	}
+	for _, month := range report.Months() {
+		reportMonth := jsonReportMonth{
+			Month:      month.Month,
+			MonthTotal: month.MonthTotal,
+			Spenders:   make([]jsonSpend, 0, len(month.Spenders)),
+		}
+		for i, spend := range month.Spenders {
+			reportMonth.Spenders = append(reportMonth.Spenders, jsonSpend{
+				Rank:      i + 1,
+				FirstName: spend.Spender.FirstName,
+				LastName:  spend.Spender.LastName,
+				Email:     spend.Spender.Email,
+				Grams:     spend.TotalSpend,
+				Amount:    spend.TotalAmount,
+				Currency:  spend.Currency,
+			})
+		}
+		view.Months = append(view.Months, reportMonth)
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(view)
+}
@@ -0,0 +1,281 @@
+package gold_sales
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// LimitWindow a spending limit is measured over.
+type LimitWindow string
+
+const (
+	// LimitDay is the calendar day, in UTC, of the payment.
+	LimitDay LimitWindow = "day"
+	// LimitMonth is the calendar month, in UTC, of the payment.
+	LimitMonth LimitWindow = "month"
+	// LimitRolling is the Days up to and including the payment.
+	LimitRolling LimitWindow = "rolling"
+)
+
+// maxMonthDays is the longest a calendar month can be.
+const maxMonthDays = 31
+
+// LimitConfig of the most a customer may spend within a window. Spend is
+// measured by the Metric, grams of gold or the amount paid, with refunds
+// netted against it. Amounts in different currencies cannot be added up, so
+// a limit on the amount without a Currency fails to check a ledger paid from
+// more than one.
+type LimitConfig struct {
+	Name   string        `json:"name"`
+	Window LimitWindow   `json:"window"`
+	Days   int           `json:"days,omitempty"`
+	Metric RankingMetric `json:"metric"`
+	Max    float64       `json:"max"`
+	// Currency payments are made from to count towards the limit, all when
+	// empty.
+	Currency string `json:"currency,omitempty"`
+}
+
+// LimitBreach of a limit by a payment, with the payments in the window it
+// was made within. Value is their total spend and From and To the start and
+// end of the window.
+type LimitBreach struct {
+	Limit      string        `json:"limit"`
+	Spender    Spender       `json:"spender"`
+	PaymentID  string        `json:"paymentId"`
+	Date       time.Time     `json:"date"`
+	From       time.Time     `json:"from"`
+	To         time.Time     `json:"to"`
+	Metric     RankingMetric `json:"metric"`
+	Value      float64       `json:"value"`
+	Max        float64       `json:"max"`
+	PaymentIDs []string      `json:"paymentIds"`
+	Message    string        `json:"message"`
+}
+
+// LimitChecker checks each payment made against the limits, remembering the
+// recent payments of every customer so it can check new payments as they are
+// made as well as a whole ledger.
+type LimitChecker struct {
+	limits  []LimitConfig
+	horizon time.Duration
+	recent  map[Spender][]GoldPayment
+	// currency of the payments added up by amount limits without a currency.
+	currency string
+}
+
+// NewLimitChecker for the limits, which must each be valid.
+func NewLimitChecker(limits []LimitConfig) (*LimitChecker, error) {
+	lc := &LimitChecker{
+		limits:  make([]LimitConfig, 0, len(limits)),
+		horizon: maxMonthDays * 24 * time.Hour,
+		recent:  make(map[Spender][]GoldPayment),
+	}
+	names := make(map[string]bool)
+	for i, limit := range limits {
+		metric, err := ParseRankingMetric(string(limit.Metric))
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid limit %d", i+1)
+		}
+		limit.Metric = metric
+		if limit.Name == "" {
+			limit.Name = fmt.Sprintf("%s_%s", limit.Window, limit.Metric)
+		}
+		switch limit.Window {
+		case LimitDay, LimitMonth:
+		case LimitRolling:
+			if limit.Days <= 0 {
+				return nil, errors.Errorf("rolling limit %q needs days more than zero", limit.Name)
+			}
+			if window := time.Duration(limit.Days) * 24 * time.Hour; window > lc.horizon {
+				lc.horizon = window
+			}
+		default:
+			return nil, errors.Errorf("limit %q has unknown window %q, use day, month or rolling",
+				limit.Name, limit.Window)
+		}
+		if limit.Max <= 0 {
+			return nil, errors.Errorf("limit %q needs a max more than zero", limit.Name)
+		}
+		if names[limit.Name] {
+			return nil, errors.Errorf("limit %q is configured more than once", limit.Name)
+		}
+		names[limit.Name] = true
+		lc.limits = append(lc.limits, limit)
+	}
+	return lc, nil
+}
+
+// Limits checked, with their defaults filled in.
+func (lc *LimitChecker) Limits() []LimitConfig {
+	return lc.limits
+}
+
+// Check the payment against every limit, returning a breach for each limit
+// it takes the customer over. Refunds are counted but never breach a limit.
+// The payment is remembered for the payments checked after it, which are
+// expected to be made in date order, though a payment made up to the longest
+// window before the latest is still counted. A payment in a currency other
+// than those checked before it fails the check of an amount limit without a
+// currency.
+func (lc *LimitChecker) Check(payment GoldPayment) ([]LimitBreach, error) {
+	for _, limit := range lc.limits {
+		if limit.Metric != RankByAmount || limit.Currency != "" {
+			continue
+		}
+		if lc.currency == "" {
+			lc.currency = payment.FromCurrency
+		}
+		if !strings.EqualFold(lc.currency, payment.FromCurrency) {
+			return nil, errors.Errorf(
+				"limit %q adds up amounts paid from %s and %s, give it a currency",
+				limit.Name, lc.currency, payment.FromCurrency)
+		}
+	}
+
+	recent := append(lc.recent[payment.Spender], payment)
+	latest := payment.Date
+	for _, previous := range recent {
+		if previous.Date.After(latest) {
+			latest = previous.Date
+		}
+	}
+	oldest := latest.Add(-lc.horizon)
+	kept := recent[:0]
+	for _, previous := range recent {
+		if !previous.Date.Before(oldest) {
+			kept = append(kept, previous)
+		}
+	}
+	lc.recent[payment.Spender] = kept
+
+	breaches := make([]LimitBreach, 0)
+	for _, limit := range lc.limits {
+		if !limit.counts(payment) || payment.Value(limit.Metric) <= 0 {
+			continue
+		}
+		from, to := limit.window(payment.Date)
+		var value float64
+		ids := make([]string, 0)
+		for _, previous := range kept {
+			if !limit.counts(previous) || !limit.within(from, to, previous.Date) {
+				continue
+			}
+			value += previous.Value(limit.Metric)
+			ids = append(ids, previous.TransactionID())
+		}
+		if value <= limit.Max {
+			continue
+		}
+		breaches = append(breaches, LimitBreach{
+			Limit:      limit.Name,
+			Spender:    payment.Spender,
+			PaymentID:  payment.TransactionID(),
+			Date:       payment.Date,
+			From:       from,
+			To:         to,
+			Value:      value,
+			Max:        limit.Max,
+			Metric:     limit.Metric,
+			PaymentIDs: ids,
+			Message: fmt.Sprintf("%d payments total %.2f %s, more than the %s limit of %.2f",
+				len(ids), value, limit.Metric, limit.Name, limit.Max),
+		})
+	}
+	return breaches, nil
+}
+
+// CheckAll of the payments, in date order, returning every breach found.
+func (lc *LimitChecker) CheckAll(payments []GoldPayment) ([]LimitBreach, error) {
+	ordered := make([]GoldPayment, len(payments))
+	copy(ordered, payments)
+	sort.SliceStable(ordered, func(i, j int) bool {
+		return ordered[i].Date.Before(ordered[j].Date)
+	})
+
+	breaches := make([]LimitBreach, 0)
+	for _, payment := range ordered {
+		found, err := lc.Check(payment)
+		if err != nil {
+			return nil, err
+		}
+		breaches = append(breaches, found...)
+	}
+	return breaches, nil
+}
+
+// counts the payment towards the limit.
+func (lc LimitConfig) counts(payment GoldPayment) bool {
+	return lc.Currency == "" || strings.EqualFold(lc.Currency, payment.FromCurrency)
+}
+
+// window the date falls within. A rolling window ends at the date.
+func (lc LimitConfig) window(date time.Time) (time.Time, time.Time) {
+	utc := date.UTC()
+	switch lc.Window {
+	case LimitDay:
+		from := time.Date(utc.Year(), utc.Month(), utc.Day(), 0, 0, 0, 0, time.UTC)
+		return from, from.AddDate(0, 0, 1)
+	case LimitMonth:
+		from := time.Date(utc.Year(), utc.Month(), 1, 0, 0, 0, 0, time.UTC)
+		return from, from.AddDate(0, 1, 0)
+	}
+	return date.Add(-time.Duration(lc.Days) * 24 * time.Hour), date
+}
+
+// within the window from and to. A calendar window includes its start but not
+// its end, and a rolling window its end but not its start.
+func (lc LimitConfig) within(from, to, date time.Time) bool {
+	if lc.Window == LimitRolling {
+		return date.After(from) && !date.After(to)
+	}
+	return !date.Before(from) && date.Before(to)
+}
+
+// LimitsReport of the breaches of the limits found in the ledgers.
+type LimitsReport struct {
+	GeneratedAt time.Time     `json:"generatedAt"`
+	Limits      []LimitConfig `json:"limits"`
+	Breaches    []LimitBreach `json:"breaches"`
+}
+
+// WriteJSON of the limits checked and every breach of them, with the IDs of
+// the payments behind each breach.
+func (lr LimitsReport) WriteJSON(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(lr)
+}
+
+// WriteCSV of the breaches with a header row, one breach per row.
+func (lr LimitsReport) WriteCSV(w io.Writer) error {
+	writer := csv.NewWriter(w)
+	_ = writer.Write([]string{"limit", "date", "first_name", "last_name", "email",
+		"payment_id", "from", "to", "metric", "value", "max", "payment_ids"})
+	for _, breach := range lr.Breaches {
+		_ = writer.Write([]string{
+			breach.Limit,
+			breach.Date.Format("02/01/2006 15:04"),
+			breach.Spender.FirstName,
+			breach.Spender.LastName,
+			breach.Spender.Email,
+			breach.PaymentID,
+			breach.From.Format("02/01/2006 15:04"),
+			breach.To.Format("02/01/2006 15:04"),
+			string(breach.Metric),
+			strconv.FormatFloat(breach.Value, 'f', 2, 64),
+			strconv.FormatFloat(breach.Max, 'f', 2, 64),
+			strings.Join(breach.PaymentIDs, " "),
+		})
+	}
+	writer.Flush()
+	return writer.Error()
+}
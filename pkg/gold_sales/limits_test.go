@@ -0,0 +1,162 @@
+package gold_sales
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLimitCheckerCheckAll(t *testing.T) {
+	spender := Spender{Email: "alayna.sparks@mailinator.com"}
+	march := time.Date(2020, 3, 1, 9, 0, 0, 0, time.UTC)
+	payment := func(grams float64, date time.Time) GoldPayment {
+		return GoldPayment{Spender: spender, Description: GoldSpend, Amount: grams * 50,
+			Rate: 50, FromCurrency: "GBP", ToCurrency: GoldCurrencyCode, Date: date, GramWeight: grams}
+	}
+
+	testCases := []struct {
+		Name     string
+		Limit    LimitConfig
+		Payments []GoldPayment
+		Breaches []int
+		Values   []float64
+	}{
+		{
+			"Grams per day",
+			LimitConfig{Window: LimitDay, Max: 10},
+			[]GoldPayment{payment(6, march), payment(5, march.Add(time.Hour)),
+				payment(6, march.Add(16*time.Hour))},
+			[]int{1},
+			[]float64{11},
+		},
+		{
+			"Grams per rolling seven days",
+			LimitConfig{Window: LimitRolling, Days: 7, Max: 15},
+			[]GoldPayment{payment(6, march), payment(6, march.AddDate(0, 0, 3)),
+				payment(6, march.AddDate(0, 0, 6)), payment(6, march.AddDate(0, 0, 8)),
+				payment(6, march.AddDate(0, 0, 19))},
+			[]int{2, 3},
+			[]float64{18, 18},
+		},
+		{
+			"Refunds netted within the month",
+			LimitConfig{Window: LimitMonth, Max: 15},
+			[]GoldPayment{payment(10, march), payment(-5, march.AddDate(0, 0, 1)),
+				payment(8, march.AddDate(0, 0, 2)), payment(10, march.AddDate(0, 1, 0))},
+			[]int{},
+			[]float64{},
+		},
+		{
+			"Refund in a window over the limit",
+			LimitConfig{Window: LimitDay, Max: 10},
+			[]GoldPayment{payment(6, march), payment(6, march.Add(time.Hour)),
+				payment(-1, march.Add(2*time.Hour)), payment(1, march.Add(3*time.Hour))},
+			[]int{1, 3},
+			[]float64{12, 12},
+		},
+		{
+			"Amount per month",
+			LimitConfig{Window: LimitMonth, Metric: RankByAmount, Max: 1000, Currency: "gbp"},
+			[]GoldPayment{payment(10, march), payment(10, march.AddDate(0, 0, 29)),
+				payment(1, march.AddDate(0, 0, 30))},
+			[]int{2},
+			[]float64{1050},
+		},
+		{
+			"Amount in another currency",
+			LimitConfig{Window: LimitDay, Metric: RankByAmount, Max: 100, Currency: "USD"},
+			[]GoldPayment{payment(10, march)},
+			[]int{},
+			[]float64{},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			checker, err := NewLimitChecker([]LimitConfig{tc.Limit})
+			require.NoError(t, err)
+
+			breaches, err := checker.CheckAll(tc.Payments)
+			require.NoError(t, err)
+			require.Len(t, breaches, len(tc.Breaches))
+			for i, breach := range breaches {
+				assert.Equal(t, tc.Payments[tc.Breaches[i]].TransactionID(), breach.PaymentID)
+				assert.InDelta(t, tc.Values[i], breach.Value, 0.0001)
+				assert.Contains(t, breach.PaymentIDs, breach.PaymentID)
+			}
+		})
+	}
+}
+
+func TestLimitCheckerCheck(t *testing.T) {
+	spender := Spender{Email: "alayna.sparks@mailinator.com"}
+	checker, err := NewLimitChecker([]LimitConfig{{Name: "daily", Window: LimitDay, Max: 10}})
+	require.NoError(t, err)
+
+	date := time.Date(2020, 3, 1, 9, 0, 0, 0, time.UTC)
+	spend := GoldPayment{Spender: spender, Description: GoldSpend, GramWeight: 6, Date: date}
+	breaches, err := checker.Check(spend)
+	require.NoError(t, err)
+	assert.Empty(t, breaches)
+
+	spend.Date = date.Add(time.Minute)
+	breaches, err = checker.Check(spend)
+	require.NoError(t, err)
+	require.Len(t, breaches, 1)
+	assert.Equal(t, "daily", breaches[0].Limit)
+	assert.Len(t, breaches[0].PaymentIDs, 2)
+	assert.Equal(t, time.Date(2020, 3, 1, 0, 0, 0, 0, time.UTC), breaches[0].From)
+
+	other := spend
+	other.Spender = Spender{Email: "sebastian.greenwood@mailinator.com"}
+	breaches, err = checker.Check(other)
+	require.NoError(t, err)
+	assert.Empty(t, breaches)
+}
+
+func TestLimitCheckerMixedCurrencies(t *testing.T) {
+	date := time.Date(2020, 3, 1, 9, 0, 0, 0, time.UTC)
+	payments := []GoldPayment{
+		{Description: GoldSpend, Amount: 50, FromCurrency: "GBP", Date: date},
+		{Description: GoldSpend, Amount: 50, FromCurrency: "EUR", Date: date.Add(time.Hour)},
+	}
+
+	checker, err := NewLimitChecker([]LimitConfig{{Window: LimitDay, Metric: RankByAmount, Max: 80}})
+	require.NoError(t, err)
+	_, err = checker.CheckAll(payments)
+	assert.Error(t, err, "expected error adding up pounds and euros")
+
+	checker, err = NewLimitChecker([]LimitConfig{{Window: LimitDay, Max: 80},
+		{Window: LimitDay, Metric: RankByAmount, Max: 80, Currency: "GBP"}})
+	require.NoError(t, err)
+	breaches, err := checker.CheckAll(payments)
+	require.NoError(t, err, "limits on grams or a single currency can check any ledger")
+	assert.Empty(t, breaches)
+}
+
+func TestNewLimitChecker(t *testing.T) {
+	testCases := []struct {
+		Name   string
+		Limits []LimitConfig
+	}{
+		{"Unknown window", []LimitConfig{{Window: "week", Max: 1}}},
+		{"Rolling without days", []LimitConfig{{Window: LimitRolling, Max: 1}}},
+		{"No max", []LimitConfig{{Window: LimitDay}}},
+		{"Unknown metric", []LimitConfig{{Window: LimitDay, Metric: "ounces", Max: 1}}},
+		{"Same name twice", []LimitConfig{{Window: LimitDay, Max: 1}, {Window: LimitDay, Max: 2}}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			_, err := NewLimitChecker(tc.Limits)
+			assert.Error(t, err)
+		})
+	}
+
+	checker, err := NewLimitChecker([]LimitConfig{{Window: LimitMonth, Max: 1}})
+	require.NoError(t, err)
+	assert.Equal(t, "month_grams", checker.Limits()[0].Name)
+	assert.Equal(t, RankByGrams, checker.Limits()[0].Metric)
+}
@@ -0,0 +1,52 @@
+package gold_sales
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"time"
+)
+
+// OutputTarget is a file to render the report to in a format.
+type OutputTarget struct {
+	Format   string `json:"format"`
+	Filename string `json:"filename"`
+}
+
+// ReportManifest lists the files written by a report run, so the outputs of
+// the run can be checked as a set. RuleViolations are the payments that broke
+// the business rules configured for their ledger.
+type ReportManifest struct {
+	GeneratedAt    time.Time         `json:"generatedAt"`
+	Files          []ManifestFile    `json:"files"`
+	Provenance     *ReportProvenance `json:"provenance,omitempty"`
+	RuleViolations []RuleViolation   `json:"ruleViolations,omitempty"`
+}
+
+// ManifestFile written by a run with the SHA-256 of its contents.
+type ManifestFile struct {
+	Filename string `json:"filename"`
+	Format   string `json:"format"`
+	Bytes    int64  `json:"bytes"`
+	SHA256   string `json:"sha256"`
+}
+
+// NewReportManifest for a run generated now.
+func NewReportManifest() *ReportManifest {
+	return &ReportManifest{
+		GeneratedAt: time.Now().UTC(),
+		Files:       make([]ManifestFile, 0),
+	}
+}
+
+// AddFile with the contents that were written to it.
+func (rm *ReportManifest) AddFile(target OutputTarget, contents []byte) ManifestFile {
+	checksum := sha256.Sum256(contents)
+	file := ManifestFile{
+		Filename: target.Filename,
+		Format:   target.Format,
+		Bytes:    int64(len(contents)),
+		SHA256:   hex.EncodeToString(checksum[:]),
+	}
+	rm.Files = append(rm.Files, file)
+	return file
+}
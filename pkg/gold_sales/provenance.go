@@ -0,0 +1,36 @@
+package gold_sales
+
+import "time"
+
+// Version of the tool, set at build time with
+// -ldflags "-X github.com/JonPulfer/gold_sales/pkg/gold_sales.Version=v1.2.3".
+var Version = "dev"
+
+// ReportProvenance records where a report came from, so a report can be
+// traced back to the ledgers and parameters that produced it.
+type ReportProvenance struct {
+	Inputs      []InputProvenance `json:"inputs"`
+	Parameters  ReportParameters  `json:"parameters"`
+	ToolVersion string            `json:"toolVersion"`
+	GeneratedAt time.Time         `json:"generatedAt"`
+}
+
+// InputProvenance of a ledger read for the report. Rejected counts the rows
+// that were not gold spends.
+type InputProvenance struct {
+	Filename     string `json:"filename"`
+	SHA256       string `json:"sha256"`
+	Rows         int    `json:"rows"`
+	GoldPayments int    `json:"goldPayments"`
+	Rejected     int    `json:"rejected"`
+}
+
+// ReportParameters the report was produced with. AsOf is the newest month in
+// the report.
+type ReportParameters struct {
+	NumTopSpenders int           `json:"numTopSpenders"`
+	NumMonths      int           `json:"numMonths"`
+	RankBy         RankingMetric `json:"rankBy"`
+	NetRefunds     RefundNetting `json:"netRefunds,omitempty"`
+	AsOf           ReportMonth   `json:"asOf,omitempty"`
+}
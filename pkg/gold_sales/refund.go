@@ -0,0 +1,100 @@
+package gold_sales
+
+import (
+	"math"
+
+	"github.com/pkg/errors"
+)
+
+// RefundNetting chooses the month a refund is netted against.
+type RefundNetting string
+
+const (
+	// NetInRefundMonth counts refunds in the month they were made, the
+	// default.
+	NetInRefundMonth RefundNetting = "refund"
+	// NetInOriginalMonth counts refunds in the month of the spend they
+	// refund.
+	NetInOriginalMonth RefundNetting = "original"
+)
+
+// ParseRefundNetting from its name, defaulting to NetInRefundMonth when empty.
+func ParseRefundNetting(name string) (RefundNetting, error) {
+	switch RefundNetting(name) {
+	case "", NetInRefundMonth:
+		return NetInRefundMonth, nil
+	case NetInOriginalMonth:
+		return NetInOriginalMonth, nil
+	}
+	return NetInRefundMonth, errors.Errorf("unknown refund netting %q", name)
+}
+
+// DateRefundsAsOriginals returns the payments with each refund dated as the
+// spend it refunds, so that it nets against the spend in its month. The spend
+// is the one with the refund's original reference, or failing that the same
+// spender's latest spend of the same amount before the refund that no other
+// refund has been matched to. Refunds whose spend cannot be found keep their
+// own date.
+func DateRefundsAsOriginals(payments []GoldPayment) []GoldPayment {
+	byReference := make(map[string]int)
+	bySpender := make(map[Spender][]int)
+	for i, payment := range payments {
+		if !payment.IsGoldSpend() {
+			continue
+		}
+		if payment.Reference != "" {
+			byReference[payment.Reference] = i
+		}
+		bySpender[payment.Spender] = append(bySpender[payment.Spender], i)
+	}
+
+	dated := make([]GoldPayment, len(payments))
+	copy(dated, payments)
+	refunded := make(map[int]bool)
+	unmatched := make([]int, 0)
+	// Refunds naming their spend are matched first, so that a refund matched
+	// by its amount cannot take a spend another refund names.
+	for i, payment := range payments {
+		if !payment.IsGoldRefund() {
+			continue
+		}
+		original, ok := byReference[payment.OriginalReference]
+		if payment.OriginalReference == "" || !ok || refunded[original] {
+			unmatched = append(unmatched, i)
+			continue
+		}
+		refunded[original] = true
+		dated[i].Date = payments[original].Date
+	}
+	for _, i := range unmatched {
+		original, ok := latestSpendOfAmount(payments, bySpender[payments[i].Spender],
+			refunded, payments[i])
+		if ok {
+			refunded[original] = true
+			dated[i].Date = payments[original].Date
+		}
+	}
+	return dated
+}
+
+// latestSpendOfAmount refunded by the refund, made before it, among the
+// spends not already refunded. The spends are indices into the payments.
+func latestSpendOfAmount(
+	payments []GoldPayment,
+	spends []int,
+	refunded map[int]bool,
+	refund GoldPayment,
+) (int, bool) {
+	latest := -1
+	for _, i := range spends {
+		spend := payments[i]
+		if refunded[i] || spend.Date.After(refund.Date) ||
+			math.Abs(spend.Amount-math.Abs(refund.Amount)) >= 0.005 {
+			continue
+		}
+		if latest < 0 || spend.Date.After(payments[latest].Date) {
+			latest = i
+		}
+	}
+	return latest, latest >= 0
+}
@@ -0,0 +1,143 @@
+package gold_sales
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAsGoldSpend(t *testing.T) {
+	testCases := []struct {
+		Name       string
+		Payment    GoldPayment
+		Counted    bool
+		GramWeight float64
+	}{
+		{"Gold spend",
+			GoldPayment{Description: GoldSpend, ToCurrency: GoldCurrencyCode, Amount: 100, GramWeight: 2},
+			true, 2},
+		{"Card refund",
+			GoldPayment{Description: GoldRefund, ToCurrency: GoldCurrencyCode, Amount: 100, GramWeight: 2},
+			true, -2},
+		{"Negative card spend",
+			GoldPayment{Description: GoldSpend, ToCurrency: GoldCurrencyCode, Amount: -100, GramWeight: -2},
+			true, -2},
+		{"Card spend not in gold",
+			GoldPayment{Description: GoldSpend, ToCurrency: "GBP", Amount: 100, GramWeight: 100},
+			false, 100},
+		{"Refund not in gold",
+			GoldPayment{Description: GoldRefund, ToCurrency: "GBP", Amount: 100, GramWeight: 100},
+			false, 100},
+		{"Gold sale",
+			GoldPayment{Description: GoldSell, FromCurrency: GoldCurrencyCode, Amount: 2, GramWeight: 2},
+			false, 2},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			payment, counted := tc.Payment.AsGoldSpend()
+			assert.Equal(t, tc.Counted, counted)
+			assert.Equal(t, tc.GramWeight, payment.GramWeight)
+			if counted {
+				assert.Equal(t, tc.GramWeight < 0, payment.Amount < 0,
+					"amount and weight have the same sign")
+			}
+		})
+	}
+}
+
+func TestDateRefundsAsOriginals(t *testing.T) {
+	spender := Spender{Email: "alayna.sparks@mailinator.com"}
+	march := time.Date(2020, 3, 22, 13, 28, 0, 0, time.UTC)
+	april := time.Date(2020, 4, 2, 9, 0, 0, 0, time.UTC)
+	may := time.Date(2020, 5, 12, 8, 22, 0, 0, time.UTC)
+	spend := func(date time.Time, amount float64, reference string) GoldPayment {
+		return GoldPayment{Spender: spender, Description: GoldSpend,
+			ToCurrency: GoldCurrencyCode, Amount: amount, Date: date, Reference: reference}
+	}
+	refund := func(amount float64, originalReference string) GoldPayment {
+		return GoldPayment{Spender: spender, Description: GoldRefund,
+			ToCurrency: GoldCurrencyCode, Amount: -amount, Date: may,
+			OriginalReference: originalReference}
+	}
+
+	testCases := []struct {
+		Name     string
+		Payments []GoldPayment
+		Expected time.Time
+	}{
+		{"Matched by reference",
+			[]GoldPayment{spend(march, 100, "T1"), spend(april, 100, "T2"), refund(100, "T1")},
+			march},
+		{"Latest spend of the same amount",
+			[]GoldPayment{spend(march, 100, ""), spend(april, 100, ""), refund(100, "")},
+			april},
+		{"Unknown reference falls back to the amount",
+			[]GoldPayment{spend(march, 100, "T1"), spend(april, 250, "T2"), refund(250, "T9")},
+			april},
+		{"No spend of the amount",
+			[]GoldPayment{spend(march, 100, ""), refund(99, "")},
+			may},
+		{"Spends after the refund are not refunded",
+			[]GoldPayment{refund(100, ""), spend(may.AddDate(0, 1, 0), 100, "")},
+			may},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			dated := DateRefundsAsOriginals(tc.Payments)
+			for i, payment := range dated {
+				if payment.IsGoldRefund() {
+					assert.Equal(t, tc.Expected, payment.Date)
+				} else {
+					assert.Equal(t, tc.Payments[i], payment, "spends are unchanged")
+				}
+			}
+		})
+	}
+}
+
+func TestDateRefundsAsOriginalsMatchesEachSpendOnce(t *testing.T) {
+	spender := Spender{Email: "alayna.sparks@mailinator.com"}
+	march := time.Date(2020, 3, 22, 13, 28, 0, 0, time.UTC)
+	april := time.Date(2020, 4, 2, 9, 0, 0, 0, time.UTC)
+	may := time.Date(2020, 5, 12, 8, 22, 0, 0, time.UTC)
+	spend := func(date time.Time, reference string) GoldPayment {
+		return GoldPayment{Spender: spender, Description: GoldSpend,
+			ToCurrency: GoldCurrencyCode, Amount: 100, Date: date, Reference: reference}
+	}
+	refund := func(originalReference string) GoldPayment {
+		return GoldPayment{Spender: spender, Description: GoldRefund,
+			ToCurrency: GoldCurrencyCode, Amount: -100, Date: may,
+			OriginalReference: originalReference}
+	}
+
+	testCases := []struct {
+		Name     string
+		Payments []GoldPayment
+		Expected []time.Time
+	}{
+		{"Two refunds of two spends",
+			[]GoldPayment{spend(march, ""), spend(april, ""), refund(""), refund("")},
+			[]time.Time{april, march}},
+		{"Spends named by a later refund are kept for it",
+			[]GoldPayment{spend(march, "T1"), spend(april, "T2"), refund(""), refund("T2")},
+			[]time.Time{march, april}},
+		{"More refunds than spends",
+			[]GoldPayment{spend(march, ""), refund(""), refund("")},
+			[]time.Time{march, may}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			refunds := make([]time.Time, 0)
+			for _, payment := range DateRefundsAsOriginals(tc.Payments) {
+				if payment.IsGoldRefund() {
+					refunds = append(refunds, payment.Date)
+				}
+			}
+			assert.Equal(t, tc.Expected, refunds)
+		})
+	}
+}
@@ -0,0 +1,76 @@
+package gold_sales
+
+import (
+	"io"
+	"sort"
+
+	"github.com/pkg/errors"
+)
+
+// Renderer writes a MonthlyTopSpendersAnalysisReport out in a particular
+// format.
+type Renderer interface {
+	Render(w io.Writer, report *MonthlyTopSpendersAnalysisReport) error
+}
+
+// RendererFunc adapts a function to a Renderer.
+type RendererFunc func(w io.Writer, report *MonthlyTopSpendersAnalysisReport) error
+
+func (rf RendererFunc) Render(w io.Writer, report *MonthlyTopSpendersAnalysisReport) error {
+	return rf(w, report)
+}
+
+// RendererRegistry of the output formats available, by name.
+type RendererRegistry struct {
+	renderers map[string]Renderer
+}
+
+// NewRendererRegistry with the built in output formats registered.
+func NewRendererRegistry() *RendererRegistry {
+	rr := &RendererRegistry{renderers: make(map[string]Renderer)}
+	rr.renderers["csv"] = RendererFunc(renderCSV)
+	rr.renderers["html"] = RendererFunc(renderHTML)
+	rr.renderers["json"] = RendererFunc(renderJSON)
+	rr.renderers["xlsx"] = RendererFunc(renderXLSX)
+	return rr
+}
+
+// Register a Renderer under the name, which must not already be in use.
+func (rr *RendererRegistry) Register(name string, renderer Renderer) error {
+	if _, ok := rr.renderers[name]; ok {
+		return errors.Errorf("renderer %q already registered", name)
+	}
+	rr.renderers[name] = renderer
+	return nil
+}
+
+// Replace the Renderer registered under the name, registering it if the name
+// is not in use.
+func (rr *RendererRegistry) Replace(name string, renderer Renderer) {
+	rr.renderers[name] = renderer
+}
+
+// Lookup the Renderer registered under the name.
+func (rr *RendererRegistry) Lookup(name string) (Renderer, error) {
+	renderer, ok := rr.renderers[name]
+	if !ok {
+		return nil, errors.Errorf("no renderer registered for format %q, have %v",
+			name, rr.Names())
+	}
+	return renderer, nil
+}
+
+// Names of the registered Renderers in alphabetical order.
+func (rr *RendererRegistry) Names() []string {
+	names := make([]string, 0, len(rr.renderers))
+	for name := range rr.renderers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func renderCSV(w io.Writer, report *MonthlyTopSpendersAnalysisReport) error {
+	_, err := io.Copy(w, report.FormattedAsCSV())
+	return err
+}
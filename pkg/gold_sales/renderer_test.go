@@ -0,0 +1,202 @@
+package gold_sales
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRendererRegistry(t *testing.T) {
+	renderers := NewRendererRegistry()
+
+	_, err := renderers.Lookup("csv")
+	assert.Nil(t, err, "csv renderer should be built in")
+
+	_, err = renderers.Lookup("missing")
+	assert.NotNil(t, err, "expected error for unknown format")
+
+	assert.NotNil(t, renderers.Register("csv", RendererFunc(renderCSV)),
+		"expected error registering a duplicate name")
+}
+
+func TestTemplateRenderers(t *testing.T) {
+	testCases := []struct {
+		Name     string
+		HTML     bool
+		Source   string
+		Expected string
+	}{
+		{
+			"Text template",
+			false,
+			`{{range .Months}}{{.Month}}:{{range $i, $s := .Spenders}} {{rank $i}}={{$s.Spender.LastName}}{{end}}{{end}}`,
+			"Jun 2020: 1=Smith, Jr. 2=O'Neil",
+		},
+		{
+			"HTML template escapes values",
+			true,
+			`{{range .Months}}{{range .Spenders}}<td>{{.Spender.LastName}}</td>{{end}}{{end}}`,
+			"<td>Smith, Jr.</td><td>O&#39;Neil</td>",
+		},
+		{
+			"Fixed width",
+			false,
+			`{{range .Months}}{{range .Spenders}}{{padRight 6 .Spender.LastName}}{{padLeft 7 .TotalSpend}}|{{end}}{{end}}`,
+			"Smith,  12.50|O'Neil   3.25|",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			var renderer *TemplateRenderer
+			var err error
+			if tc.HTML {
+				renderer, err = NewHTMLTemplateRenderer("test", tc.Source)
+			} else {
+				renderer, err = NewTextTemplateRenderer("test", tc.Source)
+			}
+			require.Nil(t, err, "unexpected error")
+
+			var buf bytes.Buffer
+			require.Nil(t, renderer.Render(&buf, reportForTests()))
+			assert.Equal(t, tc.Expected, buf.String())
+		})
+	}
+}
+
+func reportForTests() *MonthlyTopSpendersAnalysisReport {
+	report := NewMonthlyTopSpendersAnalysisReport(6)
+	_ = report.AddMonth("Jun 2020", MonthlySpenders{
+		{
+			Spender:    Spender{FirstName: "Jo", LastName: "Smith, Jr.", Email: "jo@mock.com"},
+			TotalSpend: 12.5,
+		},
+		{
+			Spender:    Spender{FirstName: "Sam", LastName: "O'Neil", Email: "sam@mock.com"},
+			TotalSpend: 3.25,
+		},
+	})
+	return report
+}
+
+func TestHTMLRendererIsSelfContained(t *testing.T) {
+	report := reportForTests()
+	report.SetMonthTotal("Jun 2020", 20)
+	renderer, err := NewRendererRegistry().Lookup("html")
+	require.Nil(t, err, "html renderer should be built in")
+
+	var buf bytes.Buffer
+	require.Nil(t, renderer.Render(&buf, report))
+	html := buf.String()
+
+	assert.Contains(t, html, "<h2>Jun 2020</h2>")
+	assert.Contains(t, html, "Smith, Jr.")
+	assert.Contains(t, html, "O&#39;Neil")
+	assert.Contains(t, html, "<polyline class=\"trend\"")
+	assert.Contains(t, html, "20.00")
+	assert.NotContains(t, html, "<script")
+	assert.NotContains(t, html, "http", "no external resources")
+}
+
+func TestJSONRenderer(t *testing.T) {
+	report := reportForTests()
+	report.SetMonthTotal("Jun 2020", 20)
+	renderer, err := NewRendererRegistry().Lookup("json")
+	require.Nil(t, err, "json renderer should be built in")
+
+	var buf bytes.Buffer
+	require.Nil(t, renderer.Render(&buf, report))
+
+	var rendered jsonReport
+	require.Nil(t, json.Unmarshal(buf.Bytes(), &rendered))
+	require.Len(t, rendered.Months, 1)
+	assert.Equal(t, ReportMonth("Jun 2020"), rendered.Months[0].Month)
+	assert.Equal(t, TotalSpend(20), rendered.Months[0].MonthTotal)
+	require.Len(t, rendered.Months[0].Spenders, 2)
+	assert.Equal(t, jsonSpend{Rank: 2, FirstName: "Sam", LastName: "O'Neil",
+		Email: "sam@mock.com", Grams: 3.25}, rendered.Months[0].Spenders[1])
+}
+
+func TestXLSXRendererWritesTypedSheets(t *testing.T) {
+	report := reportForTests()
+	report.SetMonthTotal("Jun 2020", 20)
+	renderer, err := NewRendererRegistry().Lookup("xlsx")
+	require.Nil(t, err, "xlsx renderer should be built in")
+
+	var buf bytes.Buffer
+	require.Nil(t, renderer.Render(&buf, report))
+
+	parts := xlsxPartsForTests(t, buf.Bytes())
+
+	require.Contains(t, parts, "xl/workbook.xml")
+	assert.Contains(t, parts["xl/workbook.xml"], `<sheet name="Summary"`)
+	assert.Contains(t, parts["xl/workbook.xml"], `<sheet name="Jun 2020"`)
+
+	summary := parts["xl/worksheets/sheet1.xml"]
+	assert.Contains(t, summary, `<c r="A2" s="4"><v>43983</v></c>`, "month as a date")
+	assert.Contains(t, summary, `<c r="B2" s="2"><v>20</v></c>`, "total as grams")
+
+	month := parts["xl/worksheets/sheet2.xml"]
+	assert.Contains(t, month, `<t>Smith, Jr.</t>`)
+	assert.Contains(t, month, `<c r="E2" s="2"><v>12.5</v></c>`, "spend as grams")
+}
+
+func TestXLSXRendererFormatsAmountsInPoundsWhenAllGBP(t *testing.T) {
+	tests := []struct {
+		name       string
+		currencies []string
+		style      string
+	}{
+		{name: "all GBP", currencies: []string{"GBP", "GBP"}, style: `s="5"`},
+		{name: "mixed", currencies: []string{"GBP", "USD"}, style: `s="3"`},
+		{name: "unknown", currencies: []string{"", ""}, style: `s="3"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			report := NewMonthlyTopSpendersAnalysisReport(1)
+			require.Nil(t, report.AddMonth("Jun 2020", MonthlySpenders{
+				{Spender: Spender{Email: "jo@mock.com"}, TotalSpend: 2, TotalAmount: 80,
+					Currency: tt.currencies[0]},
+				{Spender: Spender{Email: "sam@mock.com"}, TotalSpend: 1, TotalAmount: 40.5,
+					Currency: tt.currencies[1]},
+			}))
+
+			var buf bytes.Buffer
+			require.Nil(t, renderXLSX(&buf, report))
+			parts := xlsxPartsForTests(t, buf.Bytes())
+
+			assert.Contains(t, parts["xl/styles.xml"],
+				`<numFmt numFmtId="167" formatCode="&quot;£&quot;#,##0.00"/>`)
+			assert.Contains(t, parts["xl/worksheets/sheet1.xml"],
+				`<c r="D2" `+tt.style+`><v>120.5</v></c>`, "top spenders amount")
+			assert.Contains(t, parts["xl/worksheets/sheet2.xml"],
+				`<c r="F3" `+tt.style+`><v>40.5</v></c>`, "spend amount")
+		})
+	}
+}
+
+func xlsxPartsForTests(t *testing.T, workbook []byte) map[string]string {
+	archive, err := zip.NewReader(bytes.NewReader(workbook), int64(len(workbook)))
+	require.Nil(t, err, "expected a zip package")
+	parts := make(map[string]string)
+	for _, file := range archive.File {
+		rdr, err := file.Open()
+		require.Nil(t, err)
+		content, err := ioutil.ReadAll(rdr)
+		require.Nil(t, err)
+		parts[file.Name] = string(content)
+	}
+	return parts
+}
+
+func TestXLSXColumn(t *testing.T) {
+	assert.Equal(t, "A", xlsxColumn(0))
+	assert.Equal(t, "Z", xlsxColumn(25))
+	assert.Equal(t, "AA", xlsxColumn(26))
+	assert.Equal(t, "BA", xlsxColumn(52))
+}
@@ -0,0 +1,209 @@
+package gold_sales
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"strings"
+)
+
+// ReportDiff describes how a report changed between two runs.
+type ReportDiff struct {
+	MonthsAdded   []ReportMonth `json:"monthsAdded"`
+	MonthsRemoved []ReportMonth `json:"monthsRemoved"`
+	Months        []MonthDiff   `json:"months"`
+}
+
+// MonthDiff of a month in both reports. Entered and Left are the spenders
+// that joined or dropped out of the top spenders and Changed are those in
+// both whose rank changed or whose spend changed by more than the tolerance.
+// TotalChanged is set when both reports have the month total and it changed by
+// more than the tolerance.
+type MonthDiff struct {
+	Month        ReportMonth   `json:"month"`
+	TotalBefore  TotalSpend    `json:"totalBefore"`
+	TotalAfter   TotalSpend    `json:"totalAfter"`
+	TotalChanged bool          `json:"totalChanged"`
+	Entered      []RankedSpend `json:"entered"`
+	Left         []RankedSpend `json:"left"`
+	Changed      []SpendChange `json:"changed"`
+}
+
+// RankedSpend of a spender in a month.
+type RankedSpend struct {
+	Rank       int        `json:"rank"`
+	Spender    Spender    `json:"spender"`
+	TotalSpend TotalSpend `json:"totalSpend"`
+}
+
+// SpendChange of a spender in the top spenders of both reports.
+type SpendChange struct {
+	Spender    Spender    `json:"spender"`
+	RankBefore int        `json:"rankBefore"`
+	RankAfter  int        `json:"rankAfter"`
+	Before     TotalSpend `json:"before"`
+	After      TotalSpend `json:"after"`
+}
+
+// DiffReports before and after, ignoring spend changes no larger than the
+// tolerance. Months only appear in Months when something in them changed.
+func DiffReports(
+	before *MonthlyTopSpendersAnalysisReport,
+	after *MonthlyTopSpendersAnalysisReport,
+	tolerance TotalSpend,
+) ReportDiff {
+	diff := ReportDiff{
+		MonthsAdded:   make([]ReportMonth, 0),
+		MonthsRemoved: make([]ReportMonth, 0),
+		Months:        make([]MonthDiff, 0),
+	}
+
+	beforeMonths := make(map[ReportMonth]MonthTopSpenders)
+	for _, month := range before.Months() {
+		beforeMonths[month.Month] = month
+	}
+	afterMonths := make(map[ReportMonth]bool)
+	for _, month := range after.Months() {
+		afterMonths[month.Month] = true
+		previous, ok := beforeMonths[month.Month]
+		if !ok {
+			diff.MonthsAdded = append(diff.MonthsAdded, month.Month)
+			continue
+		}
+		_, beforeTotal := before.MonthTotal(month.Month)
+		_, afterTotal := after.MonthTotal(month.Month)
+		monthDiff := diffMonth(previous, month, tolerance)
+		monthDiff.TotalChanged = monthDiff.TotalChanged && beforeTotal && afterTotal
+		if len(monthDiff.Entered) > 0 || len(monthDiff.Left) > 0 ||
+			len(monthDiff.Changed) > 0 || monthDiff.TotalChanged {
+			diff.Months = append(diff.Months, monthDiff)
+		}
+	}
+	for _, month := range before.Months() {
+		if !afterMonths[month.Month] {
+			diff.MonthsRemoved = append(diff.MonthsRemoved, month.Month)
+		}
+	}
+
+	return diff
+}
+
+func diffMonth(before, after MonthTopSpenders, tolerance TotalSpend) MonthDiff {
+	monthDiff := MonthDiff{
+		Month:       after.Month,
+		TotalBefore: before.MonthTotal,
+		TotalAfter:  after.MonthTotal,
+		TotalChanged: exceedsTolerance(before.MonthTotal, after.MonthTotal,
+			tolerance),
+		Entered: make([]RankedSpend, 0),
+		Left:    make([]RankedSpend, 0),
+		Changed: make([]SpendChange, 0),
+	}
+
+	beforeRanks := make([]RankedSpend, len(before.Spenders))
+	for i, spend := range before.Spenders {
+		beforeRanks[i] = RankedSpend{i + 1, spend.Spender, spend.TotalSpend}
+	}
+	matched := make(map[int]bool)
+	for i, spend := range after.Spenders {
+		previousIdx := matchSpender(beforeRanks, spend.Spender, matched)
+		if previousIdx < 0 {
+			monthDiff.Entered = append(monthDiff.Entered,
+				RankedSpend{i + 1, spend.Spender, spend.TotalSpend})
+			continue
+		}
+		matched[previousIdx] = true
+		previous := beforeRanks[previousIdx]
+		if exceedsTolerance(previous.TotalSpend, spend.TotalSpend, tolerance) ||
+			previous.Rank != i+1 {
+			monthDiff.Changed = append(monthDiff.Changed, SpendChange{
+				Spender:    spend.Spender,
+				RankBefore: previous.Rank,
+				RankAfter:  i + 1,
+				Before:     previous.TotalSpend,
+				After:      spend.TotalSpend,
+			})
+		}
+	}
+	for i, ranked := range beforeRanks {
+		if !matched[i] {
+			monthDiff.Left = append(monthDiff.Left, ranked)
+		}
+	}
+
+	return monthDiff
+}
+
+// matchSpender returns the index of the spender in the ranks, -1 if they are
+// not there. Spenders are matched by email, or by name when either side has
+// no email, as CSV reports are written without one by default. Ranks already
+// matched to another spender are skipped, so spenders sharing a name are
+// matched in rank order.
+func matchSpender(ranks []RankedSpend, spender Spender, matched map[int]bool) int {
+	for i, ranked := range ranks {
+		if matched[i] {
+			continue
+		}
+		if ranked.Spender.Email != "" && spender.Email != "" {
+			if ranked.Spender.Email == spender.Email {
+				return i
+			}
+			continue
+		}
+		if ranked.Spender.FirstName == spender.FirstName &&
+			ranked.Spender.LastName == spender.LastName {
+			return i
+		}
+	}
+	return -1
+}
+
+func exceedsTolerance(before, after, tolerance TotalSpend) bool {
+	return math.Abs(float64(after-before)) > float64(tolerance)
+}
+
+// Empty when the reports are the same within the tolerance.
+func (rd ReportDiff) Empty() bool {
+	return len(rd.MonthsAdded) == 0 && len(rd.MonthsRemoved) == 0 &&
+		len(rd.Months) == 0
+}
+
+// WriteText writes the diff for people to read.
+func (rd ReportDiff) WriteText(w io.Writer) error {
+	var b strings.Builder
+	if rd.Empty() {
+		b.WriteString("No differences\n")
+	}
+	for _, month := range rd.MonthsAdded {
+		fmt.Fprintf(&b, "+ %s added\n", month)
+	}
+	for _, month := range rd.MonthsRemoved {
+		fmt.Fprintf(&b, "- %s removed\n", month)
+	}
+	for _, month := range rd.Months {
+		fmt.Fprintf(&b, "%s\n", month.Month)
+		if month.TotalChanged {
+			fmt.Fprintf(&b, "  total %s -> %s (%+.2f)\n", month.TotalBefore,
+				month.TotalAfter, month.TotalAfter-month.TotalBefore)
+		}
+		for _, spend := range month.Entered {
+			fmt.Fprintf(&b, "  + #%d %s %s <%s> %s\n", spend.Rank,
+				spend.Spender.FirstName, spend.Spender.LastName,
+				spend.Spender.Email, spend.TotalSpend)
+		}
+		for _, spend := range month.Left {
+			fmt.Fprintf(&b, "  - #%d %s %s <%s> %s\n", spend.Rank,
+				spend.Spender.FirstName, spend.Spender.LastName,
+				spend.Spender.Email, spend.TotalSpend)
+		}
+		for _, change := range month.Changed {
+			fmt.Fprintf(&b, "  ~ #%d -> #%d %s %s <%s> %s -> %s (%+.2f)\n",
+				change.RankBefore, change.RankAfter,
+				change.Spender.FirstName, change.Spender.LastName,
+				change.Spender.Email, change.Before, change.After,
+				change.After-change.Before)
+		}
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
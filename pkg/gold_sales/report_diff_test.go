@@ -0,0 +1,49 @@
+package gold_sales
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiffReports(t *testing.T) {
+	jo := Spender{FirstName: "Jo", LastName: "Smith", Email: "jo@mock.com"}
+	sam := Spender{FirstName: "Sam", LastName: "Neil", Email: "sam@mock.com"}
+	kit := Spender{FirstName: "Kit", LastName: "Marlowe", Email: "kit@mock.com"}
+
+	before := NewMonthlyTopSpendersAnalysisReport(6)
+	_ = before.AddMonth("Jun 2020", MonthlySpenders{{Spender: jo, TotalSpend: 12.5},
+		{Spender: sam, TotalSpend: 3.25}})
+	before.SetMonthTotal("Jun 2020", 20)
+	_ = before.AddMonth("May 2020", MonthlySpenders{{Spender: jo, TotalSpend: 1}})
+
+	after := NewMonthlyTopSpendersAnalysisReport(6)
+	_ = after.AddMonth("Jul 2020", MonthlySpenders{{Spender: kit, TotalSpend: 2}})
+	_ = after.AddMonth("Jun 2020", MonthlySpenders{{Spender: kit, TotalSpend: 13},
+		{Spender: jo, TotalSpend: 12.501}})
+	after.SetMonthTotal("Jun 2020", 20.001)
+
+	diff := DiffReports(before, after, 0.01)
+	assert.Equal(t, []ReportMonth{"Jul 2020"}, diff.MonthsAdded)
+	assert.Equal(t, []ReportMonth{"May 2020"}, diff.MonthsRemoved)
+	require.Len(t, diff.Months, 1)
+
+	june := diff.Months[0]
+	assert.False(t, june.TotalChanged, "total change is within tolerance")
+	assert.Equal(t, []RankedSpend{{Rank: 1, Spender: kit, TotalSpend: 13}}, june.Entered)
+	assert.Equal(t, []RankedSpend{{Rank: 2, Spender: sam, TotalSpend: 3.25}}, june.Left)
+	assert.Equal(t, []SpendChange{{Spender: jo, RankBefore: 1, RankAfter: 2,
+		Before: 12.5, After: 12.501}}, june.Changed)
+
+	assert.True(t, DiffReports(before, before, 0).Empty())
+}
+
+func TestDiffReportsSpendersSharingAName(t *testing.T) {
+	jo := Spender{FirstName: "Jo", LastName: "Smith"}
+	report := NewMonthlyTopSpendersAnalysisReport(6)
+	_ = report.AddMonth("Jun 2020", MonthlySpenders{{Spender: jo, TotalSpend: 12.5},
+		{Spender: jo, TotalSpend: 3.25}})
+
+	assert.True(t, DiffReports(report, report, 0).Empty())
+}
@@ -0,0 +1,168 @@
+package gold_sales
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// ReadReport previously written in the format, either csv or json, so it can
+// be compared, re-rendered or served without the ledger it came from.
+func ReadReport(r io.Reader, format string, options CSVOptions) (*MonthlyTopSpendersAnalysisReport, error) {
+	switch format {
+	case "json":
+		return ReadJSONReport(r)
+	case "csv":
+		return ReadCSVReport(r, options)
+	}
+	return nil, errors.Errorf("reports in format %q cannot be read, only csv and json", format)
+}
+
+// ReadJSONReport written by the json output format, checking it matches the
+// schema. Reports written before the schema was recorded are accepted.
+func ReadJSONReport(r io.Reader) (*MonthlyTopSpendersAnalysisReport, error) {
+	var view jsonReport
+	decoder := json.NewDecoder(r)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&view); err != nil {
+		return nil, errors.Wrap(err, "failed to parse JSON report")
+	}
+	if view.Schema != "" && view.Schema != jsonReportSchema {
+		return nil, errors.Errorf("unsupported report schema %q, expected %q",
+			view.Schema, jsonReportSchema)
+	}
+
+	report := NewMonthlyTopSpendersAnalysisReport(len(view.Months))
+	for _, month := range view.Months {
+		spenders := make(MonthlySpenders, 0, len(month.Spenders))
+		for i, spend := range month.Spenders {
+			if spend.Rank != i+1 {
+				return nil, errors.Errorf("%s: spender %d has rank %d",
+					month.Month, i+1, spend.Rank)
+			}
+			spenders = append(spenders, MonthlySpend{
+				Spender: Spender{
+					FirstName: spend.FirstName,
+					LastName:  spend.LastName,
+					Email:     spend.Email,
+				},
+				TotalSpend:  spend.Grams,
+				TotalAmount: spend.Amount,
+				Currency:    spend.Currency,
+			})
+		}
+		if err := addReadMonth(report, month.Month, spenders); err != nil {
+			return nil, err
+		}
+		report.SetMonthTotal(month.Month, month.MonthTotal)
+	}
+	report.SetProvenance(view.Provenance)
+	return report, nil
+}
+
+// ReadCSVReport written by the csv output format. A header row, if there is
+// one, names the columns. Without one the options say which optional columns
+// the report was written with. CSV reports do not carry month totals, GBP
+// amounts or provenance, so these are left empty.
+func ReadCSVReport(r io.Reader, options CSVOptions) (*MonthlyTopSpendersAnalysisReport, error) {
+	buffered := bufio.NewReader(r)
+	if bom, err := buffered.Peek(len(utf8BOM)); err == nil && string(bom) == utf8BOM {
+		_, _ = buffered.Discard(len(utf8BOM))
+	}
+	rdr := csv.NewReader(buffered)
+	if options.Delimiter != 0 {
+		rdr.Comma = options.Delimiter
+	}
+	rows, err := rdr.ReadAll()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to parse CSV report")
+	}
+
+	columns := options.columns([]string{"month", "rank", "first_name",
+		"last_name", "email", "total_spend"})
+	if len(rows) > 0 && len(rows[0]) > 0 && rows[0][0] == "month" {
+		columns, rows = rows[0], rows[1:]
+	}
+	columnIndex := make(map[string]int)
+	for i, column := range columns {
+		columnIndex[column] = i
+	}
+	for _, required := range []string{"month", "first_name", "last_name", "total_spend"} {
+		if _, ok := columnIndex[required]; !ok {
+			return nil, errors.Errorf("CSV report has no %s column", required)
+		}
+	}
+	field := func(row []string, column string) string {
+		if i, ok := columnIndex[column]; ok {
+			return row[i]
+		}
+		return ""
+	}
+
+	months := make([]ReportMonth, 0)
+	spendersByMonth := make(map[ReportMonth]MonthlySpenders)
+	for i, row := range rows {
+		line := i + 2
+		if len(row) != len(columns) {
+			return nil, errors.Errorf("line %d: expected %d fields, got %d",
+				line, len(columns), len(row))
+		}
+		month := ReportMonth(field(row, "month"))
+		if _, ok := spendersByMonth[month]; !ok {
+			months = append(months, month)
+		} else if months[len(months)-1] != month {
+			return nil, errors.Errorf("line %d: rows for %s are not together", line, month)
+		}
+		if rank := field(row, "rank"); rank != "" &&
+			rank != strconv.Itoa(len(spendersByMonth[month])+1) {
+			return nil, errors.Errorf("line %d: unexpected rank %s", line, rank)
+		}
+		grams, err := strconv.ParseFloat(strings.TrimSpace(field(row, "total_spend")), 64)
+		if err != nil {
+			return nil, errors.Errorf("line %d: invalid total spend %q",
+				line, field(row, "total_spend"))
+		}
+		spendersByMonth[month] = append(spendersByMonth[month], MonthlySpend{
+			Spender: Spender{
+				FirstName: field(row, "first_name"),
+				LastName:  field(row, "last_name"),
+				Email:     field(row, "email"),
+			},
+			TotalSpend: TotalSpend(grams),
+		})
+	}
+
+	report := NewMonthlyTopSpendersAnalysisReport(len(months))
+	for _, month := range months {
+		if err := addReadMonth(report, month, spendersByMonth[month]); err != nil {
+			return nil, err
+		}
+	}
+	return report, nil
+}
+
+// addReadMonth to the report once the month and spends are known to be valid.
+func addReadMonth(
+	report *MonthlyTopSpendersAnalysisReport,
+	month ReportMonth,
+	spenders MonthlySpenders,
+) error {
+	if _, err := time.Parse("Jan 2006", string(month)); err != nil {
+		return errors.Errorf("invalid report month %q", month)
+	}
+	for _, spend := range spenders {
+		if spend.TotalSpend < 0 {
+			return errors.Errorf("%s: negative spend for %s", month, spend.Spender)
+		}
+	}
+	if err := report.AddMonth(month, spenders); err != nil {
+		return errors.Wrapf(err, "invalid report month %q", month)
+	}
+	return nil
+}
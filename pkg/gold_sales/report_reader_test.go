@@ -0,0 +1,84 @@
+package gold_sales
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestJSONReportRoundTrip(t *testing.T) {
+	report := reportForTests()
+	report.SetMonthTotal("Jun 2020", 20)
+	report.SetProvenance(&ReportProvenance{ToolVersion: "v1.0.0",
+		Inputs: []InputProvenance{{Filename: "ledger.csv", SHA256: "abc"}}})
+
+	var buf bytes.Buffer
+	require.Nil(t, renderJSON(&buf, report))
+	loaded, err := ReadJSONReport(&buf)
+	require.Nil(t, err, "unexpected error")
+
+	assert.Equal(t, report.Months(), loaded.Months())
+	assert.Equal(t, report.Provenance(), loaded.Provenance())
+	assert.True(t, DiffReports(report, loaded, 0).Empty())
+
+	invalid := []string{
+		`{"months": [{"month": "June"}]}`,
+		`{"schema": "other/v9", "months": []}`,
+		`{"months": [], "unknown": true}`,
+		`{"months": [{"month": "Jun 2020", "spenders": [{"rank": 2}]}]}`,
+	}
+	for _, document := range invalid {
+		_, err = ReadJSONReport(bytes.NewBufferString(document))
+		assert.NotNil(t, err, "expected error for %s", document)
+	}
+}
+
+func TestCSVReportRoundTrip(t *testing.T) {
+	testCases := []struct {
+		Name    string
+		Options CSVOptions
+	}{
+		{"Default columns", DefaultCSVOptions()},
+		{"Header with every column", CSVOptions{Header: true, Rank: true, Email: true,
+			Delimiter: ';', BOM: true}},
+		{"Rank and email without header", CSVOptions{Rank: true, Email: true, Delimiter: ','}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			report := reportForTests()
+			written := report.FormattedAsCSVWithOptions(tc.Options)
+			loaded, err := ReadCSVReport(written, tc.Options)
+			require.Nil(t, err, "unexpected error")
+
+			months := loaded.Months()
+			require.Len(t, months, 1)
+			assert.Equal(t, ReportMonth("Jun 2020"), months[0].Month)
+			require.Len(t, months[0].Spenders, 2)
+			assert.Equal(t, "Smith, Jr.", months[0].Spenders[0].Spender.LastName)
+			assert.Equal(t, TotalSpend(12.5), months[0].Spenders[0].TotalSpend)
+			if tc.Options.Email {
+				assert.Equal(t, "sam@mock.com", months[0].Spenders[1].Spender.Email)
+			}
+			_, ok := loaded.MonthTotal("Jun 2020")
+			assert.False(t, ok, "CSV reports carry no month totals")
+		})
+	}
+
+	invalid := []string{
+		"Jun 2020,Jo,Smith,abc\n",
+		"June,Jo,Smith,1.00\n",
+		"Jun 2020,Jo,Smith,1.00\nMay 2020,Sam,Neil,1.00\nJun 2020,Kit,Marlowe,1.00\n",
+		"month,rank,first_name,last_name,total_spend\nJun 2020,2,Jo,Smith,1.00\n",
+		"month,total_spend\nJun 2020,1.00\n",
+	}
+	for _, document := range invalid {
+		_, err := ReadCSVReport(bytes.NewBufferString(document), DefaultCSVOptions())
+		assert.NotNil(t, err, "expected error for %q", document)
+	}
+
+	_, err := ReadReport(bytes.NewBufferString(""), "xlsx", DefaultCSVOptions())
+	assert.NotNil(t, err, "expected error for an unreadable format")
+}
@@ -2,8 +2,10 @@ package gold_sales
 
 import (
 	"bytes"
+	"encoding/csv"
 	"fmt"
 	"sort"
+	"strconv"
 	"time"
 
 	"github.com/pkg/errors"
@@ -12,13 +14,16 @@ import (
 // MonthlyTopSpendersAnalysisReport that ranks the top spenders by month.
 type MonthlyTopSpendersAnalysisReport struct {
 	monthlySpenders map[ReportMonth]MonthlySpenders
+	monthlyTotals   map[ReportMonth]TotalSpend
 	months          OrderedReportMonths
 	numOfMonths     int
+	provenance      *ReportProvenance
 }
 
 func NewMonthlyTopSpendersAnalysisReport(numOfMonths int) *MonthlyTopSpendersAnalysisReport {
 	return &MonthlyTopSpendersAnalysisReport{
 		monthlySpenders: make(map[ReportMonth]MonthlySpenders),
+		monthlyTotals:   make(map[ReportMonth]TotalSpend),
 		numOfMonths:     numOfMonths,
 		months:          make(OrderedReportMonths, 0),
 	}
@@ -36,6 +41,44 @@ func (mtsar *MonthlyTopSpendersAnalysisReport) AddMonth(
 	return nil
 }
 
+// SetMonthTotal records the total gold spent by every spender in the month,
+// not only the top spenders.
+func (mtsar *MonthlyTopSpendersAnalysisReport) SetMonthTotal(
+	month ReportMonth,
+	total TotalSpend,
+) {
+	mtsar.monthlyTotals[month] = total
+}
+
+// MonthTotal recorded for the month, if one was.
+func (mtsar MonthlyTopSpendersAnalysisReport) MonthTotal(month ReportMonth) (TotalSpend, bool) {
+	total, ok := mtsar.monthlyTotals[month]
+	return total, ok
+}
+
+// SetProvenance of the report.
+func (mtsar *MonthlyTopSpendersAnalysisReport) SetProvenance(provenance *ReportProvenance) {
+	mtsar.provenance = provenance
+}
+
+// Provenance of the report, nil if it was not recorded.
+func (mtsar MonthlyTopSpendersAnalysisReport) Provenance() *ReportProvenance {
+	return mtsar.provenance
+}
+
+// AmountCurrency the amounts of the ranked spenders were all paid from,
+// MixedCurrencies when they were paid from more than one, or empty when it
+// is not known.
+func (mtsar *MonthlyTopSpendersAnalysisReport) AmountCurrency() string {
+	currency := ""
+	for _, month := range mtsar.Months() {
+		for _, spend := range month.Spenders {
+			currency = CombineCurrencies(currency, spend.Currency)
+		}
+	}
+	return currency
+}
+
 func (mtsar MonthlyTopSpendersAnalysisReport) String() string {
 	line := ""
 	for spendMonth, topSpenders := range mtsar.monthlySpenders {
@@ -45,22 +88,71 @@ func (mtsar MonthlyTopSpendersAnalysisReport) String() string {
 	return line
 }
 
-// FormattedAsCSV in a buffer ready to be copied to an io.Writer.
+// MonthTopSpenders for a ReportMonth, in rank order.
+type MonthTopSpenders struct {
+	Month    ReportMonth     `json:"month"`
+	Spenders MonthlySpenders `json:"spenders"`
+	// MonthTotal spent by all spenders in the month.
+	MonthTotal TotalSpend `json:"monthTotal"`
+}
+
+// Months in the report, most recent first, limited to the number of months
+// the report was requested for. The months are sorted as a copy, leaving the
+// report as it was built.
+func (mtsar *MonthlyTopSpendersAnalysisReport) Months() []MonthTopSpenders {
+	ordered := make(OrderedReportMonths, len(mtsar.months))
+	copy(ordered, mtsar.months)
+	sort.Sort(ordered)
+
+	months := make([]MonthTopSpenders, 0)
+	for i := 0; i < mtsar.numOfMonths && i < len(ordered); i++ {
+		months = append(months, MonthTopSpenders{
+			Month:      ordered[i],
+			Spenders:   mtsar.monthlySpenders[ordered[i]],
+			MonthTotal: mtsar.monthlyTotals[ordered[i]],
+		})
+	}
+	return months
+}
+
+// FormattedAsCSV in a buffer ready to be copied to an io.Writer, using the
+// DefaultCSVOptions.
 func (mtsar *MonthlyTopSpendersAnalysisReport) FormattedAsCSV() *bytes.Buffer {
+	return mtsar.FormattedAsCSVWithOptions(DefaultCSVOptions())
+}
+
+// FormattedAsCSVWithOptions in a buffer ready to be copied to an io.Writer.
+func (mtsar *MonthlyTopSpendersAnalysisReport) FormattedAsCSVWithOptions(
+	options CSVOptions,
+) *bytes.Buffer {
 	var buf bytes.Buffer
-	sort.Sort(mtsar.months)
+	if options.BOM {
+		buf.WriteString(utf8BOM)
+	}
 
-	for i := 0; i < mtsar.numOfMonths && i < len(mtsar.months); i++ {
-		for _, monthlySpend := range mtsar.monthlySpenders[mtsar.months[i]] {
-			line := fmt.Sprintf("%s,%s,%s,%.2f,\n",
-				mtsar.months[i],
+	w := csv.NewWriter(&buf)
+	if options.Delimiter != 0 {
+		w.Comma = options.Delimiter
+	}
+	w.UseCRLF = options.CRLF
+
+	if options.Header {
+		_ = w.Write(options.columns([]string{"month", "rank", "first_name",
+			"last_name", "email", "total_spend"}))
+	}
+	for _, month := range mtsar.Months() {
+		for i, monthlySpend := range month.Spenders {
+			_ = w.Write(options.columns([]string{
+				string(month.Month),
+				strconv.Itoa(i + 1),
 				monthlySpend.Spender.FirstName,
 				monthlySpend.Spender.LastName,
-				monthlySpend.TotalSpend,
-			)
-			buf.WriteString(line)
+				monthlySpend.Spender.Email,
+				monthlySpend.TotalSpend.String(),
+			}))
 		}
 	}
+	w.Flush()
 
 	return &buf
 }
@@ -78,10 +170,80 @@ func (ms MonthlySpenders) Swap(i, j int) {
 	ms[i], ms[j] = ms[j], ms[i]
 }
 
+// RankingMetric that spenders are ranked by within a month.
+type RankingMetric string
+
+const (
+	// RankByGrams of gold spent, the default.
+	RankByGrams RankingMetric = "grams"
+	// RankByAmount paid for the gold.
+	RankByAmount RankingMetric = "amount"
+)
+
+// ParseRankingMetric from its name, defaulting to RankByGrams when empty.
+func ParseRankingMetric(name string) (RankingMetric, error) {
+	switch RankingMetric(name) {
+	case "", RankByGrams:
+		return RankByGrams, nil
+	case RankByAmount:
+		return RankByAmount, nil
+	}
+	return RankByGrams, errors.Errorf("unknown ranking metric %q", name)
+}
+
+// SortBy the metric, highest first.
+func (ms MonthlySpenders) SortBy(metric RankingMetric) {
+	if metric == RankByAmount {
+		sort.SliceStable(ms, func(i, j int) bool {
+			return ms[i].TotalAmount > ms[j].TotalAmount
+		})
+		return
+	}
+	sort.Sort(ms)
+}
+
 // MonthlySpend for a particular Spender.
 type MonthlySpend struct {
 	Spender    Spender    `json:"spender"`
 	TotalSpend TotalSpend `json:"totalSpend"`
+	// TotalAmount paid for the gold, in the currency it was paid from.
+	TotalAmount float64 `json:"totalAmount"`
+	// Currency the TotalAmount was paid from, MixedCurrencies when the
+	// payments were in more than one, or empty when it is not known.
+	Currency string `json:"currency,omitempty"`
+}
+
+// MixedCurrencies of amounts that were paid from more than one currency.
+const MixedCurrencies = "mixed"
+
+// CombineCurrencies of two amounts added together, MixedCurrencies unless
+// they were paid from the same currency. An unknown currency is taken to be
+// the other one.
+func CombineCurrencies(a, b string) string {
+	switch {
+	case a == "":
+		return b
+	case b == "" || a == b:
+		return a
+	}
+	return MixedCurrencies
+}
+
+// Ranked is the value of the metric the spend is ranked by.
+func (ms MonthlySpend) Ranked(metric RankingMetric) float64 {
+	if metric == RankByAmount {
+		return ms.TotalAmount
+	}
+	return float64(ms.TotalSpend)
+}
+
+// Value of the payment in the metric, its gram weight or the amount paid, so
+// single payments are measured the same way MonthlySpend is ranked.
+func (gp GoldPayment) Value(metric RankingMetric) float64 {
+	if metric == RankByAmount {
+		return gp.Amount
+	}
+	return gp.GramWeight
 }
 
 // TotalSpend formatted to meet the business requirements.
@@ -0,0 +1,63 @@
+package gold_sales
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMonthlySpendersSortBy(t *testing.T) {
+	heavy := MonthlySpend{Spender: Spender{Email: "heavy@example.com"},
+		TotalSpend: 10, TotalAmount: 400}
+	dear := MonthlySpend{Spender: Spender{Email: "dear@example.com"},
+		TotalSpend: 8, TotalAmount: 500}
+
+	testCases := []struct {
+		Name     string
+		Metric   RankingMetric
+		Expected MonthlySpenders
+	}{
+		{"Grams", RankByGrams, MonthlySpenders{heavy, dear}},
+		{"Amount", RankByAmount, MonthlySpenders{dear, heavy}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			spenders := MonthlySpenders{dear, heavy}
+			spenders.SortBy(tc.Metric)
+			assert.Equal(t, tc.Expected, spenders)
+		})
+	}
+
+	_, err := ParseRankingMetric("volume")
+	assert.NotNil(t, err, "expected error for unknown metric")
+}
+
+func TestMonthsLeavesReportUnchanged(t *testing.T) {
+	report := NewMonthlyTopSpendersAnalysisReport(2)
+	for _, month := range []ReportMonth{"Feb 2020", "Apr 2020", "Mar 2020"} {
+		assert.NoError(t, report.AddMonth(month, MonthlySpenders{}))
+	}
+
+	months := report.Months()
+	assert.Len(t, months, 2)
+	assert.Equal(t, ReportMonth("Apr 2020"), months[0].Month)
+	assert.Equal(t, ReportMonth("Mar 2020"), months[1].Month)
+	assert.Equal(t, OrderedReportMonths{"Feb 2020", "Apr 2020", "Mar 2020"}, report.months)
+}
+
+func TestCombineCurrencies(t *testing.T) {
+	tests := []struct {
+		a, b     string
+		expected string
+	}{
+		{a: "", b: "GBP", expected: "GBP"},
+		{a: "GBP", b: "", expected: "GBP"},
+		{a: "GBP", b: "GBP", expected: "GBP"},
+		{a: "GBP", b: "USD", expected: MixedCurrencies},
+		{a: MixedCurrencies, b: "GBP", expected: MixedCurrencies},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.expected, CombineCurrencies(tt.a, tt.b), "%q + %q", tt.a, tt.b)
+	}
+}
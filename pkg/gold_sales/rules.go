@@ -0,0 +1,284 @@
+package gold_sales
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// RuleSeverity of breaking a PaymentRule.
+type RuleSeverity string
+
+const (
+	// RuleWarn keeps the payment, only reporting the violation.
+	RuleWarn RuleSeverity = "warn"
+	// RuleReject leaves the payment out of the report.
+	RuleReject RuleSeverity = "reject"
+)
+
+// PaymentRule is a business rule every GoldPayment must satisfy.
+type PaymentRule interface {
+	// Check the payment, returning why it breaks the rule, or an empty
+	// string when it does not.
+	Check(payment GoldPayment) string
+}
+
+// BatchRule is a PaymentRule that sees every payment from a source before
+// any are checked, such as to find the reference a payment is checked
+// against.
+type BatchRule interface {
+	PaymentRule
+	Prepare(payments []GoldPayment)
+}
+
+// PaymentRuleFunc adapts a function to a PaymentRule.
+type PaymentRuleFunc func(payment GoldPayment) string
+
+func (prf PaymentRuleFunc) Check(payment GoldPayment) string {
+	return prf(payment)
+}
+
+// RuleConfig chooses a registered rule and how it applies.
+type RuleConfig struct {
+	Rule     string       `json:"rule"`
+	Severity RuleSeverity `json:"severity"`
+	// Limit of the rule: the fraction a rate may differ from the daily
+	// reference for rateBand, or the largest gram weight for maxGramWeight.
+	Limit float64 `json:"limit,omitempty"`
+	// From and To are the first and last days (YYYY-MM-DD) of the
+	// reportingWindow. Either can be left open.
+	From string `json:"from,omitempty"`
+	To   string `json:"to,omitempty"`
+}
+
+// RuleFactory builds a PaymentRule from its config.
+type RuleFactory func(config RuleConfig) (PaymentRule, error)
+
+// RuleViolation of a PaymentRule by a payment from a source.
+type RuleViolation struct {
+	Source    string       `json:"source"`
+	Rule      string       `json:"rule"`
+	Severity  RuleSeverity `json:"severity"`
+	PaymentID string       `json:"paymentId"`
+	Email     string       `json:"email"`
+	Date      time.Time    `json:"date"`
+	Message   string       `json:"message"`
+}
+
+// RuleRegistry of the rules available to configure, by name.
+type RuleRegistry struct {
+	factories map[string]RuleFactory
+}
+
+// NewRuleRegistry with the built in rules registered.
+func NewRuleRegistry() *RuleRegistry {
+	rr := &RuleRegistry{factories: make(map[string]RuleFactory)}
+	rr.factories["positiveAmount"] = newPositiveAmountRule
+	rr.factories["rateBand"] = newRateBandRule
+	rr.factories["maxGramWeight"] = newMaxGramWeightRule
+	rr.factories["reportingWindow"] = newReportingWindowRule
+	return rr
+}
+
+// Register a RuleFactory under the name, which must not already be in use.
+func (rr *RuleRegistry) Register(name string, factory RuleFactory) error {
+	if _, ok := rr.factories[name]; ok {
+		return errors.Errorf("rule %q already registered", name)
+	}
+	rr.factories[name] = factory
+	return nil
+}
+
+// Names of the registered rules in alphabetical order.
+func (rr *RuleRegistry) Names() []string {
+	names := make([]string, 0, len(rr.factories))
+	for name := range rr.factories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Build the RuleSet for the configs.
+func (rr *RuleRegistry) Build(configs []RuleConfig) (*RuleSet, error) {
+	rules := &RuleSet{rules: make([]configuredRule, 0, len(configs))}
+	for _, config := range configs {
+		factory, ok := rr.factories[config.Rule]
+		if !ok {
+			return nil, errors.Errorf("no rule registered named %q, have %v",
+				config.Rule, rr.Names())
+		}
+		if config.Severity != RuleWarn && config.Severity != RuleReject {
+			return nil, errors.Errorf("rule %q has unknown severity %q, use warn or reject",
+				config.Rule, config.Severity)
+		}
+		rule, err := factory(config)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid rule %q", config.Rule)
+		}
+		rules.rules = append(rules.rules, configuredRule{
+			name:     config.Rule,
+			severity: config.Severity,
+			rule:     rule,
+		})
+	}
+	return rules, nil
+}
+
+type configuredRule struct {
+	name     string
+	severity RuleSeverity
+	rule     PaymentRule
+}
+
+// RuleSet of the rules configured for a source.
+type RuleSet struct {
+	rules []configuredRule
+}
+
+// Empty when no rules are configured.
+func (rs *RuleSet) Empty() bool {
+	return rs == nil || len(rs.rules) == 0
+}
+
+// Apply the rules to the payments from the source, returning the payments
+// that were not rejected and every violation found, in payment order.
+func (rs *RuleSet) Apply(source string, payments []GoldPayment) ([]GoldPayment, []RuleViolation) {
+	violations := make([]RuleViolation, 0)
+	if rs.Empty() {
+		return payments, violations
+	}
+	for _, configured := range rs.rules {
+		if batch, ok := configured.rule.(BatchRule); ok {
+			batch.Prepare(payments)
+		}
+	}
+
+	kept := make([]GoldPayment, 0, len(payments))
+	for _, payment := range payments {
+		rejected := false
+		for _, configured := range rs.rules {
+			message := configured.rule.Check(payment)
+			if message == "" {
+				continue
+			}
+			violations = append(violations, RuleViolation{
+				Source:    source,
+				Rule:      configured.name,
+				Severity:  configured.severity,
+				PaymentID: payment.TransactionID(),
+				Email:     payment.Spender.Email,
+				Date:      payment.Date,
+				Message:   message,
+			})
+			rejected = rejected || configured.severity == RuleReject
+		}
+		if !rejected {
+			kept = append(kept, payment)
+		}
+	}
+	return kept, violations
+}
+
+// newPositiveAmountRule checks the amount is more than zero. Refunds are
+// checked by the size of their amount.
+func newPositiveAmountRule(_ RuleConfig) (PaymentRule, error) {
+	return PaymentRuleFunc(func(payment GoldPayment) string {
+		if payment.IsGoldRefund() && payment.Amount < 0 {
+			payment.Amount = -payment.Amount
+		}
+		if payment.Amount > 0 {
+			return ""
+		}
+		return fmt.Sprintf("amount %.2f is not more than zero", payment.Amount)
+	}), nil
+}
+
+// newMaxGramWeightRule checks the size of the gram weight is no more than
+// the limit.
+func newMaxGramWeightRule(config RuleConfig) (PaymentRule, error) {
+	if config.Limit <= 0 {
+		return nil, errors.New("limit must be more than zero")
+	}
+	return PaymentRuleFunc(func(payment GoldPayment) string {
+		if math.Abs(payment.GramWeight) <= config.Limit {
+			return ""
+		}
+		return fmt.Sprintf("gram weight %.2f is more than %.2f", payment.GramWeight, config.Limit)
+	}), nil
+}
+
+// newReportingWindowRule checks the payment was made within the window.
+func newReportingWindowRule(config RuleConfig) (PaymentRule, error) {
+	var from, to time.Time
+	var err error
+	if config.From != "" {
+		if from, err = time.Parse("2006-01-02", config.From); err != nil {
+			return nil, errors.Wrap(err, "invalid from day")
+		}
+	}
+	if config.To != "" {
+		if to, err = time.Parse("2006-01-02", config.To); err != nil {
+			return nil, errors.Wrap(err, "invalid to day")
+		}
+		to = to.AddDate(0, 0, 1)
+	}
+	if !from.IsZero() && !to.IsZero() && !from.Before(to) {
+		return nil, errors.New("from day is after the to day")
+	}
+	return PaymentRuleFunc(func(payment GoldPayment) string {
+		date := payment.Date.UTC()
+		if (!from.IsZero() && date.Before(from)) || (!to.IsZero() && !date.Before(to)) {
+			return "dated " + payment.Date.Format("02/01/2006 15:04") + ", outside the reporting window"
+		}
+		return ""
+	}), nil
+}
+
+// rateBandRule checks the rate of each payment is within a fraction of the
+// daily reference rate, the median rate of the payments from the source that
+// day.
+type rateBandRule struct {
+	limit     float64
+	reference map[string]float64
+}
+
+func newRateBandRule(config RuleConfig) (PaymentRule, error) {
+	if config.Limit <= 0 {
+		return nil, errors.New("limit must be more than zero")
+	}
+	return &rateBandRule{limit: config.Limit}, nil
+}
+
+func (rbr *rateBandRule) Prepare(payments []GoldPayment) {
+	rates := make(map[string][]float64)
+	for _, payment := range payments {
+		day := payment.Date.Format("2006-01-02")
+		rates[day] = append(rates[day], payment.Rate)
+	}
+	rbr.reference = make(map[string]float64, len(rates))
+	for day, dayRates := range rates {
+		sort.Float64s(dayRates)
+		middle := len(dayRates) / 2
+		if len(dayRates)%2 == 0 {
+			rbr.reference[day] = (dayRates[middle-1] + dayRates[middle]) / 2
+		} else {
+			rbr.reference[day] = dayRates[middle]
+		}
+	}
+}
+
+func (rbr *rateBandRule) Check(payment GoldPayment) string {
+	reference, ok := rbr.reference[payment.Date.Format("2006-01-02")]
+	if !ok || reference <= 0 {
+		return ""
+	}
+	if change := (payment.Rate - reference) / reference; math.Abs(change) > rbr.limit {
+		return fmt.Sprintf("rate %.4f is %+.1f%% from the daily reference %.4f",
+			payment.Rate, change*100, reference)
+	}
+	return ""
+}
@@ -0,0 +1,122 @@
+package gold_sales
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRuleSetApply(t *testing.T) {
+	spender := Spender{Email: "alayna.sparks@mailinator.com"}
+	march := time.Date(2020, 3, 22, 13, 28, 0, 0, time.UTC)
+	payment := func(description string, amount, rate float64, date time.Time) GoldPayment {
+		return GoldPayment{Spender: spender, Description: description, Amount: amount,
+			Rate: rate, ToCurrency: GoldCurrencyCode, Date: date, GramWeight: amount / rate}
+	}
+
+	testCases := []struct {
+		Name       string
+		Config     RuleConfig
+		Payments   []GoldPayment
+		Kept       int
+		Violations []int
+	}{
+		{
+			"Positive amount",
+			RuleConfig{Rule: "positiveAmount", Severity: RuleReject},
+			[]GoldPayment{payment(GoldSpend, 100, 50, march), payment(GoldSpend, 0, 50, march),
+				payment(GoldRefund, -100, 50, march)},
+			2,
+			[]int{1},
+		},
+		{
+			"Rate band of the daily median",
+			RuleConfig{Rule: "rateBand", Severity: RuleReject, Limit: 0.05},
+			[]GoldPayment{payment(GoldSpend, 100, 50, march), payment(GoldSpend, 100, 51, march),
+				payment(GoldSpend, 100, 49.5, march), payment(GoldSpend, 100, 60, march),
+				payment(GoldSpend, 100, 60, march.AddDate(0, 0, 1))},
+			4,
+			[]int{3},
+		},
+		{
+			"Maximum gram weight",
+			RuleConfig{Rule: "maxGramWeight", Severity: RuleWarn, Limit: 10},
+			[]GoldPayment{payment(GoldSpend, 500, 50, march), payment(GoldSpend, 550, 50, march),
+				payment(GoldRefund, -550, 50, march)},
+			3,
+			[]int{1, 2},
+		},
+		{
+			"Reporting window",
+			RuleConfig{Rule: "reportingWindow", Severity: RuleReject, From: "2020-03-01", To: "2020-03-22"},
+			[]GoldPayment{payment(GoldSpend, 100, 50, march),
+				payment(GoldSpend, 100, 50, march.AddDate(0, 0, 1)),
+				payment(GoldSpend, 100, 50, time.Date(2020, 2, 29, 23, 59, 0, 0, time.UTC))},
+			1,
+			[]int{1, 2},
+		},
+	}
+
+	registry := NewRuleRegistry()
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			rules, err := registry.Build([]RuleConfig{tc.Config})
+			require.Nil(t, err, "unexpected error")
+
+			kept, violations := rules.Apply("ledger.csv", tc.Payments)
+			assert.Len(t, kept, tc.Kept)
+			require.Len(t, violations, len(tc.Violations))
+			for i, violation := range violations {
+				broken := tc.Payments[tc.Violations[i]]
+				assert.Equal(t, broken.TransactionID(), violation.PaymentID)
+				assert.Equal(t, "ledger.csv", violation.Source)
+				assert.Equal(t, tc.Config.Rule, violation.Rule)
+				assert.Equal(t, tc.Config.Severity, violation.Severity)
+				assert.NotEmpty(t, violation.Message)
+			}
+		})
+	}
+}
+
+func TestRuleRegistryBuild(t *testing.T) {
+	testCases := []struct {
+		Name   string
+		Config RuleConfig
+	}{
+		{"Unknown rule", RuleConfig{Rule: "noSpendsOnSunday", Severity: RuleWarn}},
+		{"Unknown severity", RuleConfig{Rule: "positiveAmount", Severity: "block"}},
+		{"Rate band without a limit", RuleConfig{Rule: "rateBand", Severity: RuleWarn}},
+		{"Invalid window", RuleConfig{Rule: "reportingWindow", Severity: RuleWarn, From: "01/03/2020"}},
+		{"Window ends before it starts", RuleConfig{Rule: "reportingWindow", Severity: RuleWarn,
+			From: "2020-03-02", To: "2020-03-01"}},
+	}
+
+	registry := NewRuleRegistry()
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			_, err := registry.Build([]RuleConfig{tc.Config})
+			assert.NotNil(t, err, "expected error")
+		})
+	}
+
+	err := registry.Register("noSpendsOnSunday", func(_ RuleConfig) (PaymentRule, error) {
+		return PaymentRuleFunc(func(payment GoldPayment) string {
+			if payment.Date.Weekday() == time.Sunday {
+				return "spent on a Sunday"
+			}
+			return ""
+		}), nil
+	})
+	require.Nil(t, err, "unexpected error")
+	rules, err := registry.Build([]RuleConfig{{Rule: "noSpendsOnSunday", Severity: RuleReject}})
+	require.Nil(t, err, "unexpected error")
+	kept, violations := rules.Apply("ledger.csv", []GoldPayment{
+		{Date: time.Date(2020, 3, 22, 13, 28, 0, 0, time.UTC)},
+		{Date: time.Date(2020, 3, 23, 13, 28, 0, 0, time.UTC)},
+	})
+	assert.Len(t, kept, 1)
+	assert.Len(t, violations, 1)
+	assert.NotNil(t, registry.Register("rateBand", nil), "expected error for a name in use")
+}
@@ -0,0 +1,58 @@
+package managers
+
+import (
+	"time"
+
+	"github.com/JonPulfer/gold_sales/pkg/gold_sales/infrastructure/metrics"
+)
+
+// AnalysisMetrics recorded while performing an analysis. A nil
+// AnalysisMetrics records nothing.
+type AnalysisMetrics struct {
+	PaymentsAnalysed    *metrics.Counter
+	AggregationDuration *metrics.Histogram
+	SnapshotMonths      *metrics.Counter
+}
+
+// NewAnalysisMetrics registered in the Registry.
+func NewAnalysisMetrics(registry *metrics.Registry) *AnalysisMetrics {
+	return &AnalysisMetrics{
+		PaymentsAnalysed: registry.Counter(
+			"gold_sales_analysis_payments_total",
+			"Gold payments fed into an analysis, by analysis.",
+			"analysis"),
+		AggregationDuration: registry.Histogram(
+			"gold_sales_analysis_aggregation_duration_seconds",
+			"Time taken to aggregate and rank the payments.",
+			metrics.DefaultDurationBuckets),
+		SnapshotMonths: registry.Counter(
+			"gold_sales_analysis_snapshot_months_total",
+			"Months looked up in the aggregate snapshots, by hit or miss.",
+			"result"),
+	}
+}
+
+func (am *AnalysisMetrics) recordPayments(analysis string, count int) {
+	if am == nil {
+		return
+	}
+	am.PaymentsAnalysed.Add(float64(count), analysis)
+}
+
+func (am *AnalysisMetrics) recordAggregation(start time.Time) {
+	if am == nil {
+		return
+	}
+	am.AggregationDuration.ObserveSince(start)
+}
+
+func (am *AnalysisMetrics) recordSnapshot(hit bool) {
+	if am == nil {
+		return
+	}
+	if hit {
+		am.SnapshotMonths.Inc("hit")
+		return
+	}
+	am.SnapshotMonths.Inc("miss")
+}
@@ -1,27 +1,97 @@
 package managers
 
 import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
 	"sort"
+	"strconv"
+	"time"
 
 	"github.com/pkg/errors"
 
 	"github.com/JonPulfer/gold_sales/pkg/gold_sales"
+	"github.com/JonPulfer/gold_sales/pkg/gold_sales/infrastructure/filesystem"
+	"github.com/JonPulfer/gold_sales/pkg/gold_sales/infrastructure/metrics"
 	"github.com/JonPulfer/gold_sales/pkg/gold_sales/infrastructure/repository"
+	"github.com/JonPulfer/gold_sales/pkg/gold_sales/infrastructure/tracing"
 )
 
 // AnalysisService performs the high level operations that the business
 // requires.
 type AnalysisService struct {
 	repository repository.LedgerRepository
+	metrics    *AnalysisMetrics
+	ranking    gold_sales.RankingMetric
+	netting    gold_sales.RefundNetting
+	snapshots  AggregateSnapshots
+
+	incremental   repository.IncrementalLedger
+	runningTotals *RunningTotals
+}
+
+// AggregateSnapshots keep the per spender totals of months that have already
+// been aggregated, keyed by a checksum of the payments in the month, so that
+// unchanged months are not aggregated again. The months aggregated from the
+// latest inputs are also kept under the checksum of the inputs, so when the
+// inputs have not changed no month needs to be grouped or checksummed.
+type AggregateSnapshots interface {
+	Lookup(month gold_sales.ReportMonth, checksum string) (gold_sales.MonthlySpenders, bool)
+	Save(month gold_sales.ReportMonth, checksum string, totals gold_sales.MonthlySpenders)
+	LookupInput(checksum string) (map[gold_sales.ReportMonth]gold_sales.MonthlySpenders, bool)
+	SaveInput(checksum string, months []gold_sales.ReportMonth)
 }
 
 func NewAnalysisService(repository repository.LedgerRepository) *AnalysisService {
-	return &AnalysisService{repository: repository}
+	return &AnalysisService{
+		repository: repository,
+		ranking:    gold_sales.RankByGrams,
+		netting:    gold_sales.NetInRefundMonth,
+	}
+}
+
+// RankBy the metric when choosing the top spenders.
+func (ts *AnalysisService) RankBy(metric gold_sales.RankingMetric) {
+	ts.ranking = metric
+}
+
+// NetRefundsIn the month of the refund or of the spend it refunds.
+func (ts *AnalysisService) NetRefundsIn(netting gold_sales.RefundNetting) {
+	ts.netting = netting
+}
+
+// UseSnapshots of the monthly aggregates when producing reports.
+func (ts *AnalysisService) UseSnapshots(snapshots AggregateSnapshots) {
+	ts.snapshots = snapshots
+}
+
+// UseRunningTotals so reports only ingest the rows appended to the ledger
+// since the totals were last updated, adding them to the totals.
+func (ts *AnalysisService) UseRunningTotals(
+	ledger repository.IncrementalLedger,
+	totals *RunningTotals,
+) {
+	ts.incremental = ledger
+	ts.runningTotals = totals
+}
+
+// Instrument the service to record its analysis metrics in the Registry.
+func (ts *AnalysisService) Instrument(registry *metrics.Registry) {
+	ts.InstrumentWith(NewAnalysisMetrics(registry))
+}
+
+// InstrumentWith metrics shared with other services, as a metric can only be
+// registered once.
+func (ts *AnalysisService) InstrumentWith(analysisMetrics *AnalysisMetrics) {
+	ts.metrics = analysisMetrics
 }
 
 // TopSpenders is a report of the top 3 spenders each month for the last 6
 // months.
 func (ts AnalysisService) TopSpenders(
+	ctx context.Context,
 	numberSpenders int,
 	numberMonths int,
 ) (
@@ -29,25 +99,238 @@ func (ts AnalysisService) TopSpenders(
 	error,
 ) {
 
-	payments, err := ts.repository.FetchAll()
+	span, ctx := tracing.StartSpanFromContext(ctx, "AnalysisService.TopSpenders")
+	span.SetTag("numberSpenders", numberSpenders).
+		SetTag("numberMonths", numberMonths)
+	defer span.Finish()
+
+	var groupedSpends map[gold_sales.ReportMonth]gold_sales.MonthlySpenders
+	aggregationStart := time.Now()
+	if ts.runningTotals != nil {
+		if ts.netting == gold_sales.NetInOriginalMonth {
+			return nil, errors.New(
+				"refunds cannot be netted in the original month with running totals")
+		}
+		var err error
+		groupedSpends, err = ts.ingestIncrement(ctx)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to get payments from ledger")
+		}
+	} else {
+		payments, err := ts.repository.FetchAll(ctx)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to get payments from repository")
+		}
+		span.SetTag("payments", len(payments))
+
+		ts.metrics.recordPayments("top_spenders", len(payments))
+		aggregationStart = time.Now()
+		if ts.netting == gold_sales.NetInOriginalMonth {
+			payments = gold_sales.DateRefundsAsOriginals(payments)
+		}
+
+		if ts.snapshots != nil {
+			groupedSpends = ts.groupWithSnapshots(ctx, payments)
+		} else {
+			groupedSpends = groupTotalSpendsByMonth(ctx, payments)
+		}
+	}
+
+	rankSpan, _ := tracing.StartSpanFromContext(ctx, "monthlySpenders")
+	rankSpan.SetTag("months", len(groupedSpends))
+	monthlyTopSpenders, err := monthlySpenders(groupedSpends, numberSpenders, numberMonths,
+		ts.ranking)
+	rankSpan.Finish()
 	if err != nil {
-		return nil, errors.Wrap(err, "failed to get payments from repository")
+		return nil, err
+	}
+	ts.metrics.recordAggregation(aggregationStart)
+
+	monthlyTopSpenders.SetProvenance(ts.provenance(numberSpenders, numberMonths,
+		monthlyTopSpenders))
+
+	return monthlyTopSpenders, nil
+}
+
+// provenance of the report from the ledgers last fetched and the parameters.
+func (ts AnalysisService) provenance(
+	numberSpenders int,
+	numberMonths int,
+	report *gold_sales.MonthlyTopSpendersAnalysisReport,
+) *gold_sales.ReportProvenance {
+	provenance := &gold_sales.ReportProvenance{
+		Inputs: make([]gold_sales.InputProvenance, 0),
+		Parameters: gold_sales.ReportParameters{
+			NumTopSpenders: numberSpenders,
+			NumMonths:      numberMonths,
+			RankBy:         ts.ranking,
+			NetRefunds:     ts.netting,
+		},
+		ToolVersion: gold_sales.Version,
+		GeneratedAt: time.Now().UTC(),
+	}
+	if source, ok := ts.repository.(repository.LedgerSource); ok {
+		provenance.Inputs = append(provenance.Inputs, source.Sources()...)
+	}
+	if months := report.Months(); len(months) > 0 {
+		provenance.Parameters.AsOf = months[0].Month
+	}
+	return provenance
+}
+
+// OutputError is a failure to write the report to one of its targets.
+type OutputError struct {
+	Filename string
+	Err      error
+}
+
+func (oe OutputError) Error() string {
+	return "failed to write " + oe.Filename + ": " + oe.Err.Error()
+}
+
+// TopSpendersTo renders the TopSpenders report to every target from a single
+// read of the ledger. Each file is written atomically and listed in the
+// returned manifest with its checksum, along with any business rules the
+// payments broke.
+func (ts AnalysisService) TopSpendersTo(
+	ctx context.Context,
+	numberSpenders int,
+	numberMonths int,
+	renderers *gold_sales.RendererRegistry,
+	targets []gold_sales.OutputTarget,
+) (
+	*gold_sales.MonthlyTopSpendersAnalysisReport,
+	*gold_sales.ReportManifest,
+	error,
+) {
+
+	targetRenderers, err := lookupRenderers(renderers, targets)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	report, err := ts.TopSpenders(ctx, numberSpenders, numberMonths)
+	if err != nil {
+		return nil, nil, err
 	}
 
-	groupedSpends := groupTotalSpendsByMonth(payments)
+	manifest, err := renderTo(ctx, report, targetRenderers, targets)
+	if err != nil {
+		return nil, nil, err
+	}
+	if checker, ok := ts.repository.(repository.RuleChecker); ok {
+		manifest.RuleViolations = checker.Violations()
+	}
+	return report, manifest, nil
+}
 
-	monthlyTopSpenders, err := monthlySpenders(groupedSpends, numberSpenders, numberMonths)
+// RenderTo writes a report that has already been produced, such as one loaded
+// from a previous run, to every target in the same way as TopSpendersTo.
+func RenderTo(
+	ctx context.Context,
+	report *gold_sales.MonthlyTopSpendersAnalysisReport,
+	renderers *gold_sales.RendererRegistry,
+	targets []gold_sales.OutputTarget,
+) (*gold_sales.ReportManifest, error) {
+	targetRenderers, err := lookupRenderers(renderers, targets)
 	if err != nil {
 		return nil, err
 	}
+	return renderTo(ctx, report, targetRenderers, targets)
+}
 
-	return monthlyTopSpenders, nil
+func lookupRenderers(
+	renderers *gold_sales.RendererRegistry,
+	targets []gold_sales.OutputTarget,
+) ([]gold_sales.Renderer, error) {
+	targetRenderers := make([]gold_sales.Renderer, len(targets))
+	for i, target := range targets {
+		renderer, err := renderers.Lookup(target.Format)
+		if err != nil {
+			return nil, err
+		}
+		targetRenderers[i] = renderer
+	}
+	return targetRenderers, nil
+}
+
+// renderTo the targets with their renderers, writing each file atomically.
+func renderTo(
+	ctx context.Context,
+	report *gold_sales.MonthlyTopSpendersAnalysisReport,
+	targetRenderers []gold_sales.Renderer,
+	targets []gold_sales.OutputTarget,
+) (*gold_sales.ReportManifest, error) {
+	manifest := gold_sales.NewReportManifest()
+	manifest.Provenance = report.Provenance()
+	for i, target := range targets {
+		span, _ := tracing.StartSpanFromContext(ctx, "report.render")
+		span.SetTag("format", target.Format).SetTag("filename", target.Filename)
+
+		var rendered bytes.Buffer
+		if err := targetRenderers[i].Render(&rendered, report); err != nil {
+			span.Finish()
+			return nil, OutputError{Filename: target.Filename, Err: err}
+		}
+		contents := rendered.Bytes()
+		err := filesystem.WriteAtomically(target.Filename, func(w io.Writer) error {
+			_, err := w.Write(contents)
+			return err
+		})
+		span.SetTag("bytes", len(contents))
+		span.Finish()
+		if err != nil {
+			return nil, OutputError{Filename: target.Filename, Err: err}
+		}
+		manifest.AddFile(target, contents)
+	}
+
+	return manifest, nil
+}
+
+// Statements of the gold spends over the Period for every Spender who has
+// spent gold within it, ordered by the Spender email.
+func (ts AnalysisService) Statements(
+	ctx context.Context,
+	period gold_sales.Period,
+) (
+	[]*gold_sales.SpenderStatement,
+	error,
+) {
+
+	span, ctx := tracing.StartSpanFromContext(ctx, "AnalysisService.Statements")
+	span.SetTag("period", period.String())
+	defer span.Finish()
+
+	payments, err := ts.repository.FetchAll(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get payments from repository")
+	}
+	span.SetTag("payments", len(payments))
+
+	ts.metrics.recordPayments("statements", len(payments))
+
+	statements := make([]*gold_sales.SpenderStatement, 0)
+	for spender, spends := range groupSpendsBySpender(payments) {
+		statement := gold_sales.NewSpenderStatement(spender, period, spends)
+		if len(statement.Lines) == 0 {
+			continue
+		}
+		statements = append(statements, statement)
+	}
+	sort.Slice(statements, func(i, j int) bool {
+		return statements[i].Spender.Email < statements[j].Spender.Email
+	})
+	span.SetTag("statements", len(statements))
+
+	return statements, nil
 }
 
 func monthlySpenders(
 	groupedSpends map[gold_sales.ReportMonth]gold_sales.MonthlySpenders,
 	numberSpenders int,
 	numOfMonths int,
+	ranking gold_sales.RankingMetric,
 ) (
 	*gold_sales.MonthlyTopSpendersAnalysisReport,
 	error,
@@ -55,17 +338,23 @@ func monthlySpenders(
 
 	report := gold_sales.NewMonthlyTopSpendersAnalysisReport(numOfMonths)
 	for spendMonth, spenders := range groupedSpends {
-		sort.Sort(spenders)
+		spenders.SortBy(ranking)
 
 		topMonthSpenders := make(gold_sales.MonthlySpenders, 0)
-		for i := 0; i < numberSpenders && i < len(spenders); i++ {
-			topMonthSpenders = append(topMonthSpenders, spenders[i])
+		var monthTotal gold_sales.TotalSpend
+		for _, spender := range spenders {
+			// Spenders whose refunds cancel out their spends are not ranked.
+			if len(topMonthSpenders) < numberSpenders && spender.Ranked(ranking) > 0 {
+				topMonthSpenders = append(topMonthSpenders, spender)
+			}
+			monthTotal = monthTotal + spender.TotalSpend
 		}
 
 		err := report.AddMonth(spendMonth, topMonthSpenders)
 		if err != nil {
 			return gold_sales.NewMonthlyTopSpendersAnalysisReport(numOfMonths), err
 		}
+		report.SetMonthTotal(spendMonth, monthTotal)
 	}
 
 	return report, nil
@@ -74,21 +363,22 @@ func monthlySpenders(
 // groupTotalSpendsByMonth collates the payments into month spends for each
 // spender.
 func groupTotalSpendsByMonth(
+	ctx context.Context,
 	payments []gold_sales.GoldPayment,
 ) (
 	map[gold_sales.ReportMonth]gold_sales.MonthlySpenders,
 ) {
 
-	spendsBySpender := make(SpendsBySpender)
-	for _, payment := range payments {
-		if _, ok := spendsBySpender[payment.Spender]; !ok {
-			spendsBySpender[payment.Spender] = make([]gold_sales.GoldPayment, 0)
-		}
-		spendsBySpender[payment.Spender] = append(
-			spendsBySpender[payment.Spender], payment)
-	}
+	span, ctx := tracing.StartSpanFromContext(ctx, "groupTotalSpendsByMonth")
+	span.SetTag("payments", len(payments))
+	defer span.Finish()
 
+	spendsBySpender := groupSpendsBySpender(payments)
+	span.SetTag("spenders", len(spendsBySpender))
+
+	totalsSpan, _ := tracing.StartSpanFromContext(ctx, "spenderTotalsByMonth")
 	spenderTotalsByMonth := spenderTotalsByMonth(spendsBySpender)
+	totalsSpan.SetTag("months", len(spenderTotalsByMonth)).Finish()
 
 	monthlySpends := make(map[gold_sales.ReportMonth]gold_sales.MonthlySpenders)
 
@@ -102,9 +392,169 @@ func groupTotalSpendsByMonth(
 		}
 	}
 
+	span.SetTag("months", len(monthlySpends))
+
+	return monthlySpends
+}
+
+// ingestIncrement adds the payments appended since the watermark to the
+// running totals, starting again from the beginning of the ledger if it no
+// longer matches the watermark.
+func (ts AnalysisService) ingestIncrement(
+	ctx context.Context,
+) (map[gold_sales.ReportMonth]gold_sales.MonthlySpenders, error) {
+
+	span, ctx := tracing.StartSpanFromContext(ctx, "ingestIncrement")
+	defer span.Finish()
+
+	payments, watermark, err := ts.incremental.FetchSince(ctx, ts.runningTotals.Watermark)
+	if errors.Cause(err) == repository.ErrWatermarkInvalid {
+		span.SetTag("restarted", err.Error())
+		ts.runningTotals.Reset()
+		payments, watermark, err = ts.incremental.FetchSince(ctx, repository.Watermark{})
+	}
+	if err != nil {
+		return nil, err
+	}
+	span.SetTag("payments", len(payments))
+	ts.metrics.recordPayments("top_spenders", len(payments))
+
+	ts.runningTotals.Add(payments)
+	ts.runningTotals.Watermark = watermark
+	return ts.runningTotals.grouped(), nil
+}
+
+// groupWithSnapshots collates the payments into month spends for each spender
+// as groupTotalSpendsByMonth does. When the inputs have not changed since the
+// snapshots were saved every month is taken from them without grouping the
+// payments. Otherwise only the months whose payments have changed are
+// aggregated again.
+func (ts AnalysisService) groupWithSnapshots(
+	ctx context.Context,
+	payments []gold_sales.GoldPayment,
+) map[gold_sales.ReportMonth]gold_sales.MonthlySpenders {
+
+	span, ctx := tracing.StartSpanFromContext(ctx, "groupWithSnapshots")
+	defer span.Finish()
+
+	input := ts.inputChecksum()
+	if input != "" {
+		if monthlySpends, ok := ts.snapshots.LookupInput(input); ok {
+			for range monthlySpends {
+				ts.metrics.recordSnapshot(true)
+			}
+			span.SetTag("months", len(monthlySpends)).SetTag("snapshotHits", len(monthlySpends))
+			return monthlySpends
+		}
+	}
+
+	paymentsByMonth := make(map[gold_sales.ReportMonth][]gold_sales.GoldPayment)
+	for _, payment := range payments {
+		month := gold_sales.ParseReportMonth(payment.Date)
+		paymentsByMonth[month] = append(paymentsByMonth[month], payment)
+	}
+
+	monthlySpends := make(map[gold_sales.ReportMonth]gold_sales.MonthlySpenders)
+	hits := 0
+	for month, monthPayments := range paymentsByMonth {
+		checksum := paymentsChecksum(monthPayments)
+		if totals, ok := ts.snapshots.Lookup(month, checksum); ok {
+			monthlySpends[month] = totals
+			ts.metrics.recordSnapshot(true)
+			hits++
+			continue
+		}
+		totals := groupTotalSpendsByMonth(ctx, monthPayments)[month]
+		ts.snapshots.Save(month, checksum, totals)
+		ts.metrics.recordSnapshot(false)
+		monthlySpends[month] = totals
+	}
+	if input != "" {
+		months := make([]gold_sales.ReportMonth, 0, len(monthlySpends))
+		for month := range monthlySpends {
+			months = append(months, month)
+		}
+		ts.snapshots.SaveInput(input, months)
+	}
+	span.SetTag("months", len(monthlySpends)).SetTag("snapshotHits", hits)
+
 	return monthlySpends
 }
 
+// inputChecksum of the ledgers last fetched and the refund netting, which
+// moves refunds between months, or empty if the repository cannot describe
+// its ledgers.
+func (ts AnalysisService) inputChecksum() string {
+	source, ok := ts.repository.(repository.LedgerSource)
+	if !ok {
+		return ""
+	}
+	sources := source.Sources()
+	if len(sources) == 0 {
+		return ""
+	}
+	hash := sha256.New()
+	_, _ = io.WriteString(hash, string(ts.netting)+"\n")
+	for _, input := range sources {
+		_, _ = io.WriteString(hash, input.SHA256+"\n")
+	}
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// paymentsChecksum of the payments whatever order they were read in. Each
+// payment is written as a line of its fields, which is far cheaper than
+// encoding it as JSON.
+func paymentsChecksum(payments []gold_sales.GoldPayment) string {
+	lines := make([]string, 0, len(payments))
+	line := make([]byte, 0, 256)
+	for _, payment := range payments {
+		line = line[:0]
+		for _, field := range []string{
+			payment.Spender.FirstName,
+			payment.Spender.LastName,
+			payment.Spender.Email,
+			payment.Description,
+			payment.FromCurrency,
+			payment.ToCurrency,
+			payment.ID,
+			payment.Reference,
+			payment.OriginalReference,
+		} {
+			line = append(line, field...)
+			line = append(line, 0x1f)
+		}
+		line = strconv.AppendFloat(line, payment.Amount, 'g', -1, 64)
+		line = append(line, 0x1f)
+		line = strconv.AppendFloat(line, payment.Rate, 'g', -1, 64)
+		line = append(line, 0x1f)
+		line = strconv.AppendFloat(line, payment.GramWeight, 'g', -1, 64)
+		line = append(line, 0x1f)
+		line = strconv.AppendInt(line, payment.Date.UnixNano(), 10)
+		line = append(line, '\n')
+		lines = append(lines, string(line))
+	}
+	sort.Strings(lines)
+
+	hash := sha256.New()
+	for _, line := range lines {
+		_, _ = io.WriteString(hash, line)
+	}
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// groupSpendsBySpender indexes the payments by the Spender that made them.
+func groupSpendsBySpender(payments []gold_sales.GoldPayment) SpendsBySpender {
+	spendsBySpender := make(SpendsBySpender)
+	for _, payment := range payments {
+		if _, ok := spendsBySpender[payment.Spender]; !ok {
+			spendsBySpender[payment.Spender] = make([]gold_sales.GoldPayment, 0)
+		}
+		spendsBySpender[payment.Spender] = append(
+			spendsBySpender[payment.Spender], payment)
+	}
+	return spendsBySpender
+}
+
 // spenderTotalsByMonth collates the monthly spends for each Spender and builds
 // Map keyed by ReportMonth to provide easy access to the monthly data.
 func spenderTotalsByMonth(
@@ -125,12 +575,18 @@ func spenderTotalsByMonth(
 
 		for spendMonth, monthSpends := range monthlySpends {
 			var totalWeight float64
+			var totalAmount float64
+			currency := ""
 			for _, spend := range monthSpends {
 				totalWeight = totalWeight + spend.GramWeight
+				totalAmount = totalAmount + spend.Amount
+				currency = gold_sales.CombineCurrencies(currency, spend.FromCurrency)
 			}
 			monthlySpend := gold_sales.MonthlySpend{
-				Spender:    spender,
-				TotalSpend: gold_sales.TotalSpend(totalWeight),
+				Spender:     spender,
+				TotalSpend:  gold_sales.TotalSpend(totalWeight),
+				TotalAmount: totalAmount,
+				Currency:    currency,
 			}
 			spenderTotalsByMonth.Insert(spendMonth, monthlySpend)
 		}
@@ -2,9 +2,17 @@ package managers
 
 import (
 	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
 	"testing"
 	"time"
 
+	"github.com/pkg/errors"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
@@ -36,7 +44,7 @@ func TestSpenderTotalsByMonth(t *testing.T) {
 
 	for _, tc := range testCases {
 		t.Run(tc.Name, func(t *testing.T) {
-			payments, err := tc.Analysis.repository.FetchAll()
+			payments, err := tc.Analysis.repository.FetchAll(context.Background())
 			if err != nil {
 				t.Logf("problem with mock AnalysisService in test: %s", err.Error())
 				t.FailNow()
@@ -80,13 +88,13 @@ func compareResultWithExpected(t *testing.T, result, expected SpenderTotalsByRep
 
 func TestReportProducesExpectedCSV(t *testing.T) {
 	analysis := analysisServiceForTests(multipleSpendersInTwoMonths())
-	report, err := analysis.TopSpenders(3, 6)
+	report, err := analysis.TopSpenders(context.Background(), 3, 6)
 	require.Nil(t, err, "unexpected error")
 	expectedLines := []string{
-		"Jul 2020,Spe,nd,5.10,",
-		"Jul 2020,Another,Spender,0.90,",
-		"Jun 2020,Spe,nd,55.00,",
-		"Jun 2020,Another,Spender,0.30,",
+		"Jul 2020,Spe,nd,5.10",
+		"Jul 2020,Another,Spender,0.90",
+		"Jun 2020,Spe,nd,55.00",
+		"Jun 2020,Another,Spender,0.30",
 	}
 	output := report.FormattedAsCSV()
 	scanOutput := bufio.NewScanner(output)
@@ -98,6 +106,391 @@ func TestReportProducesExpectedCSV(t *testing.T) {
 	}
 }
 
+func TestTopSpendersToWritesEveryTarget(t *testing.T) {
+	dir, err := ioutil.TempDir("", "outputs")
+	require.Nil(t, err)
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	analysis := analysisServiceForTests(multipleSpendersInTwoMonths())
+	targets := []gold_sales.OutputTarget{
+		{Format: "csv", Filename: filepath.Join(dir, "report.csv")},
+		{Format: "json", Filename: filepath.Join(dir, "report.json")},
+	}
+	_, manifest, err := analysis.TopSpendersTo(context.Background(), 3, 6,
+		gold_sales.NewRendererRegistry(), targets)
+	require.Nil(t, err, "unexpected error")
+
+	require.NotNil(t, manifest.Provenance, "expected the report provenance")
+	assert.Equal(t, gold_sales.ReportParameters{NumTopSpenders: 3, NumMonths: 6,
+		RankBy: gold_sales.RankByGrams, NetRefunds: gold_sales.NetInRefundMonth,
+		AsOf: secondSpendMonth()},
+		manifest.Provenance.Parameters)
+	assert.Equal(t, gold_sales.Version, manifest.Provenance.ToolVersion)
+
+	require.Len(t, manifest.Files, 2)
+	for i, file := range manifest.Files {
+		contents, err := ioutil.ReadFile(targets[i].Filename)
+		require.Nil(t, err, "expected output to be written")
+		checksum := sha256.Sum256(contents)
+		assert.Equal(t, targets[i].Format, file.Format)
+		assert.Equal(t, int64(len(contents)), file.Bytes)
+		assert.Equal(t, hex.EncodeToString(checksum[:]), file.SHA256)
+	}
+
+	_, _, err = analysis.TopSpendersTo(context.Background(), 3, 6,
+		gold_sales.NewRendererRegistry(),
+		[]gold_sales.OutputTarget{{Format: "csv", Filename: filepath.Join(dir, "missing", "report.csv")}})
+	_, ok := err.(OutputError)
+	assert.True(t, ok, "expected an OutputError, got %v", err)
+}
+
+// mapSnapshots keeps snapshots in memory for tests.
+type mapSnapshots struct {
+	months map[string]gold_sales.MonthlySpenders
+	input  string
+	inputs map[gold_sales.ReportMonth]string
+}
+
+func newMapSnapshots() *mapSnapshots {
+	return &mapSnapshots{
+		months: make(map[string]gold_sales.MonthlySpenders),
+		inputs: make(map[gold_sales.ReportMonth]string),
+	}
+}
+
+func (ms *mapSnapshots) Lookup(month gold_sales.ReportMonth, checksum string) (gold_sales.MonthlySpenders, bool) {
+	totals, ok := ms.months[string(month)+checksum]
+	return totals, ok
+}
+
+func (ms *mapSnapshots) Save(month gold_sales.ReportMonth, checksum string, totals gold_sales.MonthlySpenders) {
+	ms.months[string(month)+checksum] = totals
+	ms.inputs[month] = string(month) + checksum
+}
+
+func (ms *mapSnapshots) LookupInput(checksum string) (map[gold_sales.ReportMonth]gold_sales.MonthlySpenders, bool) {
+	if ms.input == "" || ms.input != checksum {
+		return nil, false
+	}
+	months := make(map[gold_sales.ReportMonth]gold_sales.MonthlySpenders)
+	for month, key := range ms.inputs {
+		months[month] = ms.months[key]
+	}
+	return months, true
+}
+
+func (ms *mapSnapshots) SaveInput(checksum string, months []gold_sales.ReportMonth) {
+	inputs := make(map[gold_sales.ReportMonth]string)
+	for _, month := range months {
+		inputs[month] = ms.inputs[month]
+	}
+	ms.input = checksum
+	ms.inputs = inputs
+}
+
+// sourcedLedgerRepository describes its payments as coming from a ledger with
+// a checksum, as the file repositories do, counting the fetches.
+type sourcedLedgerRepository struct {
+	payments []gold_sales.GoldPayment
+	checksum string
+	fetches  int
+}
+
+func (slr *sourcedLedgerRepository) FetchAll(_ context.Context) ([]gold_sales.GoldPayment, error) {
+	slr.fetches++
+	payments := make([]gold_sales.GoldPayment, len(slr.payments))
+	copy(payments, slr.payments)
+	return payments, nil
+}
+
+func (slr *sourcedLedgerRepository) Sources() []gold_sales.InputProvenance {
+	return []gold_sales.InputProvenance{{Filename: "ledger.csv", SHA256: slr.checksum}}
+}
+
+func TestTopSpendersWithSnapshots(t *testing.T) {
+	analysis := analysisServiceForTests(multipleSpendersInTwoMonths())
+	expected, err := analysis.TopSpenders(context.Background(), 3, 6)
+	require.Nil(t, err, "unexpected error")
+
+	snapshots := newMapSnapshots()
+	analysis.UseSnapshots(snapshots)
+	first, err := analysis.TopSpenders(context.Background(), 3, 6)
+	require.Nil(t, err, "unexpected error")
+	assert.Equal(t, expected.Months(), first.Months())
+	assert.Len(t, snapshots.months, 2, "a snapshot for each month")
+	assert.Empty(t, snapshots.input, "the mock ledger has no checksum")
+
+	for key := range snapshots.months {
+		snapshots.months[key] = gold_sales.MonthlySpenders{{
+			Spender: spenderOneBuilder(), TotalSpend: 1000}}
+	}
+	second, err := analysis.TopSpenders(context.Background(), 3, 6)
+	require.Nil(t, err, "unexpected error")
+	for _, month := range second.Months() {
+		assert.Equal(t, gold_sales.TotalSpend(1000), month.Spenders[0].TotalSpend,
+			"unchanged months should come from the snapshots")
+	}
+}
+
+func TestTopSpendersWithSnapshotsOfUnchangedInputs(t *testing.T) {
+	payments, err := repository.NewMockLedgerRepository(multipleSpendersInTwoMonths()).
+		FetchAll(context.Background())
+	require.Nil(t, err)
+	ledger := &sourcedLedgerRepository{payments: payments, checksum: "abc"}
+	analysis := NewAnalysisService(ledger)
+	snapshots := newMapSnapshots()
+	analysis.UseSnapshots(snapshots)
+
+	expected, err := analysis.TopSpenders(context.Background(), 3, 6)
+	require.Nil(t, err)
+	require.NotEmpty(t, snapshots.input, "the months should be kept for the inputs")
+
+	// Clearing the month snapshots shows the inputs' months were used
+	// without checksumming the payments of each month.
+	for key := range snapshots.months {
+		snapshots.months[key] = gold_sales.MonthlySpenders{{
+			Spender: spenderOneBuilder(), TotalSpend: 1000}}
+	}
+	unchanged, err := analysis.TopSpenders(context.Background(), 3, 6)
+	require.Nil(t, err)
+	for _, month := range unchanged.Months() {
+		assert.Equal(t, gold_sales.TotalSpend(1000), month.Spenders[0].TotalSpend)
+	}
+
+	ledger.checksum = "changed"
+	ledger.payments = ledger.payments[:len(ledger.payments)-1]
+	changed, err := analysis.TopSpenders(context.Background(), 3, 6)
+	require.Nil(t, err)
+	assert.NotEqual(t, expected.Months(), changed.Months(),
+		"a changed ledger must be aggregated again")
+	assert.Equal(t, 3, ledger.fetches)
+}
+
+// BenchmarkTopSpendersWithSnapshots of a ledger of a year of payments, comparing
+// a report aggregated from scratch with warm runs whose inputs have and have
+// not changed since the snapshots were saved.
+func BenchmarkTopSpendersWithSnapshots(b *testing.B) {
+	start := time.Date(2020, time.January, 1, 0, 0, 0, 0, time.UTC)
+	payments := make([]gold_sales.GoldPayment, 0, 12*100*20)
+	for month := 0; month < 12; month++ {
+		for spender := 0; spender < 100; spender++ {
+			for i := 0; i < 20; i++ {
+				payments = append(payments, gold_sales.GoldPayment{
+					Spender: gold_sales.Spender{
+						FirstName: "Spender",
+						LastName:  strconv.Itoa(spender),
+						Email:     strconv.Itoa(spender) + "@mock.com",
+					},
+					Description:  gold_sales.GoldSpend,
+					Amount:       float64(i + 1),
+					Rate:         40,
+					FromCurrency: "GBP",
+					ToCurrency:   gold_sales.GoldCurrencyCode,
+					Date:         start.AddDate(0, month, i),
+					GramWeight:   float64(i+1) / 40,
+				})
+			}
+		}
+	}
+
+	benchmarks := []struct {
+		name      string
+		snapshots bool
+		checksums []string
+	}{
+		{name: "no snapshots", checksums: []string{"abc"}},
+		{name: "changed inputs", snapshots: true, checksums: []string{"abc", "def"}},
+		{name: "unchanged inputs", snapshots: true, checksums: []string{"abc"}},
+	}
+	for _, bm := range benchmarks {
+		b.Run(bm.name, func(b *testing.B) {
+			ledger := &sourcedLedgerRepository{payments: payments}
+			analysis := NewAnalysisService(ledger)
+			if bm.snapshots {
+				analysis.UseSnapshots(newMapSnapshots())
+				ledger.checksum = "warm"
+				_, err := analysis.TopSpenders(context.Background(), 5, 12)
+				require.Nil(b, err)
+			}
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				ledger.checksum = bm.checksums[i%len(bm.checksums)]
+				_, err := analysis.TopSpenders(context.Background(), 5, 12)
+				require.Nil(b, err)
+			}
+		})
+	}
+}
+
+// stubIncrementalLedger returns a batch of payments per fetch, failing the
+// watermark once when asked to.
+type stubIncrementalLedger struct {
+	batches     [][]gold_sales.GoldPayment
+	invalidOnce bool
+}
+
+func (sil *stubIncrementalLedger) FetchSince(
+	_ context.Context,
+	since repository.Watermark,
+) ([]gold_sales.GoldPayment, repository.Watermark, error) {
+	if sil.invalidOnce && !since.IsZero() {
+		sil.invalidOnce = false
+		return nil, since, errors.Wrap(repository.ErrWatermarkInvalid, "rewritten")
+	}
+	batch := int(since.Offset)
+	if batch >= len(sil.batches) {
+		return nil, since, nil
+	}
+	return sil.batches[batch], repository.Watermark{Offset: since.Offset + 1}, nil
+}
+
+func TestTopSpendersWithRunningTotals(t *testing.T) {
+	payments, err := repository.NewMockLedgerRepository(multipleSpendersInTwoMonths()).
+		FetchAll(context.Background())
+	require.Nil(t, err)
+	expected, err := analysisServiceForTests(multipleSpendersInTwoMonths()).
+		TopSpenders(context.Background(), 3, 6)
+	require.Nil(t, err)
+
+	half := len(payments) / 2
+	ledger := &stubIncrementalLedger{batches: [][]gold_sales.GoldPayment{
+		payments[:half], payments[half:]}}
+	totals := NewRunningTotals()
+	analysis := NewAnalysisService(nil)
+	analysis.UseRunningTotals(ledger, totals)
+
+	_, err = analysis.TopSpenders(context.Background(), 3, 6)
+	require.Nil(t, err, "unexpected error")
+	report, err := analysis.TopSpenders(context.Background(), 3, 6)
+	require.Nil(t, err, "unexpected error")
+	assertSameMonths(t, expected.Months(), report.Months())
+	assert.False(t, totals.Restarted)
+
+	ledger.invalidOnce = true
+	report, err = analysis.TopSpenders(context.Background(), 3, 6)
+	require.Nil(t, err, "unexpected error")
+	assert.True(t, totals.Restarted)
+	assert.Equal(t, int64(1), totals.Watermark.Offset,
+		"only the first batch is read again after a restart")
+	assert.Len(t, report.Months(), len(groupTotalSpendsByMonth(context.Background(),
+		payments[:half])))
+}
+
+// assertSameMonths allowing for rounding from summing in a different order.
+func assertSameMonths(t *testing.T, expected, actual []gold_sales.MonthTopSpenders) {
+	require.Len(t, actual, len(expected))
+	for i := range expected {
+		assert.Equal(t, expected[i].Month, actual[i].Month)
+		assert.InDelta(t, float64(expected[i].MonthTotal), float64(actual[i].MonthTotal), 0.0001)
+		require.Len(t, actual[i].Spenders, len(expected[i].Spenders))
+		for j := range expected[i].Spenders {
+			assert.Equal(t, expected[i].Spenders[j].Spender, actual[i].Spenders[j].Spender)
+			assert.InDelta(t, float64(expected[i].Spenders[j].TotalSpend),
+				float64(actual[i].Spenders[j].TotalSpend), 0.0001)
+		}
+	}
+}
+
+func TestTopSpendersNetsRefunds(t *testing.T) {
+	june, err := time.Parse("Jan 2006", string(firstSpendMonth()))
+	require.Nil(t, err)
+	july := june.AddDate(0, 1, 2)
+
+	spenderOne := spenderOneBuilder()
+	spenderTwo := spenderTwoBuilder()
+	mockLedger := repository.MockLedger{
+		spenderOne: {
+			{Spender: spenderOne, Description: gold_sales.GoldSpend, Amount: 3000,
+				ToCurrency: gold_sales.GoldCurrencyCode, Date: june, GramWeight: 60},
+			// Refunds are read with a negative amount and weight.
+			{Spender: spenderOne, Description: gold_sales.GoldRefund, Amount: -3000,
+				ToCurrency: gold_sales.GoldCurrencyCode, Date: july, GramWeight: -60},
+		},
+		spenderTwo: {
+			{Spender: spenderTwo, Description: gold_sales.GoldSpend, Amount: 100,
+				ToCurrency: gold_sales.GoldCurrencyCode, Date: june, GramWeight: 2},
+			{Spender: spenderTwo, Description: gold_sales.GoldSpend, Amount: 50,
+				ToCurrency: gold_sales.GoldCurrencyCode, Date: july, GramWeight: 1},
+		},
+	}
+
+	testCases := []struct {
+		Name     string
+		Netting  gold_sales.RefundNetting
+		Expected map[gold_sales.ReportMonth][]gold_sales.Spender
+		Totals   map[gold_sales.ReportMonth]gold_sales.TotalSpend
+	}{
+		{
+			"Refund month",
+			gold_sales.NetInRefundMonth,
+			map[gold_sales.ReportMonth][]gold_sales.Spender{
+				firstSpendMonth():  {spenderOne, spenderTwo},
+				secondSpendMonth(): {spenderTwo},
+			},
+			map[gold_sales.ReportMonth]gold_sales.TotalSpend{
+				firstSpendMonth():  62,
+				secondSpendMonth(): -59,
+			},
+		},
+		{
+			"Original month",
+			gold_sales.NetInOriginalMonth,
+			map[gold_sales.ReportMonth][]gold_sales.Spender{
+				firstSpendMonth():  {spenderTwo},
+				secondSpendMonth(): {spenderTwo},
+			},
+			map[gold_sales.ReportMonth]gold_sales.TotalSpend{
+				firstSpendMonth():  2,
+				secondSpendMonth(): 1,
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			analysis := analysisServiceForTests(mockLedger)
+			analysis.NetRefundsIn(tc.Netting)
+			report, err := analysis.TopSpenders(context.Background(), 3, 6)
+			require.Nil(t, err, "unexpected error")
+
+			months := report.Months()
+			require.Len(t, months, len(tc.Expected))
+			for _, month := range months {
+				spenders := make([]gold_sales.Spender, len(month.Spenders))
+				for i, spend := range month.Spenders {
+					spenders[i] = spend.Spender
+				}
+				assert.Equal(t, tc.Expected[month.Month], spenders, string(month.Month))
+				assert.InDelta(t, float64(tc.Totals[month.Month]), float64(month.MonthTotal),
+					0.0001, string(month.Month))
+			}
+			assert.Equal(t, tc.Netting, report.Provenance().Parameters.NetRefunds)
+		})
+	}
+}
+
+func TestStatementsForPeriod(t *testing.T) {
+	analysis := analysisServiceForTests(multipleSpendersInTwoMonths())
+	secondSpendMonthRaw, err := time.Parse("Jan 2006", string(secondSpendMonth()))
+	require.Nil(t, err)
+
+	statements, err := analysis.Statements(context.Background(), gold_sales.Period{
+		From: secondSpendMonthRaw,
+		To:   secondSpendMonthRaw.AddDate(0, 1, 0),
+	})
+	require.Nil(t, err, "unexpected error")
+	require.Len(t, statements, 2)
+
+	statement := statements[1]
+	assert.Equal(t, spenderOneBuilder(), statement.Spender)
+	assert.InDelta(t, 55.0, statement.OpeningSpend, 0.0001)
+	assert.InDelta(t, 60.1, statement.ClosingSpend, 0.0001)
+	assert.Len(t, statement.Lines, 2)
+	require.Len(t, statement.MonthlySubtotals, 1)
+	assert.Equal(t, secondSpendMonth(), statement.MonthlySubtotals[0].Month)
+	assert.InDelta(t, 102.0, statement.MonthlySubtotals[0].Amount, 0.0001)
+}
+
 func analysisServiceForTests(mockLedger repository.MockLedger) *AnalysisService {
 	mockRepos := repository.NewMockLedgerRepository(mockLedger)
 
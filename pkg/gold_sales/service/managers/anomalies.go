@@ -0,0 +1,267 @@
+package managers
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/JonPulfer/gold_sales/pkg/gold_sales"
+	"github.com/JonPulfer/gold_sales/pkg/gold_sales/infrastructure/tracing"
+)
+
+// madScale turns a median absolute deviation into an estimate of the
+// standard deviation of normally distributed spend.
+const madScale = 1.4826
+
+// minScaleOfMedian is the smallest scale of deviation used, as a fraction of
+// the median, so customers with very steady spend are not flagged for small
+// changes.
+const minScaleOfMedian = 0.05
+
+// Anomalies in the spending of every customer: months far from their own
+// trailing months, spends far above their typical spend and bursts of spends
+// within a short window. The alerts are ordered by date, then customer.
+func (ts AnalysisService) Anomalies(
+	ctx context.Context,
+	options gold_sales.AnomalyOptions,
+) (*gold_sales.AlertsReport, error) {
+	span, ctx := tracing.StartSpanFromContext(ctx, "AnalysisService.Anomalies")
+	defer span.Finish()
+
+	payments, err := ts.repository.FetchAll(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get payments from repository")
+	}
+	span.SetTag("payments", len(payments))
+	ts.metrics.recordPayments("anomalies", len(payments))
+
+	spendsBySpender := groupSpendsBySpender(payments)
+	alerts := monthlySpendAlerts(spenderTotalsByMonth(spendsBySpender), options)
+	for _, spends := range spendsBySpender {
+		alerts = append(alerts, largeSpendAlerts(spends, options)...)
+		alerts = append(alerts, burstAlerts(spends, options)...)
+	}
+	sort.SliceStable(alerts, func(i, j int) bool {
+		if !alerts[i].Date.Equal(alerts[j].Date) {
+			return alerts[i].Date.Before(alerts[j].Date)
+		}
+		if alerts[i].Spender.Email != alerts[j].Spender.Email {
+			return alerts[i].Spender.Email < alerts[j].Spender.Email
+		}
+		return alerts[i].Kind < alerts[j].Kind
+	})
+	span.SetTag("alerts", len(alerts))
+
+	return &gold_sales.AlertsReport{
+		GeneratedAt: time.Now().UTC(),
+		Options:     options,
+		Alerts:      alerts,
+	}, nil
+}
+
+// monthlySpendAlerts for the months of each customer whose total is further
+// from the median of their trailing months than the options allow. Every
+// month from the customer's first month to the last month of the ledger is
+// checked, with the months they spent nothing in counting as zero, so a
+// customer who stops spending is flagged too.
+func monthlySpendAlerts(
+	totals SpenderTotalsByReportMonth,
+	options gold_sales.AnomalyOptions,
+) []gold_sales.Alert {
+	bySpender := make(map[gold_sales.Spender]map[time.Time]float64)
+	var last time.Time
+	for month, spenders := range totals {
+		start, err := time.Parse("Jan 2006", string(month))
+		if err != nil {
+			continue
+		}
+		if start.After(last) {
+			last = start
+		}
+		for spender, spend := range spenders {
+			if bySpender[spender] == nil {
+				bySpender[spender] = make(map[time.Time]float64)
+			}
+			bySpender[spender][start] = spend.Ranked(options.Metric)
+		}
+	}
+
+	alerts := make([]gold_sales.Alert, 0)
+	for spender, months := range bySpender {
+		var first time.Time
+		for start := range months {
+			if first.IsZero() || start.Before(first) {
+				first = start
+			}
+		}
+		for start := first; !start.After(last); start = start.AddDate(0, 1, 0) {
+			value := months[start]
+			history := make([]float64, 0, options.TrailingMonths)
+			for i := 1; i <= options.TrailingMonths; i++ {
+				previous := start.AddDate(0, -i, 0)
+				if previous.Before(first) {
+					break
+				}
+				history = append(history, months[previous])
+			}
+			if len(history) == 0 || len(history) < options.MinHistoryMonths {
+				continue
+			}
+
+			baseline := median(history)
+			scale := madScale * medianAbsoluteDeviation(history, baseline)
+			if floor := minScaleOfMedian * math.Abs(baseline); scale < floor {
+				scale = floor
+			}
+			if scale == 0 {
+				continue
+			}
+			score := (value - baseline) / scale
+			if math.Abs(score) <= options.MaxScore {
+				continue
+			}
+			direction := "above"
+			if score < 0 {
+				direction = "below"
+			}
+			alerts = append(alerts, gold_sales.Alert{
+				Kind:     gold_sales.AlertMonthlySpend,
+				Spender:  spender,
+				Month:    gold_sales.ParseReportMonth(start),
+				Date:     start,
+				Value:    value,
+				Baseline: baseline,
+				Score:    score,
+				Reason: fmt.Sprintf("month total %.2f is %.1f deviations %s the median %.2f of the %d months before",
+					value, math.Abs(score), direction, baseline, len(history)),
+			})
+		}
+	}
+	return alerts
+}
+
+// largeSpendAlerts for the customer's spends larger than the options allow
+// compared with the median of their other spends. Refunds are not flagged.
+func largeSpendAlerts(
+	spends []gold_sales.GoldPayment,
+	options gold_sales.AnomalyOptions,
+) []gold_sales.Alert {
+	alerts := make([]gold_sales.Alert, 0)
+	positive := make([]gold_sales.GoldPayment, 0, len(spends))
+	for _, spend := range spends {
+		if spend.Value(options.Metric) > 0 {
+			positive = append(positive, spend)
+		}
+	}
+	if len(positive)-1 < options.MinSpends {
+		return alerts
+	}
+	values := make([]float64, len(positive))
+	for i, spend := range positive {
+		values[i] = spend.Value(options.Metric)
+	}
+
+	others := make([]float64, 0, len(values)-1)
+	for i, spend := range positive {
+		others = append(others[:0], values[:i]...)
+		others = append(others, values[i+1:]...)
+		typical := median(others)
+		if values[i] <= options.LargeSpendFactor*typical {
+			continue
+		}
+		alerts = append(alerts, gold_sales.Alert{
+			Kind:       gold_sales.AlertLargeSpend,
+			Spender:    spend.Spender,
+			Month:      gold_sales.ParseReportMonth(spend.Date),
+			Date:       spend.Date,
+			PaymentIDs: []string{spend.TransactionID()},
+			Value:      values[i],
+			Baseline:   typical,
+			Reason: fmt.Sprintf("spend %.2f is %.1f times the median %.2f of their other %d spends",
+				values[i], values[i]/typical, typical, len(others)),
+		})
+	}
+	return alerts
+}
+
+// burstAlerts for each run of at least the options' burst of spends by the
+// customer within the burst window. Refunds and spends of nothing in the
+// metric are not counted.
+func burstAlerts(
+	spends []gold_sales.GoldPayment,
+	options gold_sales.AnomalyOptions,
+) []gold_sales.Alert {
+	alerts := make([]gold_sales.Alert, 0)
+	if options.BurstSpends < 2 {
+		return alerts
+	}
+	ordered := make([]gold_sales.GoldPayment, 0, len(spends))
+	for _, spend := range spends {
+		if spend.Value(options.Metric) > 0 {
+			ordered = append(ordered, spend)
+		}
+	}
+	sort.SliceStable(ordered, func(i, j int) bool {
+		return ordered[i].Date.Before(ordered[j].Date)
+	})
+
+	for start := 0; start < len(ordered); {
+		end := start
+		for end+1 < len(ordered) &&
+			ordered[end+1].Date.Sub(ordered[start].Date) <= options.BurstWindow {
+			end++
+		}
+		if end-start+1 < options.BurstSpends {
+			start++
+			continue
+		}
+
+		burst := ordered[start : end+1]
+		ids := make([]string, len(burst))
+		var total float64
+		for i, spend := range burst {
+			ids[i] = spend.TransactionID()
+			total += spend.Value(options.Metric)
+		}
+		alerts = append(alerts, gold_sales.Alert{
+			Kind:       gold_sales.AlertBurst,
+			Spender:    burst[0].Spender,
+			Month:      gold_sales.ParseReportMonth(burst[0].Date),
+			Date:       burst[0].Date,
+			PaymentIDs: ids,
+			Value:      total,
+			Reason: fmt.Sprintf("%d spends totalling %.2f within %s",
+				len(burst), total, burst[len(burst)-1].Date.Sub(burst[0].Date)),
+		})
+		start = end + 1
+	}
+	return alerts
+}
+
+// median of the values, which are left unchanged.
+func median(values []float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+	sorted := make([]float64, len(values))
+	copy(sorted, values)
+	sort.Float64s(sorted)
+	middle := len(sorted) / 2
+	if len(sorted)%2 == 0 {
+		return (sorted[middle-1] + sorted[middle]) / 2
+	}
+	return sorted[middle]
+}
+
+// medianAbsoluteDeviation of the values from their median.
+func medianAbsoluteDeviation(values []float64, center float64) float64 {
+	deviations := make([]float64, len(values))
+	for i, value := range values {
+		deviations[i] = math.Abs(value - center)
+	}
+	return median(deviations)
+}
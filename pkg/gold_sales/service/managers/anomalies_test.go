@@ -0,0 +1,147 @@
+package managers
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/JonPulfer/gold_sales/pkg/gold_sales"
+	"github.com/JonPulfer/gold_sales/pkg/gold_sales/infrastructure/repository"
+)
+
+func TestAnomalies(t *testing.T) {
+	analysis := analysisServiceForTests(unusualSpending())
+
+	report, err := analysis.Anomalies(context.Background(), gold_sales.DefaultAnomalyOptions())
+	require.NoError(t, err)
+	require.Len(t, report.Alerts, 3)
+
+	burst := report.Alerts[0]
+	assert.Equal(t, gold_sales.AlertBurst, burst.Kind)
+	assert.Equal(t, spenderTwoBuilder(), burst.Spender)
+	assert.Len(t, burst.PaymentIDs, 3)
+	assert.InDelta(t, 3.0, burst.Value, 0.0001)
+
+	monthly := report.Alerts[1]
+	assert.Equal(t, gold_sales.AlertMonthlySpend, monthly.Kind)
+	assert.Equal(t, spenderOneBuilder(), monthly.Spender)
+	assert.Equal(t, gold_sales.ReportMonth("Jul 2020"), monthly.Month)
+	assert.InDelta(t, 10.0, monthly.Baseline, 0.0001)
+	assert.Greater(t, monthly.Score, 3.5)
+	assert.Contains(t, monthly.Reason, "above the median")
+
+	large := report.Alerts[2]
+	assert.Equal(t, gold_sales.AlertLargeSpend, large.Kind)
+	assert.Equal(t, spenderOneBuilder(), large.Spender)
+	assert.Equal(t, gold_sales.ReportMonth("Jul 2020"), large.Month)
+	assert.InDelta(t, 60.0, large.Value, 0.0001)
+	assert.InDelta(t, 10.0, large.Baseline, 0.0001)
+}
+
+func TestMonthlySpendAlertsNeedHistory(t *testing.T) {
+	options := gold_sales.DefaultAnomalyOptions()
+	options.MinHistoryMonths = 7
+	totals := spenderTotalsByMonth(groupSpendsBySpender(unusualSpending()[spenderOneBuilder()]))
+
+	assert.Empty(t, monthlySpendAlerts(totals, options))
+}
+
+func TestMonthlySpendAlertsWhenSpendingStops(t *testing.T) {
+	spenderOne := spenderOneBuilder()
+	spenderTwo := spenderTwoBuilder()
+	spends := make([]gold_sales.GoldPayment, 0)
+	for month := time.January; month <= time.June; month++ {
+		date := time.Date(2020, month, 1, 10, 0, 0, 0, time.UTC)
+		spends = append(spends, anomalySpend(spenderOne, date, 10))
+	}
+	spends = append(spends, anomalySpend(spenderTwo,
+		time.Date(2020, time.September, 1, 10, 0, 0, 0, time.UTC), 1))
+	totals := spenderTotalsByMonth(groupSpendsBySpender(spends))
+
+	alerts := monthlySpendAlerts(totals, gold_sales.DefaultAnomalyOptions())
+	july := make([]gold_sales.Alert, 0)
+	for _, alert := range alerts {
+		if alert.Spender == spenderOne && alert.Month == "Jul 2020" {
+			july = append(july, alert)
+		}
+	}
+	require.Len(t, july, 1, "expected the month without spending to be flagged")
+	assert.Equal(t, 0.0, july[0].Value)
+	assert.InDelta(t, 10.0, july[0].Baseline, 0.0001)
+	assert.Contains(t, july[0].Reason, "below the median")
+}
+
+func TestBurstAlerts(t *testing.T) {
+	start := time.Date(2020, time.March, 3, 10, 0, 0, 0, time.UTC)
+	options := gold_sales.DefaultAnomalyOptions()
+
+	testCases := []struct {
+		Name           string
+		Offsets        []time.Duration
+		ExpectedBursts int
+	}{
+		{"Spread out", []time.Duration{0, 2 * time.Hour, 4 * time.Hour}, 0},
+		{"Within the window", []time.Duration{0, 20 * time.Minute, time.Hour}, 1},
+		{"Two bursts", []time.Duration{0, time.Minute, 2 * time.Minute,
+			5 * time.Hour, 5*time.Hour + time.Minute, 5*time.Hour + 2*time.Minute}, 2},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			spends := make([]gold_sales.GoldPayment, len(tc.Offsets))
+			for i, offset := range tc.Offsets {
+				spends[i] = anomalySpend(spenderTwoBuilder(), start.Add(offset), 1)
+			}
+			assert.Len(t, burstAlerts(spends, options), tc.ExpectedBursts)
+		})
+	}
+}
+
+func TestBurstAlertsCountSpendsInTheMetric(t *testing.T) {
+	start := time.Date(2020, time.March, 3, 10, 0, 0, 0, time.UTC)
+	spends := []gold_sales.GoldPayment{
+		anomalySpend(spenderTwoBuilder(), start, 1),
+		anomalySpend(spenderTwoBuilder(), start.Add(time.Minute), 1),
+		anomalySpend(spenderTwoBuilder(), start.Add(2*time.Minute), 0),
+	}
+	spends[2].Amount = 20
+
+	options := gold_sales.DefaultAnomalyOptions()
+	assert.Empty(t, burstAlerts(spends, options), "a spend of no gold is not counted")
+	options.Metric = gold_sales.RankByAmount
+	assert.Len(t, burstAlerts(spends, options), 1)
+}
+
+// unusualSpending by spender one, who spends steadily for six months then
+// much more in the seventh, and spender two, who spends three times within
+// half an hour.
+func unusualSpending() repository.MockLedger {
+	spenderOne := spenderOneBuilder()
+	spenderTwo := spenderTwoBuilder()
+	mockLedger := make(repository.MockLedger)
+	for i, grams := range []float64{10, 11, 9, 10, 10, 11, 60} {
+		date := time.Date(2020, time.January+time.Month(i), 1, 10, 0, 0, 0, time.UTC)
+		mockLedger[spenderOne] = append(mockLedger[spenderOne], anomalySpend(spenderOne, date, grams))
+	}
+	start := time.Date(2020, time.March, 3, 10, 0, 0, 0, time.UTC)
+	for _, offset := range []time.Duration{0, 10 * time.Minute, 30 * time.Minute, 48 * time.Hour} {
+		mockLedger[spenderTwo] = append(mockLedger[spenderTwo], anomalySpend(spenderTwo, start.Add(offset), 1))
+	}
+	return mockLedger
+}
+
+func anomalySpend(spender gold_sales.Spender, date time.Time, grams float64) gold_sales.GoldPayment {
+	return gold_sales.GoldPayment{
+		Spender:      spender,
+		Description:  gold_sales.GoldSpend,
+		Amount:       grams * 20.0,
+		Rate:         20.0,
+		ToCurrency:   "GGM",
+		FromCurrency: "GBP",
+		Date:         date,
+		GramWeight:   grams,
+	}
+}
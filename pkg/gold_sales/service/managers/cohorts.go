@@ -0,0 +1,125 @@
+package managers
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/JonPulfer/gold_sales/pkg/gold_sales"
+	"github.com/JonPulfer/gold_sales/pkg/gold_sales/infrastructure/tracing"
+)
+
+// Cohorts of the customers by the month of their first gold payment, with
+// the share of each cohort that spent gold in every month after, up to the
+// last month of the ledgers. A customer joins their cohort even if their
+// first month nets to nothing, but is only retained in a month when their
+// spend net of refunds is more than zero.
+func (ts AnalysisService) Cohorts(ctx context.Context) (*gold_sales.CohortReport, error) {
+	span, ctx := tracing.StartSpanFromContext(ctx, "AnalysisService.Cohorts")
+	defer span.Finish()
+
+	payments, err := ts.repository.FetchAll(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get payments from repository")
+	}
+	span.SetTag("payments", len(payments))
+	ts.metrics.recordPayments("cohorts", len(payments))
+
+	firsts := make(map[gold_sales.Spender]int)
+	for _, payment := range payments {
+		index := monthIndex(payment.Date.UTC())
+		if first, ok := firsts[payment.Spender]; !ok || index < first {
+			firsts[payment.Spender] = index
+		}
+	}
+
+	spending := make(map[gold_sales.Spender]map[int]gold_sales.MonthlySpend)
+	last := 0
+	for month, spenders := range spenderTotalsByMonth(groupSpendsBySpender(payments)) {
+		start, err := time.Parse("Jan 2006", string(month))
+		if err != nil {
+			continue
+		}
+		index := monthIndex(start)
+		if index > last {
+			last = index
+		}
+		for spender, spend := range spenders {
+			if spend.TotalSpend <= 0 {
+				continue
+			}
+			if spending[spender] == nil {
+				spending[spender] = make(map[int]gold_sales.MonthlySpend)
+			}
+			spending[spender][index] = spend
+		}
+	}
+
+	members := make(map[int][]gold_sales.Spender)
+	for spender, first := range firsts {
+		members[first] = append(members[first], spender)
+	}
+	months := make([]int, 0, len(members))
+	for first := range members {
+		months = append(months, first)
+	}
+	sort.Ints(months)
+
+	report := &gold_sales.CohortReport{
+		GeneratedAt: time.Now().UTC(),
+		Cohorts:     make([]gold_sales.Cohort, 0, len(months)),
+	}
+	for _, first := range months {
+		cohort := gold_sales.Cohort{
+			Month:     gold_sales.ParseReportMonth(monthStart(first)),
+			Customers: len(members[first]),
+			Retention: make([]gold_sales.CohortRetention, 0, last-first+1),
+		}
+		for index := first; index <= last; index++ {
+			retention := gold_sales.CohortRetention{
+				MonthsAfter: index - first,
+				Month:       gold_sales.ParseReportMonth(monthStart(index)),
+			}
+			var grams gold_sales.TotalSpend
+			var amount float64
+			currency := ""
+			for _, spender := range members[first] {
+				if spend, ok := spending[spender][index]; ok {
+					retention.Customers++
+					grams += spend.TotalSpend
+					amount += spend.TotalAmount
+					currency = gold_sales.CombineCurrencies(currency, spend.Currency)
+				}
+			}
+			retention.Share = float64(retention.Customers) / float64(cohort.Customers)
+			if retention.Customers > 0 {
+				retention.AverageGrams = grams / gold_sales.TotalSpend(retention.Customers)
+			}
+			// Amounts paid from different currencies cannot be averaged.
+			if retention.Customers > 0 && currency != "" &&
+				currency != gold_sales.MixedCurrencies {
+				average := amount / float64(retention.Customers)
+				retention.AverageAmount = &average
+				retention.Currency = currency
+			}
+			cohort.Retention = append(cohort.Retention, retention)
+		}
+		report.Cohorts = append(report.Cohorts, cohort)
+	}
+	span.SetTag("cohorts", len(report.Cohorts))
+
+	return report, nil
+}
+
+// monthIndex counts the months since the start of year zero, so months can
+// be subtracted.
+func monthIndex(start time.Time) int {
+	return start.Year()*12 + int(start.Month()) - 1
+}
+
+// monthStart of the month with the index.
+func monthStart(index int) time.Time {
+	return time.Date(index/12, time.Month(index%12+1), 1, 0, 0, 0, 0, time.UTC)
+}
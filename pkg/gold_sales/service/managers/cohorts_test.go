@@ -0,0 +1,96 @@
+package managers
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/JonPulfer/gold_sales/pkg/gold_sales"
+	"github.com/JonPulfer/gold_sales/pkg/gold_sales/infrastructure/repository"
+)
+
+func TestCohorts(t *testing.T) {
+	mockLedger := unusualSpending()
+	refunder := gold_sales.Spender{FirstName: "Refund", LastName: "Spender", Email: "refund@mock.com"}
+	spend := anomalySpend(refunder, time.Date(2020, time.March, 10, 9, 0, 0, 0, time.UTC), 4)
+	refund := anomalySpend(refunder, time.Date(2020, time.April, 2, 9, 0, 0, 0, time.UTC), -4)
+	mockLedger[refunder] = []gold_sales.GoldPayment{spend, refund}
+
+	report, err := analysisServiceForTests(mockLedger).Cohorts(context.Background())
+	require.NoError(t, err)
+	require.Len(t, report.Cohorts, 2)
+
+	january := report.Cohorts[0]
+	assert.Equal(t, gold_sales.ReportMonth("Jan 2020"), january.Month)
+	assert.Equal(t, 1, january.Customers)
+	require.Len(t, january.Retention, 7)
+	for n, retention := range january.Retention {
+		assert.Equal(t, n, retention.MonthsAfter)
+		assert.InDelta(t, 1.0, retention.Share, 0.0001)
+	}
+	assert.Equal(t, gold_sales.ReportMonth("Jul 2020"), january.Retention[6].Month)
+	assert.InDelta(t, 60.0, float64(january.Retention[6].AverageGrams), 0.0001)
+
+	march := report.Cohorts[1]
+	assert.Equal(t, gold_sales.ReportMonth("Mar 2020"), march.Month)
+	assert.Equal(t, 2, march.Customers)
+	require.Len(t, march.Retention, 5)
+	assert.InDelta(t, 1.0, march.Retention[0].Share, 0.0001)
+	assert.InDelta(t, 4.0, float64(march.Retention[0].AverageGrams), 0.0001)
+	require.NotNil(t, march.Retention[0].AverageAmount)
+	assert.InDelta(t, 80.0, *march.Retention[0].AverageAmount, 0.0001)
+	assert.Equal(t, "GBP", march.Retention[0].Currency)
+	for _, retention := range march.Retention[1:] {
+		assert.Equal(t, 0, retention.Customers)
+		assert.Zero(t, retention.Share)
+	}
+}
+
+func TestCohortsAverageAmountOfOneCurrency(t *testing.T) {
+	pounds := spenderOneBuilder()
+	dollars := spenderTwoBuilder()
+	march := time.Date(2020, time.March, 10, 9, 0, 0, 0, time.UTC)
+	dollarSpend := anomalySpend(dollars, march, 2)
+	dollarSpend.FromCurrency = "USD"
+	ledger := repository.MockLedger{
+		pounds:  {anomalySpend(pounds, march, 1), anomalySpend(pounds, march.AddDate(0, 1, 0), 1)},
+		dollars: {dollarSpend},
+	}
+
+	report, err := analysisServiceForTests(ledger).Cohorts(context.Background())
+	require.NoError(t, err)
+	require.Len(t, report.Cohorts, 1)
+
+	retention := report.Cohorts[0].Retention
+	require.Len(t, retention, 2)
+	assert.InDelta(t, 1.5, float64(retention[0].AverageGrams), 0.0001)
+	assert.Nil(t, retention[0].AverageAmount, "pounds and dollars cannot be averaged")
+	assert.Empty(t, retention[0].Currency)
+	require.NotNil(t, retention[1].AverageAmount)
+	assert.InDelta(t, 20.0, *retention[1].AverageAmount, 0.0001)
+	assert.Equal(t, "GBP", retention[1].Currency)
+}
+
+func TestCohortsByFirstPayment(t *testing.T) {
+	spender := spenderOneBuilder()
+	ledger := repository.MockLedger{spender: {
+		anomalySpend(spender, time.Date(2020, time.February, 5, 9, 0, 0, 0, time.UTC), 2),
+		anomalySpend(spender, time.Date(2020, time.February, 20, 9, 0, 0, 0, time.UTC), -2),
+		anomalySpend(spender, time.Date(2020, time.May, 1, 9, 0, 0, 0, time.UTC), 3),
+	}}
+
+	report, err := analysisServiceForTests(ledger).Cohorts(context.Background())
+	require.NoError(t, err)
+	require.Len(t, report.Cohorts, 1)
+
+	february := report.Cohorts[0]
+	assert.Equal(t, gold_sales.ReportMonth("Feb 2020"), february.Month,
+		"the cohort is the month of the first payment, though it nets to nothing")
+	require.Len(t, february.Retention, 4)
+	assert.Zero(t, february.Retention[0].Share)
+	assert.InDelta(t, 1.0, february.Retention[3].Share, 0.0001)
+	assert.InDelta(t, 3.0, float64(february.Retention[3].AverageGrams), 0.0001)
+}
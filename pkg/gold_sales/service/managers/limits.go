@@ -0,0 +1,44 @@
+package managers
+
+import (
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/JonPulfer/gold_sales/pkg/gold_sales"
+	"github.com/JonPulfer/gold_sales/pkg/gold_sales/infrastructure/tracing"
+)
+
+// LimitBreaches of the limits by every customer, checking their payments in
+// date order as they would have been checked when they were made.
+func (ts AnalysisService) LimitBreaches(
+	ctx context.Context,
+	limits []gold_sales.LimitConfig,
+) (*gold_sales.LimitsReport, error) {
+	span, ctx := tracing.StartSpanFromContext(ctx, "AnalysisService.LimitBreaches")
+	defer span.Finish()
+
+	checker, err := gold_sales.NewLimitChecker(limits)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid limits")
+	}
+	payments, err := ts.repository.FetchAll(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get payments from repository")
+	}
+	span.SetTag("payments", len(payments))
+	ts.metrics.recordPayments("limits", len(payments))
+
+	breaches, err := checker.CheckAll(payments)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to check limits")
+	}
+	span.SetTag("breaches", len(breaches))
+
+	return &gold_sales.LimitsReport{
+		GeneratedAt: time.Now().UTC(),
+		Limits:      checker.Limits(),
+		Breaches:    breaches,
+	}, nil
+}
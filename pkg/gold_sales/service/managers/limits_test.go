@@ -0,0 +1,52 @@
+package managers
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/JonPulfer/gold_sales/pkg/gold_sales"
+)
+
+func TestLimitBreaches(t *testing.T) {
+	analysis := analysisServiceForTests(unusualSpending())
+
+	report, err := analysis.LimitBreaches(context.Background(), []gold_sales.LimitConfig{
+		{Name: "daily", Window: gold_sales.LimitRolling, Days: 1, Max: 2.5},
+		{Name: "monthly", Window: gold_sales.LimitMonth, Max: 50},
+	})
+	require.NoError(t, err)
+	require.Len(t, report.Breaches, 9)
+
+	burst := breachesOf(report, "daily", spenderTwoBuilder())
+	require.Len(t, burst, 1)
+	assert.Len(t, burst[0].PaymentIDs, 3)
+	assert.InDelta(t, 3.0, burst[0].Value, 0.0001)
+
+	monthly := breachesOf(report, "monthly", spenderOneBuilder())
+	require.Len(t, monthly, 1)
+	assert.Equal(t, gold_sales.ReportMonth("Jul 2020"), gold_sales.ParseReportMonth(monthly[0].Date))
+	assert.InDelta(t, 60.0, monthly[0].Value, 0.0001)
+	assert.Len(t, breachesOf(report, "daily", spenderOneBuilder()), 7,
+		"each of spender one's spends is over 2.5 grams")
+
+	_, err = analysis.LimitBreaches(context.Background(), []gold_sales.LimitConfig{{Window: "week"}})
+	assert.Error(t, err)
+}
+
+// breachesOf the limit by the spender in the report.
+func breachesOf(
+	report *gold_sales.LimitsReport,
+	limit string,
+	spender gold_sales.Spender,
+) []gold_sales.LimitBreach {
+	found := make([]gold_sales.LimitBreach, 0)
+	for _, breach := range report.Breaches {
+		if breach.Limit == limit && breach.Spender == spender {
+			found = append(found, breach)
+		}
+	}
+	return found
+}
@@ -0,0 +1,77 @@
+package managers
+
+import (
+	"github.com/JonPulfer/gold_sales/pkg/gold_sales"
+	"github.com/JonPulfer/gold_sales/pkg/gold_sales/infrastructure/repository"
+)
+
+// RunningTotals of each spender by month, kept between runs over an append
+// only ledger together with the Watermark of how far it has been ingested.
+type RunningTotals struct {
+	Watermark repository.Watermark                                  `json:"watermark"`
+	Months    map[gold_sales.ReportMonth]gold_sales.MonthlySpenders `json:"months"`
+	// Restarted is set when the ledger no longer matched the Watermark and
+	// the totals were ingested again from the start.
+	Restarted bool `json:"-"`
+
+	index map[gold_sales.ReportMonth]map[gold_sales.Spender]int
+}
+
+// NewRunningTotals with nothing ingested.
+func NewRunningTotals() *RunningTotals {
+	return &RunningTotals{Months: make(map[gold_sales.ReportMonth]gold_sales.MonthlySpenders)}
+}
+
+// Add the payments to the totals of their spender and month.
+func (rt *RunningTotals) Add(payments []gold_sales.GoldPayment) {
+	if rt.Months == nil {
+		rt.Months = make(map[gold_sales.ReportMonth]gold_sales.MonthlySpenders)
+	}
+	if rt.index == nil {
+		rt.index = make(map[gold_sales.ReportMonth]map[gold_sales.Spender]int)
+		for month, spenders := range rt.Months {
+			rt.index[month] = make(map[gold_sales.Spender]int)
+			for i, spend := range spenders {
+				rt.index[month][spend.Spender] = i
+			}
+		}
+	}
+
+	for _, payment := range payments {
+		month := gold_sales.ParseReportMonth(payment.Date)
+		if _, ok := rt.index[month]; !ok {
+			rt.index[month] = make(map[gold_sales.Spender]int)
+		}
+		i, ok := rt.index[month][payment.Spender]
+		if !ok {
+			i = len(rt.Months[month])
+			rt.index[month][payment.Spender] = i
+			rt.Months[month] = append(rt.Months[month],
+				gold_sales.MonthlySpend{Spender: payment.Spender})
+		}
+		rt.Months[month][i].TotalSpend += gold_sales.TotalSpend(payment.GramWeight)
+		rt.Months[month][i].TotalAmount += payment.Amount
+		rt.Months[month][i].Currency = gold_sales.CombineCurrencies(
+			rt.Months[month][i].Currency, payment.FromCurrency)
+	}
+}
+
+// Reset the totals and Watermark so the ledger is ingested from the start.
+func (rt *RunningTotals) Reset() {
+	rt.Watermark = repository.Watermark{}
+	rt.Months = make(map[gold_sales.ReportMonth]gold_sales.MonthlySpenders)
+	rt.index = nil
+	rt.Restarted = true
+}
+
+// grouped copy of the totals by month that can be sorted without disturbing
+// the running totals.
+func (rt *RunningTotals) grouped() map[gold_sales.ReportMonth]gold_sales.MonthlySpenders {
+	grouped := make(map[gold_sales.ReportMonth]gold_sales.MonthlySpenders, len(rt.Months))
+	for month, spenders := range rt.Months {
+		copied := make(gold_sales.MonthlySpenders, len(spenders))
+		copy(copied, spenders)
+		grouped[month] = copied
+	}
+	return grouped
+}
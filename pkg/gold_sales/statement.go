@@ -0,0 +1,170 @@
+package gold_sales
+
+import (
+	"bytes"
+	"encoding/csv"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// Period of time an analysis covers. From is inclusive and To is exclusive.
+type Period struct {
+	From time.Time `json:"from"`
+	To   time.Time `json:"to"`
+}
+
+// Contains reports whether the time falls within the Period.
+func (p Period) Contains(t time.Time) bool {
+	return !t.Before(p.From) && t.Before(p.To)
+}
+
+// LastDay within the Period.
+func (p Period) LastDay() time.Time {
+	return p.To.AddDate(0, 0, -1)
+}
+
+func (p Period) String() string {
+	return p.From.Format("2006-01-02") + " - " + p.LastDay().Format("2006-01-02")
+}
+
+// SpenderStatement of the gold spends for a Spender over a Period. The
+// opening, closing and cumulative spends are the running total of grams of
+// gold the Spender has spent net of refunds, not the gold they hold, which
+// buying and selling gold change as well.
+type SpenderStatement struct {
+	Spender          Spender             `json:"spender"`
+	Period           Period              `json:"period"`
+	OpeningSpend     float64             `json:"openingSpend"`
+	ClosingSpend     float64             `json:"closingSpend"`
+	Lines            []StatementLine     `json:"lines"`
+	MonthlySubtotals []StatementSubtotal `json:"monthlySubtotals"`
+}
+
+// StatementLine for a single gold spend.
+type StatementLine struct {
+	Date        time.Time `json:"date"`
+	Description string    `json:"description"`
+	Amount      float64   `json:"amount"`
+	Rate        float64   `json:"rate"`
+	GramWeight  float64   `json:"gramWeight"`
+	// CumulativeSpend in grams up to and including the spend.
+	CumulativeSpend float64 `json:"cumulativeSpend"`
+}
+
+// StatementSubtotal of the spends in a ReportMonth.
+type StatementSubtotal struct {
+	Month      ReportMonth `json:"month"`
+	Amount     float64     `json:"amount"`
+	GramWeight float64     `json:"gramWeight"`
+}
+
+// NewSpenderStatement builds the statement for the Period from all the
+// payments made by the Spender. Payments before the Period make up the
+// opening spend and payments after it are ignored.
+func NewSpenderStatement(
+	spender Spender,
+	period Period,
+	payments []GoldPayment,
+) *SpenderStatement {
+
+	ordered := make([]GoldPayment, len(payments))
+	copy(ordered, payments)
+	sort.SliceStable(ordered, func(i, j int) bool {
+		return ordered[i].Date.Before(ordered[j].Date)
+	})
+
+	statement := &SpenderStatement{
+		Spender:          spender,
+		Period:           period,
+		Lines:            make([]StatementLine, 0),
+		MonthlySubtotals: make([]StatementSubtotal, 0),
+	}
+
+	for _, payment := range ordered {
+		if payment.Date.Before(period.From) {
+			statement.OpeningSpend = statement.OpeningSpend + payment.GramWeight
+		}
+	}
+
+	spent := statement.OpeningSpend
+	for _, payment := range ordered {
+		if !period.Contains(payment.Date) {
+			continue
+		}
+		spent = spent + payment.GramWeight
+		statement.Lines = append(statement.Lines, StatementLine{
+			Date:            payment.Date,
+			Description:     payment.Description,
+			Amount:          payment.Amount,
+			Rate:            payment.Rate,
+			GramWeight:      payment.GramWeight,
+			CumulativeSpend: spent,
+		})
+
+		month := ParseReportMonth(payment.Date)
+		last := len(statement.MonthlySubtotals) - 1
+		if last < 0 || statement.MonthlySubtotals[last].Month != month {
+			statement.MonthlySubtotals = append(statement.MonthlySubtotals,
+				StatementSubtotal{Month: month})
+			last = last + 1
+		}
+		statement.MonthlySubtotals[last].Amount += payment.Amount
+		statement.MonthlySubtotals[last].GramWeight += payment.GramWeight
+	}
+	statement.ClosingSpend = spent
+
+	return statement
+}
+
+// unsafeFilenameChars that should not make it into a statement filename.
+var unsafeFilenameChars = regexp.MustCompile("[^a-zA-Z0-9@._-]+")
+
+// Filename for the statement when written out with the given extension.
+func (ss SpenderStatement) Filename(extension string) string {
+	return unsafeFilenameChars.ReplaceAllString(ss.Spender.Email, "_") +
+		"_" + ss.Period.From.Format("20060102") +
+		"_" + ss.Period.LastDay().Format("20060102") + "." + extension
+}
+
+// FormattedAsCSV in a buffer ready to be copied to an io.Writer.
+func (ss *SpenderStatement) FormattedAsCSV() *bytes.Buffer {
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+
+	_ = w.Write([]string{"statement", ss.Spender.FirstName, ss.Spender.LastName,
+		ss.Spender.Email})
+	_ = w.Write([]string{"period", ss.Period.From.Format("2006-01-02"),
+		ss.Period.LastDay().Format("2006-01-02")})
+	_ = w.Write([]string{"opening_spend", formatGrams(ss.OpeningSpend)})
+	_ = w.Write([]string{"date", "description", "amount", "rate", "grams",
+		"cumulative_spend"})
+	for _, line := range ss.Lines {
+		_ = w.Write([]string{
+			line.Date.Format("02/01/2006 15:04"),
+			line.Description,
+			strconv.FormatFloat(line.Amount, 'f', 2, 64),
+			strconv.FormatFloat(line.Rate, 'f', -1, 64),
+			formatGrams(line.GramWeight),
+			formatGrams(line.CumulativeSpend),
+		})
+	}
+	_ = w.Write([]string{"month", "amount", "grams"})
+	for _, subtotal := range ss.MonthlySubtotals {
+		_ = w.Write([]string{
+			string(subtotal.Month),
+			strconv.FormatFloat(subtotal.Amount, 'f', 2, 64),
+			formatGrams(subtotal.GramWeight),
+		})
+	}
+	_ = w.Write([]string{"closing_spend", formatGrams(ss.ClosingSpend)})
+	w.Flush()
+
+	return &buf
+}
+
+// formatGrams to the precision the business reports gold weights in.
+func formatGrams(grams float64) string {
+	return strconv.FormatFloat(grams, 'f', 4, 64)
+}
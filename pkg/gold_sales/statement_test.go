@@ -0,0 +1,49 @@
+package gold_sales
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewSpenderStatement(t *testing.T) {
+	spender := Spender{FirstName: "Alayna", LastName: "Sparks", Email: "alayna.sparks@mailinator.com"}
+	period := Period{
+		From: time.Date(2020, 3, 1, 0, 0, 0, 0, time.UTC),
+		To:   time.Date(2020, 5, 1, 0, 0, 0, 0, time.UTC),
+	}
+	payment := func(amount, grams float64, date time.Time) GoldPayment {
+		return GoldPayment{Spender: spender, Description: GoldSpend, Amount: amount,
+			Rate: amount / grams, Date: date, GramWeight: grams}
+	}
+	payments := []GoldPayment{
+		payment(100, 2, time.Date(2020, 4, 20, 9, 0, 0, 0, time.UTC)),
+		payment(50, 1, time.Date(2020, 2, 10, 9, 0, 0, 0, time.UTC)),
+		payment(150, 3, time.Date(2020, 3, 5, 9, 0, 0, 0, time.UTC)),
+		payment(-50, -1, time.Date(2020, 4, 2, 9, 0, 0, 0, time.UTC)),
+		payment(200, 4, time.Date(2020, 5, 1, 0, 0, 0, 0, time.UTC)),
+	}
+
+	statement := NewSpenderStatement(spender, period, payments)
+
+	assert.Equal(t, spender, statement.Spender)
+	assert.InDelta(t, 1.0, statement.OpeningSpend, 0.0001)
+	assert.InDelta(t, 5.0, statement.ClosingSpend, 0.0001)
+
+	require.Len(t, statement.Lines, 3)
+	assert.Equal(t, time.Date(2020, 3, 5, 9, 0, 0, 0, time.UTC), statement.Lines[0].Date)
+	assert.InDelta(t, 4.0, statement.Lines[0].CumulativeSpend, 0.0001)
+	assert.InDelta(t, 3.0, statement.Lines[1].CumulativeSpend, 0.0001)
+	assert.InDelta(t, 5.0, statement.Lines[2].CumulativeSpend, 0.0001)
+
+	require.Len(t, statement.MonthlySubtotals, 2)
+	assert.Equal(t, ReportMonth("Mar 2020"), statement.MonthlySubtotals[0].Month)
+	assert.InDelta(t, 150.0, statement.MonthlySubtotals[0].Amount, 0.0001)
+	assert.Equal(t, ReportMonth("Apr 2020"), statement.MonthlySubtotals[1].Month)
+	assert.InDelta(t, 50.0, statement.MonthlySubtotals[1].Amount, 0.0001)
+	assert.InDelta(t, 1.0, statement.MonthlySubtotals[1].GramWeight, 0.0001)
+
+	assert.Equal(t, "alayna.sparks@mailinator.com_20200301_20200430.csv", statement.Filename("csv"))
+}
@@ -0,0 +1,98 @@
+package gold_sales
+
+import (
+	"fmt"
+	htmltemplate "html/template"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	texttemplate "text/template"
+	"unicode/utf8"
+
+	"github.com/pkg/errors"
+)
+
+// TemplateRenderer renders the report through a user supplied Go template.
+// Templates are executed against a ReportTemplateData.
+type TemplateRenderer struct {
+	execute func(w io.Writer, data interface{}) error
+}
+
+// ReportTemplateData available to a TemplateRenderer.
+type ReportTemplateData struct {
+	Months []MonthTopSpenders
+}
+
+// templateFuncs available in report templates to help with layout.
+var templateFuncs = map[string]interface{}{
+	"rank":     func(index int) int { return index + 1 },
+	"upper":    strings.ToUpper,
+	"lower":    strings.ToLower,
+	"padRight": padRight,
+	"padLeft":  padLeft,
+}
+
+// NewTextTemplateRenderer parses the text/template source.
+func NewTextTemplateRenderer(name, source string) (*TemplateRenderer, error) {
+	tmpl, err := texttemplate.New(name).Funcs(templateFuncs).Parse(source)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to parse text template")
+	}
+	return &TemplateRenderer{execute: tmpl.Execute}, nil
+}
+
+// NewHTMLTemplateRenderer parses the html/template source, which escapes the
+// report values for safe inclusion in HTML.
+func NewHTMLTemplateRenderer(name, source string) (*TemplateRenderer, error) {
+	tmpl, err := htmltemplate.New(name).Funcs(templateFuncs).Parse(source)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to parse html template")
+	}
+	return &TemplateRenderer{execute: tmpl.Execute}, nil
+}
+
+// NewTemplateRendererFromFile loads the template, treating files with a
+// .html or .htm extension as html/template and anything else as
+// text/template.
+func NewTemplateRendererFromFile(filename string) (*TemplateRenderer, error) {
+	source, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read template")
+	}
+	name := filepath.Base(filename)
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".html", ".htm":
+		return NewHTMLTemplateRenderer(name, string(source))
+	default:
+		return NewTextTemplateRenderer(name, string(source))
+	}
+}
+
+func (tr *TemplateRenderer) Render(w io.Writer, report *MonthlyTopSpendersAnalysisReport) error {
+	return tr.execute(w, ReportTemplateData{Months: report.Months()})
+}
+
+// padRight the value with spaces to the width, truncating longer values.
+func padRight(width int, value interface{}) string {
+	text := toText(value)
+	length := utf8.RuneCountInString(text)
+	if length >= width {
+		return string([]rune(text)[:width])
+	}
+	return text + strings.Repeat(" ", width-length)
+}
+
+// padLeft the value with spaces to the width, truncating longer values.
+func padLeft(width int, value interface{}) string {
+	text := toText(value)
+	length := utf8.RuneCountInString(text)
+	if length >= width {
+		return string([]rune(text)[:width])
+	}
+	return strings.Repeat(" ", width-length) + text
+}
+
+func toText(value interface{}) string {
+	return fmt.Sprint(value)
+}
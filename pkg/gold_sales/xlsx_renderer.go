@@ -0,0 +1,260 @@
+package gold_sales
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Styles defined in xlsxStyles, referenced by index from each cell.
+const (
+	xlsxStyleDefault = iota
+	xlsxStyleHeader
+	xlsxStyleGrams
+	xlsxStyleAmount
+	xlsxStyleMonth
+	xlsxStyleAmountGBP
+)
+
+// xlsxEpoch that spreadsheet date serial numbers count days from.
+var xlsxEpoch = time.Date(1899, 12, 30, 0, 0, 0, 0, time.UTC)
+
+// xlsxCell with a typed value. Exactly one of the value fields is used.
+type xlsxCell struct {
+	text   string
+	number float64
+	isText bool
+	style  int
+}
+
+func textCell(text string, style int) xlsxCell {
+	return xlsxCell{text: text, isText: true, style: style}
+}
+
+func numberCell(number float64, style int) xlsxCell {
+	return xlsxCell{number: number, style: style}
+}
+
+func monthCell(month ReportMonth) xlsxCell {
+	monthStart, err := time.Parse("Jan 2006", string(month))
+	if err != nil {
+		return textCell(string(month), xlsxStyleDefault)
+	}
+	return numberCell(monthStart.Sub(xlsxEpoch).Hours()/24, xlsxStyleMonth)
+}
+
+type xlsxSheet struct {
+	name string
+	rows [][]xlsxCell
+}
+
+// renderXLSX as a workbook with a summary sheet followed by a sheet per
+// month. Spend cells are numbers formatted as grams or as the amount paid,
+// in pounds when every amount was paid in GBP and as plain numbers when the
+// currencies are mixed or unknown. Months are dates so the workbook can be
+// used without reformatting.
+func renderXLSX(w io.Writer, report *MonthlyTopSpendersAnalysisReport) error {
+	months := report.Months()
+	amountStyle := xlsxStyleAmount
+	if report.AmountCurrency() == "GBP" {
+		amountStyle = xlsxStyleAmountGBP
+	}
+
+	summary := xlsxSheet{name: "Summary", rows: [][]xlsxCell{{
+		textCell("Month", xlsxStyleHeader),
+		textCell("All spenders (g)", xlsxStyleHeader),
+		textCell("Top spenders (g)", xlsxStyleHeader),
+		textCell("Top spenders (amount)", xlsxStyleHeader),
+		textCell("Top spender", xlsxStyleHeader),
+	}}}
+	sheets := []xlsxSheet{summary}
+
+	for _, month := range months {
+		var topGrams TotalSpend
+		var topAmount float64
+		topSpender := ""
+		sheet := xlsxSheet{name: xlsxSheetName(string(month.Month)), rows: [][]xlsxCell{{
+			textCell("Rank", xlsxStyleHeader),
+			textCell("First name", xlsxStyleHeader),
+			textCell("Last name", xlsxStyleHeader),
+			textCell("Email", xlsxStyleHeader),
+			textCell("Spend (g)", xlsxStyleHeader),
+			textCell("Spend (amount)", xlsxStyleHeader),
+		}}}
+		for i, spend := range month.Spenders {
+			if i == 0 {
+				topSpender = spend.Spender.FirstName + " " + spend.Spender.LastName
+			}
+			topGrams = topGrams + spend.TotalSpend
+			topAmount = topAmount + spend.TotalAmount
+			sheet.rows = append(sheet.rows, []xlsxCell{
+				numberCell(float64(i+1), xlsxStyleDefault),
+				textCell(spend.Spender.FirstName, xlsxStyleDefault),
+				textCell(spend.Spender.LastName, xlsxStyleDefault),
+				textCell(spend.Spender.Email, xlsxStyleDefault),
+				numberCell(float64(spend.TotalSpend), xlsxStyleGrams),
+				numberCell(spend.TotalAmount, amountStyle),
+			})
+		}
+		sheets = append(sheets, sheet)
+
+		sheets[0].rows = append(sheets[0].rows, []xlsxCell{
+			monthCell(month.Month),
+			numberCell(float64(month.MonthTotal), xlsxStyleGrams),
+			numberCell(float64(topGrams), xlsxStyleGrams),
+			numberCell(topAmount, amountStyle),
+			textCell(topSpender, xlsxStyleDefault),
+		})
+	}
+
+	return writeXLSX(w, sheets)
+}
+
+// xlsxSheetName that the spreadsheet will accept.
+func xlsxSheetName(name string) string {
+	name = strings.NewReplacer(
+		"[", "(", "]", ")", ":", "-", "*", "-", "?", "", "/", "-", `\`, "-",
+	).Replace(name)
+	if len(name) > 31 {
+		name = name[:31]
+	}
+	return name
+}
+
+// xlsxPart of the zip package that makes up a workbook.
+type xlsxPart struct {
+	name    string
+	content []byte
+}
+
+func writeXLSX(w io.Writer, sheets []xlsxSheet) error {
+	archive := zip.NewWriter(w)
+
+	var contentTypes, workbook, workbookRels bytes.Buffer
+	contentTypes.WriteString(xml.Header +
+		`<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">` +
+		`<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>` +
+		`<Default Extension="xml" ContentType="application/xml"/>` +
+		`<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>` +
+		`<Override PartName="/xl/styles.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.styles+xml"/>`)
+	workbook.WriteString(xml.Header +
+		`<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" ` +
+		`xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships"><sheets>`)
+	workbookRels.WriteString(xml.Header +
+		`<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+		`<Relationship Id="rIdStyles" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/styles" Target="styles.xml"/>`)
+
+	for i, sheet := range sheets {
+		id := i + 1
+		fmt.Fprintf(&contentTypes,
+			`<Override PartName="/xl/worksheets/sheet%d.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>`,
+			id)
+		fmt.Fprintf(&workbook, `<sheet name="%s" sheetId="%d" r:id="rId%d"/>`,
+			xmlEscape(sheet.name), id, id)
+		fmt.Fprintf(&workbookRels,
+			`<Relationship Id="rId%d" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet%d.xml"/>`,
+			id, id)
+	}
+	contentTypes.WriteString(`</Types>`)
+	workbook.WriteString(`</sheets></workbook>`)
+	workbookRels.WriteString(`</Relationships>`)
+
+	parts := []xlsxPart{
+		{"[Content_Types].xml", contentTypes.Bytes()},
+		{"_rels/.rels", []byte(xlsxRootRels)},
+		{"xl/workbook.xml", workbook.Bytes()},
+		{"xl/_rels/workbook.xml.rels", workbookRels.Bytes()},
+		{"xl/styles.xml", []byte(xlsxStyles)},
+	}
+	for i, sheet := range sheets {
+		parts = append(parts, xlsxPart{
+			fmt.Sprintf("xl/worksheets/sheet%d.xml", i+1), sheetXML(sheet)})
+	}
+
+	for _, part := range parts {
+		entry, err := archive.Create(part.name)
+		if err != nil {
+			return err
+		}
+		if _, err := entry.Write(part.content); err != nil {
+			return err
+		}
+	}
+	return archive.Close()
+}
+
+func sheetXML(sheet xlsxSheet) []byte {
+	var buf bytes.Buffer
+	buf.WriteString(xml.Header +
+		`<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">` +
+		`<sheetViews><sheetView workbookViewId="0"><pane ySplit="1" topLeftCell="A2" state="frozen"/></sheetView></sheetViews>` +
+		`<cols><col min="1" max="6" width="20" customWidth="1"/></cols><sheetData>`)
+	for rowIdx, row := range sheet.rows {
+		fmt.Fprintf(&buf, `<row r="%d">`, rowIdx+1)
+		for colIdx, cell := range row {
+			ref := xlsxColumn(colIdx) + strconv.Itoa(rowIdx+1)
+			if cell.isText {
+				fmt.Fprintf(&buf, `<c r="%s" s="%d" t="inlineStr"><is><t>%s</t></is></c>`,
+					ref, cell.style, xmlEscape(cell.text))
+			} else {
+				fmt.Fprintf(&buf, `<c r="%s" s="%d"><v>%s</v></c>`,
+					ref, cell.style, strconv.FormatFloat(cell.number, 'f', -1, 64))
+			}
+		}
+		buf.WriteString(`</row>`)
+	}
+	buf.WriteString(`</sheetData></worksheet>`)
+	return buf.Bytes()
+}
+
+// xlsxColumn letters for the zero based column index.
+func xlsxColumn(index int) string {
+	column := ""
+	for index >= 0 {
+		column = string(rune('A'+index%26)) + column
+		index = index/26 - 1
+	}
+	return column
+}
+
+func xmlEscape(text string) string {
+	var buf bytes.Buffer
+	_ = xml.EscapeText(&buf, []byte(text))
+	return buf.String()
+}
+
+const xlsxRootRels = xml.Header +
+	`<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+	`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/>` +
+	`</Relationships>`
+
+// xlsxStyles with a cellXfs entry for each of the xlsxStyle constants.
+const xlsxStyles = xml.Header +
+	`<styleSheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">` +
+	`<numFmts count="4">` +
+	`<numFmt numFmtId="164" formatCode="0.0000&quot; g&quot;"/>` +
+	`<numFmt numFmtId="165" formatCode="#,##0.00"/>` +
+	`<numFmt numFmtId="166" formatCode="mmm yyyy"/>` +
+	`<numFmt numFmtId="167" formatCode="&quot;£&quot;#,##0.00"/>` +
+	`</numFmts>` +
+	`<fonts count="2"><font><sz val="11"/><name val="Calibri"/></font>` +
+	`<font><b/><sz val="11"/><name val="Calibri"/></font></fonts>` +
+	`<fills count="2"><fill><patternFill patternType="none"/></fill>` +
+	`<fill><patternFill patternType="gray125"/></fill></fills>` +
+	`<borders count="1"><border><left/><right/><top/><bottom/><diagonal/></border></borders>` +
+	`<cellStyleXfs count="1"><xf numFmtId="0" fontId="0" fillId="0" borderId="0"/></cellStyleXfs>` +
+	`<cellXfs count="6">` +
+	`<xf numFmtId="0" fontId="0" fillId="0" borderId="0" xfId="0"/>` +
+	`<xf numFmtId="0" fontId="1" fillId="0" borderId="0" xfId="0" applyFont="1"/>` +
+	`<xf numFmtId="164" fontId="0" fillId="0" borderId="0" xfId="0" applyNumberFormat="1"/>` +
+	`<xf numFmtId="165" fontId="0" fillId="0" borderId="0" xfId="0" applyNumberFormat="1"/>` +
+	`<xf numFmtId="166" fontId="0" fillId="0" borderId="0" xfId="0" applyNumberFormat="1"/>` +
+	`<xf numFmtId="167" fontId="0" fillId="0" borderId="0" xfId="0" applyNumberFormat="1"/>` +
+	`</cellXfs>` +
+	`<cellStyles count="1"><cellStyle name="Normal" xfId="0" builtinId="0"/></cellStyles>` +
+	`</styleSheet>`